@@ -0,0 +1,182 @@
+//Package canonico serializa JSON de forma deterministica, para que o mesmo valor gere sempre os
+//mesmos bytes e o mesmo hash: nos validadores que executam a transacao, em versoes diferentes do
+//Go e fora da rede. Nao depende do shim.
+//
+//A forma canonica tem as chaves dos objetos ordenadas pelos bytes UTF-8, nenhum espaco, numeros
+//num formato fixo, strings com uma unica forma de escape e o Unicode das strings e das chaves
+//normalizado para NFC, para que "e" seguido do acento combinante e "é" gerem os mesmos bytes.
+//
+//A normalizacao vem do golang.org/x/text/unicode/norm copiado em src/vendor, com as tabelas do
+//Unicode 15.0.0 fixas: todos os validadores e verificadores precisam usar a mesma versao.
+package canonico
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//serializa v com o encoding/json e reescreve na forma canonica
+func Marshal(v interface{}) ([]byte, error) {
+	entrada, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return JSON(entrada)
+}
+
+//reescreve um documento JSON na forma canonica
+func JSON(entrada []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(entrada))
+	decoder.UseNumber()
+	var valor interface{}
+	err := decoder.Decode(&valor)
+	if err != nil {
+		return nil, err
+	}
+	var resto interface{}
+	if decoder.Decode(&resto) != io.EOF {
+		return nil, errors.New("canonico: unexpected data after the JSON value")
+	}
+	var saida bytes.Buffer
+	err = escrever(&saida, valor)
+	if err != nil {
+		return nil, err
+	}
+	return saida.Bytes(), nil
+}
+
+//SHA-256 em hexadecimal da forma canonica
+func Hash(entrada []byte) (string, error) {
+	saida, err := JSON(entrada)
+	if err != nil {
+		return "", err
+	}
+	soma := sha256.Sum256(saida)
+	return hex.EncodeToString(soma[:]), nil
+}
+
+func escrever(b *bytes.Buffer, valor interface{}) error {
+	switch v := valor.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := numero(string(v))
+		if err != nil {
+			return err
+		}
+		b.WriteString(n)
+	case string:
+		escreverTexto(b, v)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			err := escrever(b, item)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]interface{}:
+		//as chaves sao ordenadas ja normalizadas; duas chaves com a mesma forma NFC seriam
+		//a mesma chave na forma canonica
+		normalizadas := make(map[string]string, len(v))
+		chaves := make([]string, 0, len(v))
+		for chave := range v {
+			normalizada := norm.NFC.String(chave)
+			if _, repetida := normalizadas[normalizada]; repetida {
+				return fmt.Errorf("canonico: duplicate key %q after NFC normalization", normalizada)
+			}
+			normalizadas[normalizada] = chave
+			chaves = append(chaves, normalizada)
+		}
+		sort.Strings(chaves)
+		b.WriteByte('{')
+		for i, chave := range chaves {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			escreverTexto(b, chave)
+			b.WriteByte(':')
+			err := escrever(b, v[normalizadas[chave]])
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("canonico: unexpected JSON value %T", valor)
+	}
+	return nil
+}
+
+//inteiros ficam com os digitos originais, que o JSON ja obriga a nao ter zeros a esquerda, para
+//nao perder precisao alem do float64. Os demais passam pelo float64 e saem com a menor
+//representacao: sem expoente entre 1e-6 e 1e21, como no JavaScript, e com expoente fora disso.
+//Assim 1.0, 1e0 e 1 saem todos como 1
+func numero(texto string) (string, error) {
+	if !strings.ContainsAny(texto, ".eE") {
+		if texto == "-0" {
+			return "0", nil
+		}
+		return texto, nil
+	}
+	f, err := strconv.ParseFloat(texto, 64)
+	if err != nil {
+		return "", fmt.Errorf("canonico: invalid number %s", texto)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	absoluto := math.Abs(f)
+	if absoluto >= 1e-6 && absoluto < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return strconv.FormatFloat(f, 'e', -1, 64), nil
+}
+
+//normaliza para NFC e escapa so aspas, barra invertida e caracteres de controle; o resto vai como
+//UTF-8 literal, sem o escape de <, > e & do encoding/json. Bytes UTF-8 invalidos viram U+FFFD
+func escreverTexto(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, r := range norm.NFC.String(s) {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,111 @@
+package canonico
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestJSONCanonico(t *testing.T) {
+	fmt.Println("Entering TestJSONCanonico")
+	a, err := JSON([]byte(`{"b": 1, "a": {"d": [3, 2], "c": 1503849607000}}`))
+	if err != nil || string(a) != `{"a":{"c":1503849607000,"d":[3,2]},"b":1}` {
+		t.Fatalf("Unexpected canonical form %s %v", a, err)
+	}
+	hashA, _ := Hash([]byte(`{"b":1,"a":{"c":1503849607000,"d":[3,2]}}`))
+	hashB, _ := Hash([]byte("{\n  \"a\": {\"d\": [3,2], \"c\": 1503849607000},\n  \"b\": 1\n}"))
+	if hashA != hashB || hashA != "801e11ae69139243aadc2db20018f6dac4697024c7271898800844502a8b21db" {
+		t.Fatalf("Expected the same fixed hash for the same object, got %s and %s", hashA, hashB)
+	}
+	for _, invalido := range []string{`{"a":`, `{} {}`, `1e400`} {
+		if _, err = JSON([]byte(invalido)); err == nil {
+			t.Fatalf("Expected %s to be rejected", invalido)
+		}
+	}
+}
+
+func TestNumerosCanonicos(t *testing.T) {
+	fmt.Println("Entering TestNumerosCanonicos")
+	casos := map[string]string{
+		`0`:                    `0`,
+		`-0`:                   `0`,
+		`-0.0`:                 `0`,
+		`1.0`:                  `1`,
+		`1e3`:                  `1000`,
+		`1.504454407e12`:       `1504454407000`,
+		`0.1`:                  `0.1`,
+		`0.33333333333333331`:  `0.3333333333333333`,
+		`-2.50`:                `-2.5`,
+		`1e-7`:                 `1e-07`,
+		`1E21`:                 `1e+21`,
+		`12345678901234567890`: `12345678901234567890`,
+	}
+	for entrada, esperado := range casos {
+		saida, err := JSON([]byte(entrada))
+		if err != nil || string(saida) != esperado {
+			t.Fatalf("Expected %s to be written as %s, got %s %v", entrada, esperado, saida, err)
+		}
+	}
+}
+
+func TestTextosCanonicos(t *testing.T) {
+	fmt.Println("Entering TestTextosCanonicos")
+	casos := map[string]string{
+		`"<a> & ção"`:            `"<a> & ção"`,
+		`"\/\"\\"`:                 `"/\"\\"`,
+		`"\u0001\t\n\u001F"`:       `"\u0001\t\n\u001f"`,
+		//U+2028 sai literal, sem o escape do encoding/json
+		"\"\u2028\"":             "\"\u2028\"",
+		"\"a\xffb\"":               "\"a\ufffdb\"",
+		`{"é":1,"e":2,"z":3}`:    `{"e":2,"z":3,"é":1}`,
+	}
+	for entrada, esperado := range casos {
+		saida, err := JSON([]byte(entrada))
+		if err != nil || string(saida) != esperado {
+			t.Fatalf("Expected %s to be written as %s, got %s %v", entrada, esperado, saida, err)
+		}
+	}
+}
+
+func TestMarshalEstavel(t *testing.T) {
+	fmt.Println("Entering TestMarshalEstavel")
+	type registro struct {
+		Zeta                   string        `json:"zeta"`
+		Alfa                   []int64       `json:"alfa"`
+		Taxa                   float64       `json:"taxa"`
+		Mapa                   map[string]int `json:"mapa"`
+	}
+	r := registro{"<b>", []int64{3, 1}, 0.25, map[string]int{"y": 1, "x": 2}}
+	esperado := `{"alfa":[3,1],"mapa":{"x":2,"y":1},"taxa":0.25,"zeta":"<b>"}`
+	for i := 0; i < 20; i++ {
+		saida, err := Marshal(&r)
+		if err != nil || string(saida) != esperado {
+			t.Fatalf("Expected stable bytes %s, got %s %v", esperado, saida, err)
+		}
+	}
+	//a forma canonica nao muda ao ser canonizada de novo
+	saida, _ := JSON([]byte(esperado))
+	if string(saida) != esperado {
+		t.Fatalf("Expected canonical form to be a fixed point, got %s", saida)
+	}
+}
+
+func TestUnicodeNormalizado(t *testing.T) {
+	fmt.Println("Entering TestUnicodeNormalizado")
+	//"e" seguido do acento combinante U+0301 e o "é" pre-composto
+	decomposto, err := JSON([]byte("{\"descricao\":\"Cafe\u0301\",\"e\u0301\":1}"))
+	if err != nil {
+		t.Fatalf("Expected decomposed text to be accepted: %s", err)
+	}
+	composto, _ := JSON([]byte("{\"descricao\":\"Caf\u00e9\",\"\u00e9\":1}"))
+	if string(decomposto) != string(composto) || string(composto) != "{\"descricao\":\"Caf\u00e9\",\"\u00e9\":1}" {
+		t.Fatalf("Expected the same NFC bytes, got %q and %q", decomposto, composto)
+	}
+	hashA, _ := Hash([]byte("\"Cafe\u0301\""))
+	hashB, _ := Hash([]byte("\"Caf\u00e9\""))
+	if hashA != hashB {
+		t.Fatalf("Expected the same hash for both forms")
+	}
+	if _, err = JSON([]byte("{\"e\u0301\":1,\"\u00e9\":2}")); err == nil {
+		t.Fatalf("Expected keys equal after NFC to be rejected")
+	}
+}
@@ -0,0 +1,81 @@
+//Comando gateway: servidor REST/JSON das operacoes do pedido (ver docs/gateway.md).
+//
+//	gateway [-endereco :8080] [-peer URL -chaincode ID -usuario U -atributos a,b]
+//	gateway -local [-endereco :8080]
+//
+//Com -local o chaincode roda em memoria, sem peer, e o papel do chamador vem do cabecalho
+//X-Papel (loja quando ausente) e o cpfHash do cliente do X-CPFHash. O ledger se perde ao encerrar.
+//
+//No peer todas as requisicoes rodam como o -usuario informado; o arrependimento so passa quando
+//ele e o proprio cliente do pedido.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/gateway"
+	"github.com/rodneicouto/chaincode/src/peer"
+	"github.com/rodneicouto/chaincode/src/sdk"
+)
+
+func main() {
+	endereco := flag.String("endereco", ":8080", "address the gateway listens on")
+	local := flag.Bool("local", false, "run the chaincode in memory instead of calling a peer")
+	url := flag.String("peer", variavel("PEDIDOS_PEER", "http://localhost:7050"), "REST endpoint of the peer")
+	chaincode := flag.String("chaincode", os.Getenv("PEDIDOS_CHAINCODE"), "chaincode name returned by the deploy")
+	usuario := flag.String("usuario", os.Getenv("PEDIDOS_USUARIO"), "enrollID logged in the peer")
+	atributos := flag.String("atributos", os.Getenv("PEDIDOS_ATRIBUTOS"), "comma separated certificate attributes, e.g. role,chaveCPF")
+	flag.Parse()
+
+	var g *gateway.Gateway
+	if *local {
+		transporte, err := novoLocal()
+		if err != nil {
+			log.Fatal(err)
+		}
+		g = gateway.Novo(sdk.Novo(transporte))
+		g.PapelPorCabecalho = true
+		log.Printf("running the chaincode in memory; set the caller role with the %s header", gateway.CabecalhoPapel)
+	} else {
+		if *chaincode == "" {
+			fmt.Fprintln(os.Stderr, "gateway: -chaincode is required, or use -local")
+			os.Exit(2)
+		}
+		cliente := peer.Novo(*url, *chaincode, *usuario)
+		if *atributos != "" {
+			cliente.Atributos = strings.Split(*atributos, ",")
+		}
+		g = gateway.Novo(sdk.Novo(cliente))
+	}
+	log.Printf("listening on %s, OpenAPI document at /openapi.json", *endereco)
+	log.Fatal(http.ListenAndServe(*endereco, g))
+}
+
+func variavel(nome string, padrao string) string {
+	if valor := os.Getenv(nome); valor != "" {
+		return valor
+	}
+	return padrao
+}
+
+//chaincode em memoria com chaves de CPF aleatorias, validas so enquanto o processo roda
+func novoLocal() (*sdk.Local, error) {
+	atributos := map[string][]byte{"role": []byte(contrato.RoleLoja)}
+	for _, nome := range []string{"chaveCPF", "chaveIndiceCPF"} {
+		chave := make([]byte, 32)
+		_, err := rand.Read(chave)
+		if err != nil {
+			return nil, err
+		}
+		atributos[nome] = []byte(hex.EncodeToString(chave))
+	}
+	return sdk.NovoLocal(atributos), nil
+}
@@ -0,0 +1,83 @@
+//Comando notificador: envia webhooks assinados as lojas a partir dos eventos de pedido do
+//chaincode (ver docs/webhooks.md).
+//
+//	notificador -config lojas.json -chaincode ID [-peer URL] [-estado notificador.json] [-falhas falhas.jsonl] [-desde-inicio]
+//	notificador -config lojas.json -falhas falhas.jsonl -reenviar
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/rodneicouto/chaincode/src/notificacao"
+	"github.com/rodneicouto/chaincode/src/projecao"
+)
+
+func main() {
+	arquivoConfig := flag.String("config", "lojas.json", "webhook URL, secret and events of each loja")
+	url := flag.String("peer", variavel("PEDIDOS_PEER", "http://localhost:7050"), "REST endpoint of the peer")
+	chaincode := flag.String("chaincode", os.Getenv("PEDIDOS_CHAINCODE"), "chaincode name returned by the deploy")
+	estado := flag.String("estado", "notificador.json", "file with the next block to process")
+	falhas := flag.String("falhas", "falhas.jsonl", "dead-letter file of notifications that exhausted the retries")
+	desdeInicio := flag.Bool("desde-inicio", false, "on the first run, notify the events of the whole chain instead of only new ones")
+	reenviar := flag.Bool("reenviar", false, "send the notifications of the dead-letter file again and exit")
+	flag.Parse()
+
+	conteudo, err := ioutil.ReadFile(*arquivoConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var config notificacao.Config
+	err = json.Unmarshal(conteudo, &config)
+	if err != nil {
+		log.Fatal("invalid config " + *arquivoConfig + ": " + err.Error())
+	}
+	n := notificacao.Novo(config, *falhas)
+	n.ArquivoEstado = *estado
+
+	if *reenviar {
+		entregues, pendentes, err := n.Reenviar(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d delivered, %d still failing\n", entregues, pendentes)
+		if pendentes > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *chaincode == "" {
+		fmt.Fprintln(os.Stderr, "notificador: -chaincode is required")
+		os.Exit(2)
+	}
+	fonte := projecao.NovaFonteREST(*url, *chaincode)
+	existe, err := n.CarregarEstado()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !existe && !*desdeInicio {
+		altura, err := fonte.Altura(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = n.DefinirProximoBloco(altura)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("notifying from block %d", n.ProximoBloco())
+	log.Fatal(projecao.NovoOuvinte(fonte, n).Executar(context.Background()))
+}
+
+func variavel(nome string, padrao string) string {
+	if valor := os.Getenv(nome); valor != "" {
+		return valor
+	}
+	return padrao
+}
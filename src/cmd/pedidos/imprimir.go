@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+)
+
+var motivosDevolucao = map[int]string{1: "arrependimento", 2: "defeituoso", 3: "caso fortuito"}
+var opcoesTroca = map[int]string{1: "devolucao do pagamento", 2: "abatimento", 3: "outro produto"}
+
+func formatarData(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).In(fuso).Format("02/01/2006 15:04")
+}
+
+func imprimirPedido(saida io.Writer, p *contrato.Pedido) {
+	w := tabwriter.NewWriter(saida, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Pedido\t%s (versao %d)\n", p.ID, p.Versao)
+	fmt.Fprintf(w, "Itens\t%s\t%s\n", p.ItensId, p.DescricaoItens)
+	fmt.Fprintf(w, "NF-e\t%s\n", p.ChaveNFe)
+	fmt.Fprintf(w, "Venda\t%s\n", formatarData(p.DataVenda))
+	fmt.Fprintf(w, "Prazo de entrega\t%s\n", formatarData(p.DataPrazoEntrega))
+	entrega := formatarData(p.DataEntrega)
+	if p.AtrasoEntrega > 0 {
+		entrega += fmt.Sprintf(" (%s de atraso)", time.Duration(p.AtrasoEntrega)*time.Millisecond)
+	}
+	fmt.Fprintf(w, "Entrega\t%s\n", entrega)
+	if p.Devolucao.Status != "" {
+		fmt.Fprintf(w, "Devolucao\t%s por %s em %s\n", p.Devolucao.Status, motivosDevolucao[p.Devolucao.MotivoDevolucao], formatarData(p.Devolucao.Data))
+	}
+	if p.Troca.Data != 0 {
+		fmt.Fprintf(w, "Troca\t%s por %s em %s\n", opcoesTroca[p.Troca.OpcaoTroca], motivosDevolucao[p.Troca.MotivoTroca], formatarData(p.Troca.Data))
+	}
+	w.Flush()
+}
+
+func imprimirLista(saida io.Writer, pedidos []contrato.Pedido) {
+	w := tabwriter.NewWriter(saida, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tVENDA\tENTREGA\tDEVOLUCAO\tITENS")
+	for _, p := range pedidos {
+		devolucao := p.Devolucao.Status
+		if devolucao == "" {
+			devolucao = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.ID, formatarData(p.DataVenda), formatarData(p.DataEntrega), devolucao, strings.Replace(p.ItensId, ";", ", ", -1))
+	}
+	w.Flush()
+}
+
+func imprimirJSON(saida io.Writer, conteudo []byte) error {
+	var formatado bytes.Buffer
+	err := json.Indent(&formatado, conteudo, "", "  ")
+	if err != nil {
+		return err
+	}
+	formatado.WriteString("\n")
+	_, err = formatado.WriteTo(saida)
+	return err
+}
@@ -0,0 +1,342 @@
+//Comando pedidos: cliente de linha de comando do SaleContractChainCode.
+//
+//	pedidos [-peer URL] [-chaincode ID] [-usuario U] [-atributos a,b] [-chaveCampos HEX] [-json] <comando> ...
+//
+//	registrar <id> <arquivo.json | ->
+//	entrega <id> [-data D] [-vendedor V] [-comprovante H] [-versao N]
+//	arrependimento <id> -nfe CHAVE [-data D] [-vendedor V] [-complemento TEXTO] [-versao N]
+//	obter <id>
+//	recibo <id>
+//	listar [-cpf CPF] [-status S] [-motivo N] [-de D] [-ate D] [-limite N] [-bookmark B]
+//
+//Datas aceitam "agora", timestamp em milissegundos, 2017-09-05 ou RFC 3339. Os padroes
+//de -peer, -chaincode e -usuario vem de PEDIDOS_PEER, PEDIDOS_CHAINCODE e PEDIDOS_USUARIO.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/peer"
+)
+
+//horario de Brasilia para exibir e interpretar datas sem fuso
+var fuso = time.FixedZone("BRT", -3*60*60)
+
+//relogio usado por "agora"; trocado nos testes
+var agora = time.Now
+
+func main() {
+	os.Exit(executar(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type opcoes struct {
+	cliente                *peer.Cliente
+	json                   bool
+	entrada                io.Reader
+	saida                  io.Writer
+}
+
+//devolve o codigo de saida: 0 sucesso, 1 erro da chamada, 2 uso incorreto
+func executar(args []string, entrada io.Reader, saida io.Writer, erros io.Writer) int {
+	globais := flag.NewFlagSet("pedidos", flag.ContinueOnError)
+	globais.SetOutput(erros)
+	url := globais.String("peer", variavel("PEDIDOS_PEER", "http://localhost:7050"), "REST endpoint of the peer")
+	chaincode := globais.String("chaincode", os.Getenv("PEDIDOS_CHAINCODE"), "chaincode name returned by the deploy")
+	usuario := globais.String("usuario", os.Getenv("PEDIDOS_USUARIO"), "enrollID logged in the peer")
+	atributos := globais.String("atributos", os.Getenv("PEDIDOS_ATRIBUTOS"), "comma separated certificate attributes, e.g. role,chaveCPF")
+	chaveCampos := globais.String("chaveCampos", os.Getenv("PEDIDOS_CHAVE_CAMPOS"), "hex AES key of the pedido fields, sent in the call metadata")
+	comoJSON := globais.Bool("json", false, "print raw JSON")
+	if globais.Parse(args) != nil {
+		return 2
+	}
+	if globais.NArg() == 0 {
+		fmt.Fprintln(erros, "usage: pedidos [flags] registrar|entrega|arrependimento|obter|recibo|listar ...")
+		return 2
+	}
+
+	cliente := peer.Novo(*url, *chaincode, *usuario)
+	if *atributos != "" {
+		cliente.Atributos = strings.Split(*atributos, ",")
+	}
+	if *chaveCampos != "" {
+		cliente.Metadados, _ = json.Marshal(contrato.MetadadosChamada{ChaveCampos: *chaveCampos})
+	}
+	o := &opcoes{cliente, *comoJSON, entrada, saida}
+
+	comandos := map[string]func(o *opcoes, args []string, erros io.Writer) error{
+		"registrar":      registrar,
+		"entrega":        entrega,
+		"arrependimento": arrependimento,
+		"obter":          obter,
+		"recibo":         reciboPedido,
+		"listar":         listar,
+	}
+	comando, ok := comandos[globais.Arg(0)]
+	if !ok {
+		fmt.Fprintln(erros, "unknown command "+globais.Arg(0))
+		return 2
+	}
+	err := comando(o, globais.Args()[1:], erros)
+	if err == errUso {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(erros, "error: "+err.Error())
+		return 1
+	}
+	return 0
+}
+
+//erro de uso, ja reportado pelo flag.FlagSet
+var errUso = errors.New("usage")
+
+func variavel(nome string, padrao string) string {
+	if valor := os.Getenv(nome); valor != "" {
+		return valor
+	}
+	return padrao
+}
+
+//aceita flags antes e depois dos argumentos posicionais, que precisam ser exatamente quantidade
+func analisar(fs *flag.FlagSet, args []string, quantidade int, erros io.Writer) ([]string, error) {
+	fs.SetOutput(erros)
+	posicionais := []string{}
+	for {
+		if fs.Parse(args) != nil {
+			return nil, errUso
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		posicionais = append(posicionais, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(posicionais) != quantidade {
+		fmt.Fprintf(erros, "%s: expected %d arguments, got %d\n", fs.Name(), quantidade, len(posicionais))
+		return nil, errUso
+	}
+	return posicionais, nil
+}
+
+//timestamp em milissegundos, como os args do contrato
+func converterData(valor string) (string, error) {
+	if valor == "agora" {
+		return strconv.FormatInt(agora().UnixNano()/int64(time.Millisecond), 10), nil
+	}
+	if _, err := strconv.ParseInt(valor, 10, 64); err == nil {
+		return valor, nil
+	}
+	for _, formato := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		t, err := time.ParseInLocation(formato, valor, fuso)
+		if err == nil {
+			return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), nil
+		}
+	}
+	return "", errors.New("Invalid date " + valor)
+}
+
+//args opcionais posicionais do contrato: os vazios no fim sao removidos
+func semVaziosNoFim(args []string) []string {
+	for len(args) > 0 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+	return args
+}
+
+func comVersao(args []string, versao int64) []string {
+	if versao > 0 {
+		return append(args, "versao="+strconv.FormatInt(versao, 10))
+	}
+	return args
+}
+
+func registrar(o *opcoes, args []string, erros io.Writer) error {
+	fs := flag.NewFlagSet("registrar", flag.ContinueOnError)
+	posicionais, err := analisar(fs, args, 2, erros)
+	if err != nil {
+		return err
+	}
+	var conteudo []byte
+	if posicionais[1] == "-" {
+		conteudo, err = ioutil.ReadAll(o.entrada)
+	} else {
+		conteudo, err = ioutil.ReadFile(posicionais[1])
+	}
+	if err != nil {
+		return err
+	}
+	var valido interface{}
+	if json.Unmarshal(conteudo, &valido) != nil {
+		return errors.New("The pedido file is not valid JSON")
+	}
+	return o.invocar("RegistrarPedido", posicionais[0], string(conteudo))
+}
+
+func entrega(o *opcoes, args []string, erros io.Writer) error {
+	fs := flag.NewFlagSet("entrega", flag.ContinueOnError)
+	data := fs.String("data", "agora", "delivery date")
+	vendedor := fs.String("vendedor", "", "marketplace seller of the sub-order")
+	comprovante := fs.String("comprovante", "", "hash of the proof of delivery")
+	versao := fs.Int64("versao", 0, "expected pedido version")
+	posicionais, err := analisar(fs, args, 1, erros)
+	if err != nil {
+		return err
+	}
+	ts, err := converterData(*data)
+	if err != nil {
+		return err
+	}
+	argsContrato := semVaziosNoFim([]string{posicionais[0], ts, *vendedor, *comprovante})
+	return o.invocar("RegistrarEntrega", comVersao(argsContrato, *versao)...)
+}
+
+func arrependimento(o *opcoes, args []string, erros io.Writer) error {
+	fs := flag.NewFlagSet("arrependimento", flag.ContinueOnError)
+	data := fs.String("data", "agora", "date of the regret")
+	nfe := fs.String("nfe", "", "access key of the return NF-e (44 digits)")
+	vendedor := fs.String("vendedor", "", "marketplace seller of the sub-order")
+	complemento := fs.String("complemento", "", "reason given by the customer")
+	versao := fs.Int64("versao", 0, "expected pedido version")
+	posicionais, err := analisar(fs, args, 1, erros)
+	if err != nil {
+		return err
+	}
+	if *nfe == "" {
+		fmt.Fprintln(erros, "arrependimento: -nfe is required")
+		return errUso
+	}
+	ts, err := converterData(*data)
+	if err != nil {
+		return err
+	}
+	argsContrato := semVaziosNoFim([]string{posicionais[0], ts, *nfe, *vendedor, *complemento})
+	return o.invocar("RegistrarArrependimento", comVersao(argsContrato, *versao)...)
+}
+
+func obter(o *opcoes, args []string, erros io.Writer) error {
+	fs := flag.NewFlagSet("obter", flag.ContinueOnError)
+	posicionais, err := analisar(fs, args, 1, erros)
+	if err != nil {
+		return err
+	}
+	resultado, err := o.cliente.Query(context.Background(), "ObterPedido", posicionais[0])
+	if err != nil {
+		return err
+	}
+	if len(resultado) == 0 {
+		return errors.New("Pedido " + posicionais[0] + " not found")
+	}
+	if o.json {
+		return imprimirJSON(o.saida, resultado)
+	}
+	var p contrato.Pedido
+	err = json.Unmarshal(resultado, &p)
+	if err != nil {
+		return err
+	}
+	imprimirPedido(o.saida, &p)
+	return nil
+}
+
+//imprime o recibo em JSON, para guardar e conferir com o verificar-recibo
+func reciboPedido(o *opcoes, args []string, erros io.Writer) error {
+	fs := flag.NewFlagSet("recibo", flag.ContinueOnError)
+	posicionais, err := analisar(fs, args, 1, erros)
+	if err != nil {
+		return err
+	}
+	resultado, err := o.cliente.Query(context.Background(), "ObterRecibo", posicionais[0])
+	if err != nil {
+		return err
+	}
+	if len(resultado) == 0 {
+		return errors.New("Pedido " + posicionais[0] + " not found")
+	}
+	return imprimirJSON(o.saida, resultado)
+}
+
+func listar(o *opcoes, args []string, erros io.Writer) error {
+	fs := flag.NewFlagSet("listar", flag.ContinueOnError)
+	cpf := fs.String("cpf", "", "CPF of the customer")
+	status := fs.String("status", "", "REGISTRADO, ENTREGUE, EM_DEVOLUCAO, DEVOLVIDO or TROCADO")
+	motivo := fs.Int("motivo", 0, "return reason")
+	de := fs.String("de", "", "sold on or after this date")
+	ate := fs.String("ate", "", "sold on or before this date")
+	limite := fs.Int("limite", 0, "page size")
+	bookmark := fs.String("bookmark", "", "bookmark of the previous page")
+	_, err := analisar(fs, args, 0, erros)
+	if err != nil {
+		return err
+	}
+
+	seletor := map[string]interface{}{}
+	if *cpf != "" {
+		seletor["cpf"] = *cpf
+	}
+	if *status != "" {
+		seletor["status"] = *status
+	}
+	if *motivo != 0 {
+		seletor["motivoDevolucao"] = *motivo
+	}
+	if *de != "" || *ate != "" {
+		intervalo := map[string]int64{}
+		for operador, valor := range map[string]string{"$gte": *de, "$lte": *ate} {
+			if valor == "" {
+				continue
+			}
+			ts, err := converterData(valor)
+			if err != nil {
+				return err
+			}
+			intervalo[operador], _ = strconv.ParseInt(ts, 10, 64)
+		}
+		seletor["dataVenda"] = intervalo
+	}
+	seletorJSON, _ := json.Marshal(seletor)
+	argsContrato := []string{string(seletorJSON), "", *bookmark}
+	if *limite > 0 {
+		argsContrato[1] = strconv.Itoa(*limite)
+	}
+
+	resultado, err := o.cliente.Query(context.Background(), "ConsultarPedidos", semVaziosNoFim(argsContrato)...)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return imprimirJSON(o.saida, resultado)
+	}
+	var pagina struct {
+		Pedidos  []contrato.Pedido `json:"pedidos"`
+		Bookmark string   `json:"bookmark"`
+	}
+	err = json.Unmarshal(resultado, &pagina)
+	if err != nil {
+		return err
+	}
+	imprimirLista(o.saida, pagina.Pedidos)
+	if pagina.Bookmark != "" {
+		fmt.Fprintln(o.saida, "next page: -bookmark '"+pagina.Bookmark+"'")
+	}
+	return nil
+}
+
+func (o *opcoes) invocar(funcao string, args ...string) error {
+	txID, err := o.cliente.Invoke(context.Background(), funcao, args...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(o.saida, "transaction "+txID)
+	return nil
+}
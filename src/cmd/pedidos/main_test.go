@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pedidoTeste = `{"id":"la1","itensId":"234;445","descricaoItens":"Geladeira","versao":3,
+	"dataVenda":1503849607000,"dataPrazoEntrega":1504454407000,"dataEntrega":1504540807000,"atrasoEntrega":86400000,
+	"devolucao":{"motivoDevolucao":1,"data":1504627207000,"status":"SOLICITADA"}}`
+
+type chamada struct {
+	Metodo                 string
+	Funcao                 string
+	Args                   []string
+}
+
+//peer falso que registra as chamadas e responde ObterPedido e ConsultarPedidos
+func peerFalso(chamadas *[]chamada) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				CtorMsg struct {
+					Function string   `json:"function"`
+					Args     []string `json:"args"`
+				} `json:"ctorMsg"`
+			} `json:"params"`
+		}
+		corpo, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(corpo, &req)
+		*chamadas = append(*chamadas, chamada{req.Method, req.Params.CtorMsg.Function, req.Params.CtorMsg.Args})
+
+		mensagem := "tx1"
+		switch req.Params.CtorMsg.Function {
+		case "ObterPedido":
+			if req.Params.CtorMsg.Args[0] != "la1" {
+				mensagem = ""
+			} else {
+				mensagem = pedidoTeste
+			}
+		case "ObterRecibo":
+			mensagem = `{"formato":"pedido-recibo/1","pedidoId":"la1","pedido":{"id":"la1"},"algoritmo":"sha256-json-canonico","hash":"h","txId":"tx9"}`
+		case "ConsultarPedidos":
+			mensagem = `{"pedidos":[` + pedidoTeste + `],"bookmark":"_idx~status~ENTREGUE~la1"}`
+		case "RegistrarArrependimento":
+			w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32003,"message":"Invoke failure","data":"Time of regret exceeded"},"id":1}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "result": map[string]string{"status": "OK", "message": mensagem}, "id": 1})
+	}))
+}
+
+func executarForTest(t *testing.T, servidor *httptest.Server, entrada string, args ...string) (int, string, string) {
+	var saida, erros bytes.Buffer
+	args = append([]string{"-peer", servidor.URL, "-chaincode", "abc"}, args...)
+	codigo := executar(args, strings.NewReader(entrada), &saida, &erros)
+	return codigo, saida.String(), erros.String()
+}
+
+func TestComandosDeInvoke(t *testing.T) {
+	fmt.Println("Entering TestComandosDeInvoke")
+	chamadas := []chamada{}
+	servidor := peerFalso(&chamadas)
+	defer servidor.Close()
+	agora = func() time.Time { return time.Unix(1504000000, 0) }
+
+	codigo, saida, _ := executarForTest(t, servidor, `{"itensId":"234"}`, "registrar", "la1", "-")
+	if codigo != 0 || saida != "transaction tx1\n" {
+		t.Fatalf("Expected registrar to print the transaction, got %d %q", codigo, saida)
+	}
+	if chamadas[0].Metodo != "invoke" || chamadas[0].Funcao != "RegistrarPedido" || chamadas[0].Args[1] != `{"itensId":"234"}` {
+		t.Fatalf("Unexpected call %+v", chamadas[0])
+	}
+
+	executarForTest(t, servidor, "", "entrega", "la1")
+	executarForTest(t, servidor, "", "entrega", "la1", "-data", "2017-09-05", "-comprovante", "abc", "-versao", "2")
+	if strings.Join(chamadas[1].Args, ",") != "la1,1504000000000" {
+		t.Fatalf("Expected delivery now, got %v", chamadas[1].Args)
+	}
+	if strings.Join(chamadas[2].Args, ",") != "la1,1504580400000,,abc,versao=2" {
+		t.Fatalf("Expected positional args of RegistrarEntrega, got %v", chamadas[2].Args)
+	}
+
+	codigo, _, erros := executarForTest(t, servidor, "", "arrependimento", "la1", "-nfe", "3517")
+	if codigo != 1 || !strings.Contains(erros, "Time of regret exceeded") {
+		t.Fatalf("Expected chaincode error to be reported, got %d %q", codigo, erros)
+	}
+	codigo, _, _ = executarForTest(t, servidor, "", "arrependimento", "la1")
+	if codigo != 2 {
+		t.Fatalf("Expected usage error without -nfe")
+	}
+}
+
+func TestComandosDeQuery(t *testing.T) {
+	fmt.Println("Entering TestComandosDeQuery")
+	chamadas := []chamada{}
+	servidor := peerFalso(&chamadas)
+	defer servidor.Close()
+
+	codigo, saida, _ := executarForTest(t, servidor, "", "obter", "la1")
+	if codigo != 0 || !strings.Contains(saida, "la1 (versao 3)") || !strings.Contains(saida, "04/09/2017 13:00 (24h0m0s de atraso)") ||
+		!strings.Contains(saida, "SOLICITADA por arrependimento") {
+		t.Fatalf("Expected pedido to be pretty printed, got %q", saida)
+	}
+	codigo, _, erros := executarForTest(t, servidor, "", "obter", "nao-existe")
+	if codigo != 1 || !strings.Contains(erros, "not found") {
+		t.Fatalf("Expected missing pedido error, got %q", erros)
+	}
+	_, saida, _ = executarForTest(t, servidor, "", "-json", "obter", "la1")
+	if !strings.HasPrefix(saida, "{\n  \"id\": \"la1\"") {
+		t.Fatalf("Expected indented JSON, got %q", saida)
+	}
+
+	codigo, saida, _ = executarForTest(t, servidor, "", "recibo", "la1")
+	if codigo != 0 || !strings.Contains(saida, "\n  \"txId\": \"tx9\"\n") {
+		t.Fatalf("Expected the receipt as indented JSON, got %q", saida)
+	}
+
+	_, saida, _ = executarForTest(t, servidor, "", "listar", "-status", "ENTREGUE", "-de", "2017-08-01", "-limite", "10")
+	ultima := chamadas[len(chamadas)-1]
+	if ultima.Funcao != "ConsultarPedidos" || ultima.Args[0] != `{"dataVenda":{"$gte":1501556400000},"status":"ENTREGUE"}` || ultima.Args[1] != "10" {
+		t.Fatalf("Unexpected selector %v", ultima.Args)
+	}
+	if !strings.Contains(saida, "la1") || !strings.Contains(saida, "-bookmark '_idx~status~ENTREGUE~la1'") {
+		t.Fatalf("Expected table and bookmark, got %q", saida)
+	}
+}
@@ -0,0 +1,50 @@
+//Comando projecao: acompanha os blocos do peer e mantem o modelo de leitura dos pedidos num
+//arquivo local, com consultas HTTP para dashboards (ver docs/projecao.md).
+//
+//	projecao -chaincode ID [-peer URL] [-arquivo projecao.json] [-endereco :8081] [-intervalo 5s]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/rodneicouto/chaincode/src/projecao"
+)
+
+func main() {
+	url := flag.String("peer", variavel("PEDIDOS_PEER", "http://localhost:7050"), "REST endpoint of the peer")
+	chaincode := flag.String("chaincode", os.Getenv("PEDIDOS_CHAINCODE"), "chaincode name returned by the deploy")
+	arquivo := flag.String("arquivo", "projecao.json", "file with the read model and the next block to process")
+	endereco := flag.String("endereco", ":8081", "address of the query API")
+	intervalo := flag.Duration("intervalo", 0, "wait between polls of the chain height (default 5s)")
+	flag.Parse()
+	if *chaincode == "" {
+		fmt.Fprintln(os.Stderr, "projecao: -chaincode is required")
+		os.Exit(2)
+	}
+
+	modelo, err := projecao.Abrir(*arquivo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ouvinte := projecao.NovoOuvinte(projecao.NovaFonteREST(*url, *chaincode), modelo)
+	if *intervalo > 0 {
+		ouvinte.Intervalo = *intervalo
+	}
+	log.Printf("resuming from block %d", modelo.ProximoBloco())
+	go ouvinte.Executar(context.Background())
+
+	log.Printf("queries on %s", *endereco)
+	log.Fatal(http.ListenAndServe(*endereco, projecao.NovoHandler(modelo)))
+}
+
+func variavel(nome string, padrao string) string {
+	if valor := os.Getenv(nome); valor != "" {
+		return valor
+	}
+	return padrao
+}
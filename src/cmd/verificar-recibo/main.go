@@ -0,0 +1,163 @@
+//Comando verificar-recibo: confere um recibo de pedido gerado pela query ObterRecibo (ver
+//docs/recibo.md). Sem rede, confere so se o pedido do recibo bate com o hash; com -peer, busca o
+//recibo atual do pedido no ledger pela query ObterRecibo, compara o hash e a transacao, e confere
+//se a transacao esta na cadeia com o mesmo timestamp.
+//
+//	verificar-recibo [-peer URL -chaincode NOME [-usuario ENROLLID]] <recibo.json | ->
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/peer"
+	"github.com/rodneicouto/chaincode/src/recibo"
+)
+
+func main() {
+	os.Exit(executar(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+//devolve o codigo de saida: 0 recibo valido, 1 recibo invalido ou erro, 2 uso incorreto
+func executar(args []string, entrada io.Reader, saida io.Writer, erros io.Writer) int {
+	fs := flag.NewFlagSet("verificar-recibo", flag.ContinueOnError)
+	fs.SetOutput(erros)
+	url := fs.String("peer", "", "REST endpoint of a peer to check the receipt against the ledger")
+	chaincode := fs.String("chaincode", os.Getenv("PEDIDOS_CHAINCODE"), "chaincode name returned by the deploy, required with -peer")
+	usuario := fs.String("usuario", os.Getenv("PEDIDOS_USUARIO"), "enrollID logged in the peer")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || (*url != "" && *chaincode == "") {
+		fmt.Fprintln(erros, "usage: verificar-recibo [-peer URL -chaincode NOME [-usuario ENROLLID]] <recibo.json | ->")
+		return 2
+	}
+
+	r, err := lerRecibo(fs.Arg(0), entrada)
+	if err == nil {
+		err = recibo.Verificar(r)
+	}
+	if err == nil && *url != "" {
+		cliente := peer.Novo(*url, *chaincode, *usuario)
+		err = conferirLedger(context.Background(), cliente, r)
+		if err == nil && r.TxID != "" {
+			err = conferirTransacao(context.Background(), cliente.HTTP, *url, r)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(erros, "invalid receipt: "+err.Error())
+		return 1
+	}
+
+	fmt.Fprintf(saida, "pedido %s\nhash   %s\n", r.PedidoID, r.Hash)
+	if r.TxID == "" {
+		fmt.Fprintln(saida, "tx     none, pedido written before receipts were recorded")
+	} else {
+		fmt.Fprintf(saida, "tx     %s", r.TxID)
+		if r.Timestamp != 0 {
+			fmt.Fprintf(saida, " at %s", time.Unix(0, r.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintln(saida)
+	}
+	if *url == "" {
+		fmt.Fprintln(saida, "receipt OK, hash only: run with -peer to check it against the ledger")
+	} else if r.TxID == "" {
+		fmt.Fprintln(saida, "receipt OK, matches the current pedido on the ledger")
+	} else {
+		fmt.Fprintln(saida, "receipt OK, matches the current pedido on the ledger, transaction found on the chain")
+	}
+	return 0
+}
+
+func lerRecibo(arquivo string, entrada io.Reader) (*recibo.Recibo, error) {
+	var conteudo []byte
+	var err error
+	if arquivo == "-" {
+		conteudo, err = ioutil.ReadAll(entrada)
+	} else {
+		conteudo, err = ioutil.ReadFile(arquivo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r recibo.Recibo
+	err = json.Unmarshal(conteudo, &r)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid receipt JSON: %s", err)
+	}
+	return &r, nil
+}
+
+//busca o recibo atual do pedido pela query ObterRecibo, montado a partir do registro _escrita_
+//gravado pelo chaincode, e compara o hash e a transacao com os do recibo
+func conferirLedger(ctx context.Context, cliente *peer.Cliente, r *recibo.Recibo) error {
+	payload, err := cliente.Query(ctx, "ObterRecibo", r.PedidoID)
+	if err != nil {
+		return err
+	}
+	if len(payload) == 0 || string(payload) == "null" {
+		return fmt.Errorf("Pedido %s not found on the ledger", r.PedidoID)
+	}
+	var atual recibo.Recibo
+	err = json.Unmarshal(payload, &atual)
+	if err != nil {
+		return fmt.Errorf("Invalid receipt from peer: %s", err)
+	}
+	if atual.TxID != r.TxID {
+		return fmt.Errorf("Pedido %s was last written by transaction %s, receipt says %s: the receipt is outdated or was not issued by the ledger", r.PedidoID, atual.TxID, r.TxID)
+	}
+	if atual.Hash != r.Hash {
+		return fmt.Errorf("Pedido %s has hash %s on the ledger, receipt says %s", r.PedidoID, atual.Hash, r.Hash)
+	}
+	return nil
+}
+
+//busca a transacao no GET /transactions/{txid} do peer e compara o ID e o timestamp
+func conferirTransacao(ctx context.Context, cliente *http.Client, url string, r *recibo.Recibo) error {
+	if r.TxID == "" {
+		return errors.New("Receipt has no transaction to check on the chain")
+	}
+	requisicao, err := http.NewRequest("GET", strings.TrimRight(url, "/")+"/transactions/"+r.TxID, nil)
+	if err != nil {
+		return err
+	}
+	resposta, err := cliente.Do(requisicao.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resposta.Body.Close()
+	if resposta.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("Transaction %s not found on the chain", r.TxID)
+	}
+	if resposta.StatusCode != http.StatusOK {
+		return fmt.Errorf("Peer answered HTTP %d for transaction %s", resposta.StatusCode, r.TxID)
+	}
+	var transacao struct {
+		TxID                   string        `json:"txid"`
+		Timestamp              struct {
+			Seconds                int64         `json:"seconds"`
+			Nanos                  int64         `json:"nanos"`
+		} `json:"timestamp"`
+	}
+	err = json.NewDecoder(resposta.Body).Decode(&transacao)
+	if err != nil {
+		return fmt.Errorf("Invalid transaction from peer: %s", err)
+	}
+	if transacao.TxID != r.TxID {
+		return fmt.Errorf("Peer returned transaction %s for %s", transacao.TxID, r.TxID)
+	}
+	timestamp := transacao.Timestamp.Seconds*1000 + transacao.Timestamp.Nanos/1000000
+	if r.Timestamp != 0 && timestamp != r.Timestamp {
+		return fmt.Errorf("Transaction %s has timestamp %d, receipt says %d", r.TxID, timestamp, r.Timestamp)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rodneicouto/chaincode/src/recibo"
+)
+
+func reciboForTest(t *testing.T) string {
+	r, err := recibo.Novo("la1", []byte(`{"id":"la1","versao":1}`), "tx7", 1504310400123)
+	if err != nil {
+		t.Fatalf("Could not create receipt: %s", err)
+	}
+	conteudo, _ := json.Marshal(r)
+	return string(conteudo)
+}
+
+func executarForTest(entrada string, args ...string) (int, string, string) {
+	var saida, erros bytes.Buffer
+	codigo := executar(args, strings.NewReader(entrada), &saida, &erros)
+	return codigo, saida.String(), erros.String()
+}
+
+func TestVerificarOffline(t *testing.T) {
+	fmt.Println("Entering TestVerificarOffline")
+	codigo, saida, erros := executarForTest(reciboForTest(t), "-")
+	if codigo != 0 || !strings.Contains(saida, "tx     tx7 at 2017-09-02T00:00:00Z") || !strings.Contains(saida, "receipt OK") {
+		t.Fatalf("Expected a valid receipt, got %d %q %q", codigo, saida, erros)
+	}
+	alterado := strings.Replace(reciboForTest(t), `"versao":1`, `"versao":2`, 1)
+	codigo, _, erros = executarForTest(alterado, "-")
+	if codigo != 1 || !strings.Contains(erros, "does not match") {
+		t.Fatalf("Expected a changed receipt to be rejected, got %d %q", codigo, erros)
+	}
+	if codigo, _, _ = executarForTest(""); codigo != 2 {
+		t.Fatalf("Expected usage error without a file")
+	}
+}
+
+//peer falso: o ObterRecibo devolve o recibo em noLedger e o /transactions conhece so a tx7
+func peerForTest(t *testing.T, noLedger *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chaincode":
+			var requisicao struct {
+				Params struct {
+					ChaincodeID struct {
+						Name string `json:"name"`
+					} `json:"chaincodeID"`
+					CtorMsg struct {
+						Function string   `json:"function"`
+						Args     []string `json:"args"`
+					} `json:"ctorMsg"`
+				} `json:"params"`
+			}
+			json.NewDecoder(r.Body).Decode(&requisicao)
+			if requisicao.Params.ChaincodeID.Name != "cc1" || requisicao.Params.CtorMsg.Function != "ObterRecibo" ||
+				len(requisicao.Params.CtorMsg.Args) != 1 || requisicao.Params.CtorMsg.Args[0] != "la1" {
+				t.Fatalf("Unexpected query %+v", requisicao.Params)
+			}
+			resposta, _ := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"result":  map[string]string{"status": "OK", "message": *noLedger},
+				"id":      1,
+			})
+			w.Write(resposta)
+		case "/transactions/tx7":
+			w.Write([]byte(`{"type":2,"txid":"tx7","timestamp":{"seconds":1504310400,"nanos":123000000}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestVerificarNaCadeia(t *testing.T) {
+	fmt.Println("Entering TestVerificarNaCadeia")
+	noLedger := reciboForTest(t)
+	servidor := peerForTest(t, &noLedger)
+	defer servidor.Close()
+
+	codigo, saida, erros := executarForTest(reciboForTest(t), "-peer", servidor.URL, "-chaincode", "cc1", "-")
+	if codigo != 0 || !strings.Contains(saida, "matches the current pedido on the ledger, transaction found on the chain") {
+		t.Fatalf("Expected the receipt to match the ledger, got %d %q %q", codigo, saida, erros)
+	}
+	if codigo, _, _ = executarForTest(reciboForTest(t), "-peer", servidor.URL, "-"); codigo != 2 {
+		t.Fatalf("Expected usage error without the chaincode name")
+	}
+	outroTimestamp := strings.Replace(reciboForTest(t), "1504310400123", "1504310400000", 1)
+	codigo, _, erros = executarForTest(outroTimestamp, "-peer", servidor.URL, "-chaincode", "cc1", "-")
+	if codigo != 1 || !strings.Contains(erros, "timestamp") {
+		t.Fatalf("Expected a timestamp mismatch, got %d %q", codigo, erros)
+	}
+
+	//recibo valido por si so, mas de um pedido que nunca foi gravado assim no ledger
+	inventado, _ := recibo.Novo("la1", []byte(`{"id":"la1","versao":1,"valor":1}`), "tx7", 1504310400123)
+	conteudo, _ := json.Marshal(inventado)
+	codigo, _, erros = executarForTest(string(conteudo), "-peer", servidor.URL, "-chaincode", "cc1", "-")
+	if codigo != 1 || !strings.Contains(erros, "on the ledger") {
+		t.Fatalf("Expected a hash mismatch with the ledger, got %d %q", codigo, erros)
+	}
+
+	//pedido atualizado depois do recibo
+	atualizado, _ := recibo.Novo("la1", []byte(`{"id":"la1","versao":2}`), "tx8", 1504310500000)
+	conteudo, _ = json.Marshal(atualizado)
+	noLedger = string(conteudo)
+	codigo, _, erros = executarForTest(reciboForTest(t), "-peer", servidor.URL, "-chaincode", "cc1", "-")
+	if codigo != 1 || !strings.Contains(erros, "last written by transaction tx8") {
+		t.Fatalf("Expected an outdated receipt, got %d %q", codigo, erros)
+	}
+
+	noLedger = ""
+	codigo, _, erros = executarForTest(reciboForTest(t), "-peer", servidor.URL, "-chaincode", "cc1", "-")
+	if codigo != 1 || !strings.Contains(erros, "not found on the ledger") {
+		t.Fatalf("Expected a missing pedido, got %d %q", codigo, erros)
+	}
+}
@@ -0,0 +1,1157 @@
+package contrato
+
+import (
+	"errors"
+	"fmt"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+	"golang.org/x/text/unicode/norm"
+)
+
+var logger = shim.NewLogger("mylogger")
+
+//chave do indice com os IDs de todos os pedidos registrados
+var pedidoIndexStr = "_pedidoindex"
+
+//prefixo do indice de pedidos pelo hash do CPF do cliente
+var cpfIndexPrefix = "_pedidos_cpf_"
+
+//prefixo das chaves que ligam uma chave de acesso de NF-e ao pedido
+var nfeIndexPrefix = "_nfe_"
+
+//7 dias em milissegundos, padrao quando o Init nao configura outro prazo
+var prazoArrependimento int64 = 604800000
+
+//papeis lidos do atributo "role" do certificado do chamador
+const (
+	RoleCliente    = "cliente"
+	RoleLoja       = "loja"
+	RoleFinanceiro = "financeiro"
+	RoleMediador   = "mediador"
+	RoleAdmin      = "admin"
+	RoleTransportadora = "transportadora"
+)
+
+type Troca struct {
+	// 1 Arrependimento
+	// 2 Defeituoso
+	MotivoTroca            int         `json:"motivoTroca"`
+	// 1 devolucao pagamento
+	// 2 abatimento
+	// 3 por produto
+	OpcaoTroca			   int		 `json:"opcaoTroca"`
+	Data              	   int64         `json:"data"`
+	// chave de acesso da NF-e de devolucao emitida na troca
+	ChaveNFeDevolucao      string        `json:"chaveNFeDevolucao"`
+}
+
+
+type Devolucao struct {
+	// 1 Arrependimento
+	// 2 Defeituoso
+	// 3 Caso Fortuito
+	MotivoDevolucao        int         `json:"motivoDevolucao"`
+	ComplementoMotivoDevolucao   string  `json:"complementoMotivoDevolucao"`
+	Data              	   int64         `json:"data"`
+	// chave de acesso da NF-e de devolucao
+	ChaveNFeDevolucao      string        `json:"chaveNFeDevolucao"`
+	// SOLICITADA, APROVADA, REJEITADA, RECEBIDA ou REEMBOLSADA
+	Status                 string        `json:"status"`
+	Historico              []EtapaDevolucao `json:"historico"`
+	// vendedores que ja concordaram com a proxima etapa da devolucao do pedido inteiro no
+	// marketplace; omitido quando vazio para nao mudar o JSON dos pedidos de um vendedor so
+	Concordancias          []ConcordanciaVendedor `json:"concordancias,omitempty"`
+}
+
+type ItemPedido struct {
+	ID                     string        `json:"id"`
+	Descricao              string        `json:"descricao"`
+	// loja do marketplace responsavel pelo item
+	Vendedor               string        `json:"vendedor"`
+	// usada na regra de pontos de fidelidade
+	Categoria              string        `json:"categoria"`
+}
+
+// parte do pedido atendida por um unico vendedor do marketplace
+type SubPedido struct {
+	Vendedor               string        `json:"vendedor"`
+	ItensId                []string      `json:"itensId"`
+	DataEntrega            int64         `json:"dataEntrega"`
+	AtrasoEntrega          int64         `json:"atrasoEntrega"`
+	ComprovanteEntrega     string        `json:"comprovanteEntrega"`
+	Devolucao              Devolucao     `json:"devolucao"`
+}
+
+type Pedido struct {
+	ID                     string        `json:"id"`
+	// CPF cifrado com a chave do cliente (LGPD), nunca em claro no ledger
+	CPFCliente			   string 		 `json:"cpf"`				
+	// HMAC do CPF, usado nas buscas por CPF
+	CPFHash                string        `json:"cpfHash"`
+	DescricaoItens         string        `json:"descricaoItens"`
+	ItensId                string        `json:"itensId"`
+	// chave de acesso (44 digitos) da NF-e de venda
+	ChaveNFe               string        `json:"chaveNFe"`
+	// itens com o vendedor de cada um (marketplace)
+	Itens                  []ItemPedido  `json:"itens"`
+	// um subpedido por vendedor, montado no RegistrarPedido a partir dos itens
+	SubPedidos             []SubPedido   `json:"subPedidos"`
+	// incrementada a cada atualizacao, para deteccao de conflitos
+	Versao                 int64         `json:"versao"`
+	// formato do JSON gravado, ver decodificarPedido
+	VersaoSchema           int           `json:"versaoSchema"`
+	DataVenda              int64         `json:"dataVenda"`
+	DataEntrega            int64         `json:"dataEntrega"`
+	// prazo de entrega prometido ao cliente
+	DataPrazoEntrega       int64         `json:"dataPrazoEntrega"`
+	// atraso em milissegundos em relacao ao prazo, calculado no RegistrarEntrega
+	AtrasoEntrega          int64         `json:"atrasoEntrega"`
+	// hash do comprovante de entrega informado pela transportadora
+	ComprovanteEntrega     string        `json:"comprovanteEntrega"`
+	Devolucao              Devolucao     `json:"devolucao"`
+	Troca              	   Troca         `json:"troca"`
+}
+
+//CONTRACT
+type SaleContractChainCode struct {
+}
+
+
+func (t *SaleContractChainCode) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("init")
+	return configurar(stub, args)
+}
+ 
+func (t *SaleContractChainCode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+    if function == "ObterPedido" {
+		return ObterPedido(stub, args)
+	}
+	if function == "ResumoPedido" {
+		return ResumoPedido(stub, args)
+	}
+	if function == "SaldoPontos" {
+		return SaldoPontos(stub, args)
+	}
+	if function == "EstatisticasDevolucao" {
+		return EstatisticasDevolucao(stub, args)
+	}
+	if function == "ConsultarPedidos" {
+		return ConsultarPedidos(stub, args)
+	}
+	if function == "ListarPedidosCPF" {
+		return ListarPedidosCPF(stub, args)
+	}
+	if function == "ListarPedidosAtrasados" {
+		return ListarPedidosAtrasados(stub, args)
+	}
+	if function == "ObterPedidoPorNFe" {
+		return ObterPedidoPorNFe(stub, args)
+	}
+	if function == "ObterRecibo" {
+		return ObterRecibo(stub, args)
+	}
+	if function == "ListarSubPedidosVendedor" {
+		return ListarSubPedidosVendedor(stub, args)
+	}
+	if function == "ObterDisputa" {
+		return ObterDisputa(stub, args)
+	}
+	if function == "ListarDisputasPedido" {
+		return ListarDisputasPedido(stub, args)
+	}
+	if function == "ListarDisputasCPF" {
+		return ListarDisputasCPF(stub, args)
+	}
+	if function == "ListarDisputasVencidas" {
+		return ListarDisputasVencidas(stub, args)
+	} else {
+		return nil, erroCodigo(CodigoArgumentoInvalido, " Unknow query method ")
+	} 
+	return nil, nil
+}
+ 
+//executa o invoke, registra a transacao como ultima escrita dos pedidos gravados e emite um
+//evento com eles
+func (t *SaleContractChainCode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	stubEventos := novoStubComEventos(stub)
+	bytes, err := invocar(stubEventos, function, args)
+	if err != nil {
+		return nil, err
+	}
+	err = registrarEscritas(stubEventos)
+	if err != nil {
+		return nil, err
+	}
+	err = stubEventos.emitir(function)
+	if err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+func invocar(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+    if function == "RegistrarPedido" {
+		return RegistrarPedido(stub, args)
+	} 
+	if function == "MigrarPedidos" {
+		return MigrarPedidos(stub, args)
+	}
+	if function == "RegistrarPedidosEmLote" {
+		return RegistrarPedidosEmLote(stub, args)
+	}
+	if function == "RegistrarEntregasEmLote" {
+		return RegistrarEntregasEmLote(stub, args)
+	}
+	if function == "RegistrarEntrega" {
+		return RegistrarEntrega(stub, args)
+	} 
+	if function == "RegistrarArrependimento" {
+		return RegistrarArrependimento(stub, args)
+	}
+	if function == "AprovarDevolucao" {
+		return AprovarDevolucao(stub, args)
+	}
+	if function == "RejeitarDevolucao" {
+		return RejeitarDevolucao(stub, args)
+	}
+	if function == "RegistrarRecebimentoDevolucao" {
+		return RegistrarRecebimentoDevolucao(stub, args)
+	}
+	if function == "RegistrarReembolso" {
+		return RegistrarReembolso(stub, args)
+	}
+	if function == "RegistrarTroca" {
+		return RegistrarTroca(stub, args)
+	}
+	if function == "ResgatarPontos" {
+		return ResgatarPontos(stub, args)
+	}
+	if function == "AbrirDisputa" {
+		return AbrirDisputa(stub, args)
+	}
+	if function == "ResponderDisputa" {
+		return ResponderDisputa(stub, args)
+	}
+	if function == "ResolverDisputa" {
+		return ResolverDisputa(stub, args)
+	} else {
+		return nil, erroCodigo(CodigoArgumentoInvalido, " Unknow invoke method ")
+	} 
+	return nil, nil
+}
+
+//papeis que registram entregas, uma a uma ou pelo manifesto em lote
+var papeisEntrega = []string{RoleTransportadora, RoleLoja, RoleAdmin}
+
+//le um atributo do certificado do chamador. No peer o ReadCertAttribute devolve erro quando o
+//TCert nao tem o atributo; aqui atributo ausente e atributo vazio, como no MockStub
+func lerAtributo(stub shim.ChaincodeStubInterface, nome string) ([]byte, error) {
+	valor, err := stub.ReadCertAttribute(nome)
+	if err != nil && strings.Contains(err.Error(), "doesn't exist") {
+		return nil, nil
+	}
+	return valor, err
+}
+
+//verifica se o atributo "role" do certificado do chamador e um dos papeis permitidos
+func exigirPapel(stub shim.ChaincodeStubInterface, papeis ...string) error {
+	role, err := lerAtributo(stub, "role")
+	if err != nil {
+		logger.Error("Could not read role attribute", err)
+		return err
+	}
+	for _, papel := range papeis {
+		if string(role) == papel {
+			return nil
+		}
+	}
+	logger.Error("Caller role " + string(role) + " not allowed")
+	return erroCodigo(CodigoPapelNaoPermitido, "Caller role not allowed for this operation")
+}
+
+func AtualizarPedido( stub shim.ChaincodeStubInterface, id string, fn func(p *Pedido) error ) ([]byte, error){
+	return AtualizarPedidoVersao(stub, id, 0, fn)
+}
+
+//aplica a funcao de atualizacao sobre uma copia do pedido, sem gravar, para validar antes de escrever
+func simularAtualizacao(stub shim.ChaincodeStubInterface, id string, versaoEsperada int64, fn func(p *Pedido) error) error {
+	_, _, err := prepararAtualizacao(stub, id, versaoEsperada, fn)
+	return err
+}
+
+//atualiza o pedido somente se a versao gravada for a esperada; versao 0 nao verifica
+func AtualizarPedidoVersao( stub shim.ChaincodeStubInterface, id string, versaoEsperada int64, fn func(p *Pedido) error ) ([]byte, error){
+	
+	pe, indicesAntigos, err := prepararAtualizacao(stub, id, versaoEsperada, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := canonico.Marshal(pe)
+	if err != nil {
+		logger.Error("Could not marshal Pedido: update", err)
+		return nil, err
+	}
+	
+	err = stub.PutState(id, bytes)
+	if err != nil {
+		logger.Error("Could not update pedido to ledger", err)
+		return nil, err
+	}
+
+	err = atualizarIndicesConsulta(stub, indicesAntigos, pe)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Successfully updated Pedido");
+
+	return bytes, nil
+
+}
+
+//le o pedido, confere a versao e aplica a funcao de atualizacao com as mesmas verificacoes da
+//gravacao; devolve o pedido pronto para gravar e as chaves de indice que ele tinha antes
+func prepararAtualizacao(stub shim.ChaincodeStubInterface, id string, versaoEsperada int64, fn func(p *Pedido) error) (*Pedido, []string, error) {
+	bytes, err := stub.GetState(id)
+	if err != nil {
+		logger.Error("Could not fetch pedido " + id, err)
+		return nil, nil, err
+	}
+	if bytes == nil {
+		logger.Error("Pedido not found " + id)
+		return nil, nil, erroCodigo(CodigoPedidoNaoEncontrado, "Pedido " + id + " not found")
+	}
+
+	var pe Pedido
+	err = decodificarPedido(bytes, &pe)
+	if err != nil {
+		logger.Error("Invalid format atualizar unmarshal " + string(bytes[:]), err)
+		return nil, nil, errors.New(" Invalid json format ")
+	}
+
+	if versaoEsperada != 0 && pe.Versao != versaoEsperada {
+		logger.Error("Version conflict updating pedido " + id)
+		return nil, nil, erroCodigof(CodigoConflitoVersao, "Version conflict: expected version %d but pedido %s is at version %d", versaoEsperada, id, pe.Versao)
+	}
+
+	//com a chave dos campos a funcao de atualizacao trabalha sobre os valores em claro. Sem a
+	//chave os campos cifrados seguem como estao e os textos novos (justificativas, complementos)
+	//ficam em claro ate a proxima atualizacao com a chave
+	chaveCampos, err := chaveCamposDaChamada(stub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chaveCampos != nil {
+		err = decifrarCampos(&pe, chaveCampos)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	indicesAntigos := chavesIndiceConsulta(&pe)
+
+	err = fn(&pe)
+	if err != nil {
+		logger.Error("validation error in update function ", err)
+		return nil, nil, err
+	}	
+
+	if chaveCampos != nil {
+		err = cifrarCampos(&pe, chaveCampos)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	pe.Versao++
+	return &pe, indicesAntigos, nil
+}
+
+func RegistrarEntrega (stub shim.ChaincodeStubInterface, args []string ) ([]byte, error) {
+	
+	logger.Debug("Entering RegistrarEntrega")
+
+	args, versaoEsperada, err := extrairVersaoEsperada(args)
+	if err != nil {
+		return nil, err
+	}
+	
+	if len(args) < 2 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected atleast two arguments for Registrar Entrega")
+	}
+	err = exigirPapel(stub, papeisEntrega...)
+	if err != nil {
+		return nil, err
+	}
+	var pedidoID = args[0]
+	var dataEntrega = args[1]
+	dataEntregaLong, err := strconv.ParseInt(dataEntrega, 10, 64);
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")	
+	}
+	//vendedor opcional: registra a entrega apenas do subpedido dele
+	var vendedor = ""
+	if len(args) > 2 {
+		vendedor = args[2]
+	}
+	//hash opcional do comprovante de entrega da transportadora
+	var comprovante = ""
+	if len(args) > 3 {
+		comprovante = args[3]
+	}
+
+	vendedorChamador, err := vendedorDoChamador(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	fn := funcaoEntrega(dataEntregaLong, vendedor, vendedorChamador, comprovante)
+
+	return AtualizarPedidoVersao(stub, pedidoID, versaoEsperada, fn)
+}
+
+//funcao de atualizacao que registra a entrega do pedido inteiro ou do subpedido do vendedor.
+//No pedido do marketplace a loja com vendedor no certificado so entrega o proprio subpedido
+func funcaoEntrega(dataEntregaLong int64, vendedorArg string, vendedorChamador string, comprovante string) func(p *Pedido) error {
+	return func(p *Pedido) error {
+		//a data da entrega e a base dos prazos da devolucao e da troca ja registradas
+		if p.Troca.Data != 0 || p.Devolucao.Status != "" {
+			return erroCodigo(CodigoOperacaoNaoPermitida, "Delivery can not change after a return or exchange")
+		}
+		//uma entrega antes da venda zeraria o atraso e abriria prazos de devolucao ja vencidos
+		if dataEntregaLong < p.DataVenda {
+			logger.Error("Delivery date before sale date")
+			return erroCodigo(CodigoArgumentoInvalido, "Delivery date can not be before sale date")
+		}
+		var vendedor = vendedorArg
+		if vendedorChamador != "" && len(p.SubPedidos) > 0 {
+			if vendedor == "" {
+				vendedor = vendedorChamador
+			}
+			if vendedor != vendedorChamador {
+				logger.Error("Vendedor " + vendedorChamador + " can not deliver the sub-order of " + vendedor)
+				return erroCodigo(CodigoPapelNaoPermitido, "Caller vendedor can not deliver the sub-order of another vendedor")
+			}
+		}
+		if vendedor != "" {
+			sub, err := subPedidoDoVendedor(p, vendedor)
+			if err != nil {
+				return err
+			}
+			if sub.Devolucao.Status != "" {
+				return erroCodigo(CodigoOperacaoNaoPermitida, "Delivery can not change after a return or exchange")
+			}
+			sub.DataEntrega = dataEntregaLong
+			sub.AtrasoEntrega = calcularAtraso(p.DataPrazoEntrega, dataEntregaLong)
+			sub.ComprovanteEntrega = comprovante
+		} else {
+			for i := range p.SubPedidos {
+				if p.SubPedidos[i].DataEntrega == 0 {
+					p.SubPedidos[i].DataEntrega = dataEntregaLong
+					p.SubPedidos[i].AtrasoEntrega = calcularAtraso(p.DataPrazoEntrega, dataEntregaLong)
+					p.SubPedidos[i].ComprovanteEntrega = comprovante
+				}
+			}
+			p.ComprovanteEntrega = comprovante
+		}
+
+		//o pedido so fica entregue quando todos os subpedidos forem entregues
+		var ultimaEntrega = dataEntregaLong
+		for _, sub := range p.SubPedidos {
+			if sub.DataEntrega == 0 {
+				return nil
+			}
+			if sub.DataEntrega > ultimaEntrega {
+				ultimaEntrega = sub.DataEntrega
+			}
+		}
+		p.DataEntrega = ultimaEntrega
+		p.AtrasoEntrega = calcularAtraso(p.DataPrazoEntrega, ultimaEntrega)
+		return nil
+	}
+}
+
+//atraso em milissegundos da entrega em relacao ao prazo prometido
+func calcularAtraso(prazo int64, dataEntrega int64) int64 {
+	if prazo != 0 && dataEntrega > prazo {
+		return dataEntrega - prazo
+	}
+	return 0
+}
+
+func RegistrarArrependimento( stub shim.ChaincodeStubInterface, args []string )  ([]byte, error) {
+	
+	logger.Debug("Entering Arrependimento")
+
+	args, versaoEsperada, err := extrairVersaoEsperada(args)
+	if err != nil {
+		return nil, err
+	}
+	
+	if len(args) < 3 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected atleast three arguments for Arrependimento")
+	}
+
+	var pedidoID = args[0]
+	var dataDevolucao = args[1]
+	var chaveNFeDevolucao = args[2]
+	//vendedor opcional: devolve apenas o subpedido dele
+	var vendedor = ""
+	if len(args) > 3 {
+		vendedor = args[3]
+	}
+	var complemento = ""
+	if len(args) > 4 {
+		complemento = args[4]
+	}
+	dataDevolucaoLong, err := strconv.ParseInt(dataDevolucao, 10, 64);
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")	
+	}
+
+	err = exigirPapel(stub, RoleCliente)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validarChaveNFe(chaveNFeDevolucao)
+	if err != nil {
+		logger.Error("Invalid return NF-e key", err)
+		return nil, err
+	}
+
+	configuracao, err := lerConfiguracao(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	var skus []string
+	var cpfHash string
+	var motivo int
+	fn := func(p *Pedido) error {		
+		//so o cliente dono do CPF do pedido se arrepende
+		err := exigirTitular(stub, p.CPFHash)
+		if err != nil {
+			return err
+		}
+		devolucao, err := validarArrependimento(p, vendedor, dataDevolucaoLong, configuracao)
+		if err != nil {
+			return err
+		}
+		err = validarChaveDevolucao(p, chaveNFeDevolucao)
+		if err != nil {
+			return err
+		}
+		//a devolucao fica solicitada ate a loja aprovar ou rejeitar
+		devolucao.MotivoDevolucao = 1;
+		devolucao.ComplementoMotivoDevolucao = complemento
+		devolucao.Data = dataDevolucaoLong;
+		devolucao.ChaveNFeDevolucao = chaveNFeDevolucao
+		devolucao.Status = StatusDevolucaoSolicitada
+		devolucao.Historico = append(devolucao.Historico, EtapaDevolucao{StatusDevolucaoSolicitada, dataDevolucaoLong, RoleCliente, complemento})
+		skus = skusDaDevolucao(p, vendedor)
+		cpfHash = p.CPFHash
+		motivo = devolucao.MotivoDevolucao
+		return nil
+	}
+	err = registrarChaveNFe(stub, chaveNFeDevolucao, pedidoID)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := AtualizarPedidoVersao(stub, pedidoID, versaoEsperada, fn)
+	if err != nil {
+		return nil, err
+	}
+	err = contarDevolucao(stub, dataDevolucaoLong, skus, motivo, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = estornarPontos(stub, cpfHash, pedidoID, skus, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+func RegistrarTroca( stub shim.ChaincodeStubInterface, args []string )  ([]byte, error) {
+
+	logger.Debug("Entering RegistrarTroca")
+
+	args, versaoEsperada, err := extrairVersaoEsperada(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) < 5 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected pedido ID, timestamp, motivo, opcao and NF-e key for RegistrarTroca")
+	}
+
+	var pedidoID = args[0]
+	dataTroca, err := strconv.ParseInt(args[1], 10, 64);
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+	motivoTroca, err := strconv.Atoi(args[2])
+	if err != nil || motivoTroca < 1 || motivoTroca > 2 {
+		logger.Error("Invalid motivo troca " + args[2])
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid motivo troca, expected 1 or 2")
+	}
+	opcaoTroca, err := strconv.Atoi(args[3])
+	if err != nil || opcaoTroca < 1 || opcaoTroca > 3 {
+		logger.Error("Invalid opcao troca " + args[3])
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid opcao troca, expected 1, 2 or 3")
+	}
+	var chaveNFeDevolucao = args[4]
+	err = validarChaveNFe(chaveNFeDevolucao)
+	if err != nil {
+		logger.Error("Invalid return NF-e key", err)
+		return nil, err
+	}
+
+	//a troca e pedida pelo cliente do pedido, como o arrependimento e a disputa
+	err = exigirPapel(stub, RoleCliente)
+	if err != nil {
+		return nil, err
+	}
+
+	configuracao, err := lerConfiguracao(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	var skus []string
+	fn := func(p *Pedido) error {
+		err := exigirTitular(stub, p.CPFHash)
+		if err != nil {
+			return err
+		}
+		err = validarTroca(p, dataTroca)
+		if err != nil {
+			return err
+		}
+		err = validarChaveDevolucao(p, chaveNFeDevolucao)
+		if err != nil {
+			return err
+		}
+		err = validarPrazoTroca(p, motivoTroca, dataTroca, configuracao)
+		if err != nil {
+			return err
+		}
+		p.Troca = Troca{motivoTroca, opcaoTroca, dataTroca, chaveNFeDevolucao}
+		skus = skusDoPedido(p)
+		return nil
+	}
+	err = registrarChaveNFe(stub, chaveNFeDevolucao, pedidoID)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := AtualizarPedidoVersao(stub, pedidoID, versaoEsperada, fn)
+	if err != nil {
+		return nil, err
+	}
+	err = contarTroca(stub, dataTroca, skus, motivoTroca, opcaoTroca)
+	if err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+//situacao do pedido ou do subpedido do vendedor que permite o arrependimento, tambem usada pelo
+//ResumoPedido. Devolve a devolucao que o arrependimento preenche
+func validarArrependimento(p *Pedido, vendedor string, dataDevolucao int64, configuracao *Configuracao) (*Devolucao, error) {
+	devolucao, dataEntrega, err := devolucaoDoPedido(p, vendedor)
+	if err != nil {
+		return nil, err
+	}
+	if dataEntrega == 0 {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Product that was not delivered can not be returned")
+	}
+	if devolucao.Status != "" {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Return already requested for this pedido")
+	}
+	//a devolucao do pedido inteiro e a de um subpedido contariam os mesmos itens duas vezes
+	if temOutraDevolucaoAtiva(p, vendedor) {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Pedido has another return in progress")
+	}
+	//produto trocado nao pode mais ser devolvido por arrependimento
+	if p.Troca.Data != 0 {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Pedido was already exchanged")
+	}
+	if dataDevolucao < dataEntrega {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Return date before delivery")
+	}
+	//se for maior que o prazo configurado (7 dias por padrao) nao deixa se arrepender
+	if dataDevolucao - dataEntrega > configuracao.PrazoArrependimento {
+		return nil, erroCodigo(CodigoPrazoExcedido, "Time of regret exceeded")
+	}
+	return devolucao, nil
+}
+
+//prazo da troca pelo motivo: por arrependimento (1), o do arrependimento; por defeito (2), a
+//garantia de algum item do pedido
+func validarPrazoTroca(p *Pedido, motivoTroca int, dataTroca int64, configuracao *Configuracao) error {
+	if motivoTroca == 1 && dataTroca - p.DataEntrega > configuracao.PrazoArrependimento {
+		return erroCodigo(CodigoPrazoExcedido, "Time of regret exceeded")
+	}
+	if motivoTroca == 2 && !algumItemEmGarantia(p, dataTroca, configuracao) {
+		return erroCodigo(CodigoPrazoExcedido, "Warranty period exceeded")
+	}
+	return nil
+}
+
+//situacao do pedido que permite a troca, tambem exigida na troca decidida em disputa
+func validarTroca(p *Pedido, dataTroca int64) error {
+	if p.DataEntrega == 0 {
+		return erroCodigo(CodigoOperacaoNaoPermitida, "Product that was not delivered can not be exchanged")
+	}
+	if p.Troca.Data != 0 {
+		return erroCodigo(CodigoOperacaoNaoPermitida, "Pedido was already exchanged")
+	}
+	if temDevolucaoAtiva(p) {
+		return erroCodigo(CodigoOperacaoNaoPermitida, "Pedido with a return can not be exchanged")
+	}
+	if dataTroca < p.DataEntrega {
+		return erroCodigo(CodigoOperacaoNaoPermitida, "Exchange date before delivery")
+	}
+	return nil
+}
+
+func RegistrarPedido(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	
+	logger.Debug("Entering RegistrarPedido")
+
+	if len(args) < 2 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected atleast two arguments for loan application creation")
+	}
+
+	var pedidoID = args[0]
+	var pedidoInput = args[1]
+
+	pe, err := prepararPedido(stub, pedidoID, []byte(pedidoInput))
+	if err != nil {
+		return nil, err
+	}
+
+	//TODO validar permissao para criacao de pedido
+
+	//devolve o pedido como foi gravado, com o CPF cifrado, e nao o JSON recebido
+	return gravarPedido(stub, pe)
+}
+
+//valida o JSON de um novo pedido e o prepara para gravacao, sem escrever no ledger
+func prepararPedido(stub shim.ChaincodeStubInterface, pedidoID string, pedidoInput []byte) (*Pedido, error) {
+	var pe Pedido
+	err := json.Unmarshal(pedidoInput, &pe)
+	if err != nil {
+		logger.Error("Invalid format", err)
+		return nil, erroCodigo(CodigoArgumentoInvalido, " Invalid json format ")
+	}
+
+	pe.ID = pedidoID
+	pe.Versao = 1
+	pe.VersaoSchema = versaoSchemaAtual
+
+	//o ID volta no JSON gravado, que e normalizado para NFC; so um ID valido e ja em NFC continua
+	//igual a chave
+	if pedidoID == "" || strings.HasPrefix(pedidoID, "_") || !utf8.ValidString(pedidoID) || !norm.NFC.IsNormalString(pedidoID) {
+		logger.Error("Invalid pedido ID " + pedidoID)
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid pedido ID, it can not be empty, start with _ or have invalid or non NFC UTF-8")
+	}
+	//gravar por cima perderia o historico e zeraria a Versao usada no controle de concorrencia
+	existente, err := stub.GetState(pedidoID)
+	if err != nil {
+		logger.Error("Could not fetch pedido "+pedidoID+" from ledger", err)
+		return nil, err
+	}
+	if len(existente) > 0 {
+		logger.Error("Pedido " + pedidoID + " already exists")
+		return nil, erroCodigo(CodigoPedidoExistente, "Pedido " + pedidoID + " already exists")
+	}
+	//a data de venda entra no indice de consulta, que so ordena datas nao negativas
+	if pe.DataVenda < 0 {
+		logger.Error("Negative sale date")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid sale date (dataVenda), it can not be negative")
+	}
+	if pe.DataPrazoEntrega == 0 {
+		logger.Error("Missing delivery deadline")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing delivery deadline (dataPrazoEntrega)")
+	}
+	if pe.DataPrazoEntrega < pe.DataVenda {
+		logger.Error("Delivery deadline before sale date")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Delivery deadline can not be before sale date")
+	}
+	err = validarChaveNFe(pe.ChaveNFe)
+	if err != nil {
+		logger.Error("Invalid sale NF-e key", err)
+		return nil, err
+	}
+	err = verificarChaveNFe(stub, pe.ChaveNFe, pedidoID)
+	if err != nil {
+		return nil, err
+	}
+	err = montarSubPedidos(&pe)
+	if err != nil {
+		logger.Error("Invalid marketplace items", err)
+		return nil, err
+	}
+	//o cpfHash e sempre calculado pelo chaincode: um valor enviado pelo chamador ligaria o pedido
+	//a outro cliente nos indices, na fidelidade e nas disputas
+	pe.CPFHash = ""
+	for _, campo := range camposCifraveis(&pe) {
+		if estaCifrado(*campo.valor) {
+			logger.Error("Encrypted field in new pedido " + pedidoID)
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid pedido, fields must be sent in clear text and are encrypted by the chaincode")
+		}
+	}
+	err = protegerCPF(stub, &pe)
+	if err != nil {
+		return nil, err
+	}
+	chaveCampos, err := chaveCamposDaChamada(stub)
+	if err != nil {
+		return nil, err
+	}
+	if chaveCampos != nil {
+		err = cifrarCampos(&pe, chaveCampos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &pe, nil
+}
+
+//grava um pedido ja validado por prepararPedido e atualiza os indices
+func gravarPedido(stub shim.ChaincodeStubInterface, pe *Pedido) ([]byte, error) {
+	peBytes, err := canonico.Marshal(pe)
+	if err != nil {
+		logger.Error("Could not marshal Pedido", err)
+		return nil, err
+	}
+
+	err = registrarChaveNFe(stub, pe.ChaveNFe, pe.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	//o prepararPedido ja recusou IDs existentes, entao o pedido e sempre novo
+	err = atualizarIndicesConsulta(stub, []string{}, pe)
+	if err != nil {
+		return nil, err
+	}
+	err = contarPedido(stub, pe)
+	if err != nil {
+		return nil, err
+	}
+	err = acumularPontos(stub, pe)
+	if err != nil {
+		return nil, err
+	}
+
+	if pe.CPFHash != "" {
+		err = adicionarAoIndice(stub, cpfIndexPrefix+pe.CPFHash, pe.ID)
+		if err != nil {
+			logger.Error("Could not update CPF index", err)
+			return nil, err
+		}
+	}
+
+	for _, sub := range pe.SubPedidos {
+		err = adicionarAoIndice(stub, vendedorIndexPrefix+sub.Vendedor, pe.ID)
+		if err != nil {
+			logger.Error("Could not update vendedor index", err)
+			return nil, err
+		}
+	}
+	
+	err = stub.PutState(pe.ID, peBytes)
+	if err != nil {
+		logger.Error("Could not save pedido to ledger", err)
+		return nil, err
+	}
+
+	err = adicionarAoIndice(stub, pedidoIndexStr, pe.ID)
+	if err != nil {
+		logger.Error("Could not update pedido index", err)
+		return nil, err
+	}
+
+	logger.Info("Successfully saved Pedido");
+	return peBytes, nil
+}
+
+//o ultimo argumento dos invokes de atualizacao pode ser "versao=N" com a versao esperada do pedido
+func extrairVersaoEsperada(args []string) ([]string, int64, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[len(args)-1], "versao=") {
+		return args, 0, nil
+	}
+	versao, err := strconv.ParseInt(strings.TrimPrefix(args[len(args)-1], "versao="), 10, 64)
+	if err != nil || versao < 1 {
+		logger.Error("Invalid expected version " + args[len(args)-1])
+		return nil, 0, erroCodigo(CodigoArgumentoInvalido, "Invalid expected version, use versao=N with N >= 1")
+	}
+	return args[:len(args)-1], versao, nil
+}
+
+func ObterPedido(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ObterPedido")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing pedido ID")
+	} 
+
+	var pedidoId = args[0]
+	bytes, err := stub.GetState(pedidoId)
+	if err != nil {
+		logger.Error("Could not fetch loan application with id "+pedidoId+" from ledger", err)
+		return nil, err
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+
+	var pe Pedido
+	err = decodificarPedido(bytes, &pe)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+pedidoId, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	err = restringirAoVendedor(stub, &pe)
+	if err != nil {
+		return nil, err
+	}
+	err = revelarCPF(stub, &pe)
+	if err != nil {
+		return nil, err
+	}
+	chaveCampos, err := chaveCamposDaChamada(stub)
+	if err != nil {
+		return nil, err
+	}
+	if chaveCampos != nil {
+		err = decifrarCampos(&pe, chaveCampos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return canonico.Marshal(&pe)
+}
+
+//lista os pedidos do CPF informado, buscando pelo hash com a chave de indice do chamador
+func ListarPedidosCPF(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ListarPedidosCPF")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing CPF")
+	}
+	cpfHash, err := hashCPFDoChamador(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	ids, err := lerIndice(stub, cpfIndexPrefix+cpfHash)
+	if err != nil {
+		return nil, err
+	}
+
+	pedidos := []Pedido{}
+	for _, id := range ids {
+		bytes, err := ObterPedido(stub, []string{id})
+		//pedido do marketplace de outros vendedores fica fora da lista da loja
+		if err == erroForaDoVendedor {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var pe Pedido
+		err = json.Unmarshal(bytes, &pe)
+		if err != nil {
+			logger.Error("Invalid format for pedido "+id, err)
+			return nil, errors.New(" Invalid json format ")
+		}
+		pedidos = append(pedidos, pe)
+	}
+	return canonico.Marshal(pedidos)
+}
+
+//lista os pedidos com prazo de entrega vencido na data de referencia e ainda nao entregues
+func ListarPedidosAtrasados(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ListarPedidosAtrasados")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected reference timestamp for ListarPedidosAtrasados")
+	}
+
+	dataReferencia, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+
+	ids, err := lerIndice(stub, pedidoIndexStr)
+	if err != nil {
+		return nil, err
+	}
+
+	atrasados := []Pedido{}
+	for _, id := range ids {
+		bytes, err := stub.GetState(id)
+		if err != nil {
+			logger.Error("Could not fetch pedido "+id+" from ledger", err)
+			return nil, err
+		}
+		if bytes == nil {
+			continue
+		}
+		var pe Pedido
+		err = decodificarPedido(bytes, &pe)
+		if err != nil {
+			logger.Error("Invalid format for pedido "+id, err)
+			return nil, errors.New(" Invalid json format ")
+		}
+		//pedido do marketplace de outros vendedores fica fora da lista da loja
+		err = restringirAoVendedor(stub, &pe)
+		if err == erroForaDoVendedor {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pe.DataEntrega == 0 && pe.DataPrazoEntrega != 0 && dataReferencia > pe.DataPrazoEntrega {
+			atrasados = append(atrasados, pe)
+		}
+	}
+
+	return canonico.Marshal(atrasados)
+}
+
+//busca o pedido pela chave de acesso da NF-e de venda ou de devolucao
+func ObterPedidoPorNFe(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ObterPedidoPorNFe")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing NF-e key")
+	}
+
+	pedidoID, err := stub.GetState(nfeIndexPrefix + args[0])
+	if err != nil {
+		logger.Error("Could not fetch NF-e index "+args[0]+" from ledger", err)
+		return nil, err
+	}
+	if pedidoID == nil {
+		return nil, erroCodigo(CodigoPedidoNaoEncontrado, "No pedido found for NF-e key " + args[0])
+	}
+	return ObterPedido(stub, []string{string(pedidoID)})
+}
+
+//valida a chave de acesso da NF-e: 44 digitos com digito verificador modulo 11
+func validarChaveNFe(chave string) error {
+	if len(chave) != 44 {
+		return erroCodigo(CodigoArgumentoInvalido, "Invalid NF-e key, expected 44 digits")
+	}
+	soma := 0
+	peso := 2
+	for i := 42; i >= 0; i-- {
+		if chave[i] < '0' || chave[i] > '9' {
+			return erroCodigo(CodigoArgumentoInvalido, "Invalid NF-e key, expected only digits")
+		}
+		soma += int(chave[i]-'0') * peso
+		peso++
+		if peso > 9 {
+			peso = 2
+		}
+	}
+	dv := 11 - soma%11
+	if dv >= 10 {
+		dv = 0
+	}
+	if chave[43] < '0' || chave[43] > '9' || int(chave[43]-'0') != dv {
+		return erroCodigo(CodigoArgumentoInvalido, "Invalid NF-e key check digit")
+	}
+	return nil
+}
+
+//a mesma nota nao pode ser usada em outro pedido
+func verificarChaveNFe(stub shim.ChaincodeStubInterface, chave string, pedidoID string) error {
+	existente, err := stub.GetState(nfeIndexPrefix + chave)
+	if err != nil {
+		logger.Error("Could not fetch NF-e index "+chave+" from ledger", err)
+		return err
+	}
+	if existente != nil && string(existente) != pedidoID {
+		logger.Error("NF-e key " + chave + " already used by pedido " + string(existente))
+		return erroCodigo(CodigoNFeJaRegistrada, "NF-e key already registered for another pedido")
+	}
+	return nil
+}
+
+//a chave da NF-e de devolucao ou troca nao pode ser a da venda, que ja esta ligada ao mesmo pedido
+func validarChaveDevolucao(p *Pedido, chave string) error {
+	if chave == p.ChaveNFe {
+		logger.Error("Sale NF-e key " + chave + " used as return key of pedido " + p.ID)
+		return erroCodigo(CodigoNFeJaRegistrada, "The sale NF-e key can not be used as the return NF-e key")
+	}
+	return nil
+}
+
+//liga a chave da NF-e ao pedido
+func registrarChaveNFe(stub shim.ChaincodeStubInterface, chave string, pedidoID string) error {
+	err := verificarChaveNFe(stub, chave, pedidoID)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(nfeIndexPrefix+chave, []byte(pedidoID))
+	if err != nil {
+		logger.Error("Could not save NF-e index to ledger", err)
+		return err
+	}
+	return nil
+}
+
+func lerIndice(stub shim.ChaincodeStubInterface, chave string) ([]string, error) {
+	ids := []string{}
+	bytes, err := stub.GetState(chave)
+	if err != nil {
+		logger.Error("Could not fetch index "+chave+" from ledger", err)
+		return nil, err
+	}
+	if bytes == nil {
+		return ids, nil
+	}
+	err = json.Unmarshal(bytes, &ids)
+	if err != nil {
+		logger.Error("Invalid format for index "+chave, err)
+		return nil, errors.New(" Invalid index format ")
+	}
+	return ids, nil
+}
+
+func adicionarAoIndice(stub shim.ChaincodeStubInterface, chave string, id string) error {
+	ids, err := lerIndice(stub, chave)
+	if err != nil {
+		return err
+	}
+	for _, existente := range ids {
+		if existente == id {
+			return nil
+		}
+	}
+	bytes, err := canonico.Marshal(append(ids, id))
+	if err != nil {
+		logger.Error("Could not marshal index "+chave, err)
+		return err
+	}
+	return stub.PutState(chave, bytes)
+}
@@ -0,0 +1,735 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+var pedidoID = "la1"
+var pedidoJson = `{"cpf": "09596397729", "DescricaoItens": "Maquina Lavar Brastemp; Panela Tramontina", "ItensId": "234;445", "dataVenda": 1503849607000, "dataPrazoEntrega": 1504454407000, "chaveNFe": "35170801234567000199550010000012341000123451" }`
+var chaveNFeDevolucao = "35170901234567000199550010000043211000543218"
+
+//atributos com o papel e as chaves de CPF que o backend da loja envia em toda chamada
+func novosAtributos() map[string][]byte {
+	attributes := make(map[string][]byte)
+	attributes["role"] = []byte(RoleLoja)
+	attributes["chaveCPF"] = []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	attributes["chaveIndiceCPF"] = []byte("1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100")
+	return attributes
+}
+
+//simulador com as mesmas chaves de novosAtributos
+func novoSimulador() *simuladortest.Simulador {
+	return simuladortest.Novo(new(SaleContractChainCode), novosAtributos())
+}
+
+//invoca na preparacao do teste e falha o teste se a funcao devolver erro
+func deveInvocar(t *testing.T, stub *shim.MockStub, funcao string, args ...string) []byte {
+	bytes, err := stub.MockInvoke("t123", funcao, args)
+	if err != nil {
+		t.Fatalf("Expected %s%v to succeed: %s", funcao, args, err)
+	}
+	return bytes
+}
+
+func ObterPedidoForTest( t *testing.T, stub shim.ChaincodeStubInterface, id string, p *Pedido){
+	bytes, err := stub.GetState(id)
+	if err != nil {
+		t.Fatalf("Could not fetch pedido with ID " + pedidoID)
+	}
+	err = json.Unmarshal(bytes, &p)
+	if err != nil {
+		t.Fatalf("Could not unmarshal pedido with ID" + pedidoID)
+	}
+}
+
+
+
+func TestCriarChaincode(t *testing.T) {
+	fmt.Println("Entering TestCreateLoanApplication")
+	attributes := novosAtributos()
+	//Create a custom MockStub that internally uses shim.MockStub
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+}
+
+func TestRegistrarPedidoErro(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoErro")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	stub.MockTransactionStart("t123")
+	_, err := RegistrarPedido(stub, []string{})
+	if err == nil {
+		t.Fatalf("Expected RegistrarPedido to return validation error")
+	}
+	stub.MockTransactionEnd("t123")
+}
+
+func TestRegistrarPedidoErroFormato(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoErro")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	stub.MockTransactionStart("t123")
+	_, err := RegistrarPedido(stub, []string{pedidoID, " blabla bla "})
+	if err == nil {
+		t.Fatalf("Expected RegistrarPedido to return validation error")
+	}
+	stub.MockTransactionEnd("t123")
+}
+
+func TestInvokePedidoSucesso(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoSucesso")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	bytes, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido function to be invoked")
+	}
+
+	var pe Pedido
+	bytes, err = stub.GetState(pedidoID)
+	if err != nil {
+		t.Fatalf("Could not fetch pedido with ID " + pedidoID)
+	}
+	err = json.Unmarshal(bytes, &pe)
+	if err != nil {
+		t.Fatalf("Could not unmarshal pedido with ID" + pedidoID)
+	}
+
+	var errors = []string{}
+	var pedidoTestData Pedido
+	err = json.Unmarshal([]byte(pedidoJson), &pedidoTestData)
+
+	if pe.ID != pedidoID {
+		errors = append(errors, "Pedido ID does not match")
+	}
+	if pe.CPFCliente == pedidoTestData.CPFCliente || pe.CPFHash == "" {
+		errors = append(errors, "Pedido CPFCliente stored in clear text")
+	}
+	if pe.DescricaoItens != pedidoTestData.DescricaoItens {
+		errors = append(errors, "Pedido DescricaoItens does not match")
+	}
+
+	//Can be extended for all fields
+	if len(errors) > 0 {
+		t.Fatalf("Mismatch between input and stored Pedido")
+		for j := 0; j < len(errors); j++ {
+			fmt.Println(errors[j])
+		}
+	}
+
+}
+
+func TestUpdatePedidoSucesso(t *testing.T) {
+	fmt.Println("Entering TestUpdatePedidoSucesso")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido function to be invoked")
+	}
+	
+	novoCpf := "444";
+	fn := func(p *Pedido) error {
+		p.CPFCliente = novoCpf;
+		return nil
+	}
+ 	
+ 	stub.MockTransactionStart("t123")
+	AtualizarPedido(stub, pedidoID, fn)
+  	stub.MockTransactionEnd("t123")
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe);	
+	if pe.CPFCliente != novoCpf {
+		t.Fatalf("CPF not updated")
+	}
+}
+
+func TestInvokeValidationError(t *testing.T) {
+	fmt.Println("Entering TestInvokeValidation")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	_, err := stub.MockInvoke("t123", "BlaBlaBla", []string{})
+	if err == nil {
+		t.Fatalf("Expected unknow invoke method")
+	}
+
+}
+
+func TestInvokeValidationSuccess(t *testing.T) {
+	fmt.Println("Entering TestInvokeValidation")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	bytes, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido function to be invoked")
+	}
+
+	var pe Pedido
+	err = json.Unmarshal(bytes, &pe)
+	if err != nil {
+		t.Fatalf("Expected valid Pedido JSOn string to be returned from RegistrarPedido method")
+	}
+
+}
+
+
+func TestQueryErro(t *testing.T) {
+		fmt.Println("Entering TestInvokeValidation")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	_, err := stub.MockQuery("BlaBlaBla", []string{})
+	if err == nil {
+		t.Fatalf("Expected unknow query method")
+	}
+}
+
+
+
+func TestQuerySucesso(t *testing.T) {
+	fmt.Println("Entering TestQueryErro")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido function to be invoked")
+	}
+
+	bytes, err := stub.MockQuery("ObterPedido", []string{pedidoID})
+	if err != nil {
+		t.Fatalf("Expected ObterPedido function to be invoked correctly")
+	}
+
+	var pe Pedido
+	err = json.Unmarshal(bytes, &pe)
+	if err != nil {
+		t.Fatalf("Could not unmarshal pedido with ID" + pedidoID)
+	}
+	if pe.ID != pedidoID {
+		t.Fatalf("Not query successfully: " + pedidoID)
+	}
+}
+
+func TestRegistrarEntregaErro(t * testing.T) {
+	fmt.Println("Entering TestRegistrarEntrega")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+
+	_, err := stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID})
+	if err == nil {
+		t.Fatalf("Expected TestRegistrarEntrega give a error")
+	}
+
+
+}
+
+
+func TestRegistrarEntregaErroData(t * testing.T) {
+	fmt.Println("Entering TestRegistrarEntregaErroData")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+
+	_, err = stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "eeeeeee"})
+	if err == nil {
+		t.Fatalf("Expected TestRegistrarEntrega give a error")
+	}	
+}
+
+func TestRegistrarEntregaErroSucesso(t * testing.T) {
+	fmt.Println("Entering TestRegistrarEntregaErroSucesso")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	if stub == nil {
+		t.Fatalf("MockStub creation failed")
+	}
+	
+	stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+
+	stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1503936007000"})
+	
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe);
+	if pe.DataEntrega != 1503936007000 {
+		t.Fatalf("Data Entrega not updated")
+	}
+}
+
+func TestRegistrarEntregaAntesDaVenda(t *testing.T) {
+	fmt.Println("Entering TestRegistrarEntregaAntesDaVenda")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+
+	_, err := stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "654"})
+	if err == nil || !strings.Contains(err.Error(), CodigoArgumentoInvalido) {
+		t.Fatalf("Expected %s for a delivery before the sale, got %v", CodigoArgumentoInvalido, err)
+	}
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.DataEntrega != 0 {
+		t.Fatalf("Expected no delivery date, got %d", pe.DataEntrega)
+	}
+}
+
+func TestArrependimentoErro(t * testing.T) {
+	fmt.Println("Entering TestRegistrarEntregaErroSucesso")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	_, err := stub.MockInvoke("t123", "Arrependimento", []string{pedidoID})
+
+	if err == nil {
+		t.Fatalf("Expected error in call Arrependimento")
+	}
+}
+
+func TestArrependimentoSemRegistroEntrega(t * testing.T) {
+	fmt.Println("Entering TestArrependimentoErroDataAntes7Dias")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1503849607000", chaveNFeDevolucao})
+	if err == nil {
+		t.Fatalf("Expected not delivery error ")
+	}
+
+}
+
+func TestArrependimentoErroDataDepois7Dias(t * testing.T) {
+	fmt.Println("Entering TestArrependimentoErroDataAntes7Dias")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+
+	stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1503936007000"})
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1503849607000", chaveNFeDevolucao})
+	if err == nil {
+		t.Fatalf("Expected error ")
+	}
+}
+
+func TestArrependimentoSuccess(t * testing.T) {
+	fmt.Println("Entering TestArrependimentoErroDataAntes7Dias")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+
+	stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1503936007000"})
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1503936009000", chaveNFeDevolucao})
+	if err != nil {
+		t.Fatalf("Not expected error ")
+	}
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe);
+	if pe.Devolucao.MotivoDevolucao != 1 {
+		t.Fatalf("Arrependimento not updated")
+	}
+}
+
+func TestRegistrarPedidoSemPrazoEntrega(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoSemPrazoEntrega")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	semPrazo := `{"cpf": "09596397729", "ItensId": "234", "dataVenda": 1503849607000, "chaveNFe": "35170801234567000199550010000012341000123451" }`
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, semPrazo})
+	if err == nil {
+		t.Fatalf("Expected missing delivery deadline error")
+	}
+}
+
+func TestRegistrarEntregaAtrasada(t *testing.T) {
+	fmt.Println("Entering TestRegistrarEntregaAtrasada")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504454417000")
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe);
+	if pe.AtrasoEntrega != 10000 {
+		t.Fatalf("Expected delay of 10000 ms, got %d", pe.AtrasoEntrega)
+	}
+}
+
+func TestListarPedidosAtrasados(t *testing.T) {
+	fmt.Println("Entering TestListarPedidosAtrasados")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", "la1", pedidoJson)
+	deveInvocar(t, stub, "RegistrarPedido", "la2", strings.Replace(pedidoJson, "0123451", "0123460", 1))
+	deveInvocar(t, stub, "RegistrarEntrega", "la2", "1504454407000")
+
+	bytes, err := stub.MockQuery("ListarPedidosAtrasados", []string{"1504454407000"})
+	if err != nil {
+		t.Fatalf("Expected ListarPedidosAtrasados to be invoked correctly")
+	}
+	var atrasados []Pedido
+	json.Unmarshal(bytes, &atrasados)
+	if len(atrasados) != 0 {
+		t.Fatalf("No pedido should be late before the deadline")
+	}
+
+	bytes, err = stub.MockQuery("ListarPedidosAtrasados", []string{"1504454408000"})
+	if err != nil {
+		t.Fatalf("Expected ListarPedidosAtrasados to be invoked correctly")
+	}
+	json.Unmarshal(bytes, &atrasados)
+	if len(atrasados) != 1 || atrasados[0].ID != "la1" {
+		t.Fatalf("Expected only la1 to be late")
+	}
+}
+
+func TestRegistrarPedidoNFeInvalida(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoNFeInvalida")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	nfeInvalida := strings.Replace(pedidoJson, "0123451", "0123452", 1)
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, nfeInvalida})
+	if err == nil {
+		t.Fatalf("Expected invalid NF-e check digit error")
+	}
+}
+
+func TestRegistrarPedidoExistente(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoExistente")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido to be invoked: %s", err)
+	}
+	_, err = stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1504000000000"})
+	if err != nil {
+		t.Fatalf("Expected RegistrarEntrega to be invoked: %s", err)
+	}
+	_, err = stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Expected an existing pedido ID to be rejected, got %v", err)
+	}
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Versao != 2 || pe.DataEntrega != 1504000000000 {
+		t.Fatalf("Expected the pedido to be kept, got versao %d", pe.Versao)
+	}
+}
+
+func TestRegistrarPedidoIDForaDeNFC(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoIDForaDeNFC")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	//o JSON gravado levaria o ID em NFC, diferente da chave
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{"cafe\u0301", pedidoJson})
+	if err == nil || !strings.Contains(err.Error(), "NFC") {
+		t.Fatalf("Expected a pedido ID outside NFC to be rejected, got %v", err)
+	}
+	_, err = stub.MockInvoke("t123", "RegistrarPedido", []string{"caf\u00e9", pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected a pedido ID in NFC to be accepted: %s", err)
+	}
+}
+
+func TestArrependimentoSemNFeDevolucao(t *testing.T) {
+	fmt.Println("Entering TestArrependimentoSemNFeDevolucao")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1503936007000")
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1503936009000"})
+	if err == nil {
+		t.Fatalf("Expected missing return NF-e error")
+	}
+}
+
+func TestObterPedidoPorNFe(t *testing.T) {
+	fmt.Println("Entering TestObterPedidoPorNFe")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1503936007000")
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	deveInvocar(t, stub, "RegistrarTroca", pedidoID, "1503936009000", "2", "3", chaveNFeDevolucao)
+
+	for _, chave := range []string{"35170801234567000199550010000012341000123451", chaveNFeDevolucao} {
+		bytes, err := stub.MockQuery("ObterPedidoPorNFe", []string{chave})
+		if err != nil {
+			t.Fatalf("Expected ObterPedidoPorNFe to find pedido for key %s", chave)
+		}
+		var pe Pedido
+		json.Unmarshal(bytes, &pe)
+		if pe.ID != pedidoID {
+			t.Fatalf("Expected pedido %s for key %s", pedidoID, chave)
+		}
+		if pe.Troca.OpcaoTroca != 3 {
+			t.Fatalf("Troca not updated")
+		}
+	}
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{"la2", pedidoJson})
+	if err == nil {
+		t.Fatalf("Expected NF-e key already used error")
+	}
+}
+
+func TestRegistrarPedidoSemChaveCPF(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoSemChaveCPF")
+	attributes := make(map[string][]byte)
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoJson})
+	if err == nil {
+		t.Fatalf("Expected error registering a CPF without encryption key")
+	}
+}
+
+func TestRegistrarPedidoIgnoraCPFHashDoChamador(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoIgnoraCPFHashDoChamador")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	//cpfHash de outro cliente enviado junto com o CPF
+	comHash := strings.Replace(pedidoJson, "{", `{"cpfHash": "`+cpfHashForTest()+`ff", `, 1)
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, comHash})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido to be invoked: %s", err)
+	}
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.CPFHash != cpfHashForTest() {
+		t.Fatalf("Expected the cpfHash to be computed by the chaincode, got %s", pe.CPFHash)
+	}
+
+	//sem CPF o cpfHash enviado tambem e descartado
+	semCPF := strings.Replace(strings.Replace(pedidoJson, `"cpf": "09596397729"`, `"cpfHash": "`+cpfHashForTest()+`"`, 1), "0123451", "0123460", 1)
+	_, err = stub.MockInvoke("t123", "RegistrarPedido", []string{"la2", semCPF})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido without CPF to be invoked: %s", err)
+	}
+	ObterPedidoForTest(t, stub, "la2", &pe)
+	if pe.CPFHash != "" {
+		t.Fatalf("Expected no cpfHash without a CPF, got %s", pe.CPFHash)
+	}
+}
+
+func TestRegistrarPedidoJaCifrado(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoJaCifrado")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	cifrado := strings.Replace(pedidoJson, `"09596397729"`, `"gcm:AAAA"`, 1)
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, cifrado})
+	if err == nil || !strings.Contains(err.Error(), "clear text") {
+		t.Fatalf("Expected an encrypted CPF to be rejected, got %v", err)
+	}
+	cifrado = strings.Replace(pedidoJson, "Maquina Lavar Brastemp; Panela Tramontina", "gcm:AAAA", 1)
+	_, err = stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, cifrado})
+	if err == nil || !strings.Contains(err.Error(), "clear text") {
+		t.Fatalf("Expected an encrypted description to be rejected, got %v", err)
+	}
+}
+
+func TestObterPedidoDecifraCPF(t *testing.T) {
+	fmt.Println("Entering TestObterPedidoDecifraCPF")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+
+	var pe Pedido
+	bytes, _ := stub.MockQuery("ObterPedido", []string{pedidoID})
+	json.Unmarshal(bytes, &pe)
+	if pe.CPFCliente != "09596397729" {
+		t.Fatalf("Expected CPF to be decrypted with the caller key")
+	}
+
+	//chave descartada: o CPF nao pode mais ser lido
+	delete(attributes, "chaveCPF")
+	bytes, _ = stub.MockQuery("ObterPedido", []string{pedidoID})
+	json.Unmarshal(bytes, &pe)
+	if pe.CPFCliente == "09596397729" {
+		t.Fatalf("Expected CPF to stay encrypted without the key")
+	}
+}
+
+func TestListarPedidosCPF(t *testing.T) {
+	fmt.Println("Entering TestListarPedidosCPF")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+
+	bytes, err := stub.MockQuery("ListarPedidosCPF", []string{"095.963.977-29"})
+	if err != nil {
+		t.Fatalf("Expected ListarPedidosCPF to be invoked correctly")
+	}
+	var pedidos []Pedido
+	json.Unmarshal(bytes, &pedidos)
+	if len(pedidos) != 1 || pedidos[0].ID != pedidoID {
+		t.Fatalf("Expected pedido to be found by CPF")
+	}
+
+	bytes, _ = stub.MockQuery("ListarPedidosCPF", []string{"11111111111"})
+	json.Unmarshal(bytes, &pedidos)
+	if len(pedidos) != 0 {
+		t.Fatalf("Expected no pedido for another CPF")
+	}
+}
+
+func TestAtualizarPedidoVersao(t *testing.T) {
+	fmt.Println("Entering TestAtualizarPedidoVersao")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Versao != 1 {
+		t.Fatalf("Expected new pedido at version 1")
+	}
+
+	_, err := stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1504000000000", "versao=1"})
+	if err != nil {
+		t.Fatalf("Expected update with the stored version: %s", err)
+	}
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Versao != 2 {
+		t.Fatalf("Expected version to be incremented")
+	}
+
+	//um segundo cliente ainda com a versao 1 nao pode sobrescrever
+	_, err = stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1504000009000", "versao=1"})
+	if err == nil {
+		t.Fatalf("Expected version conflict error")
+	}
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.DataEntrega != 1504000000000 {
+		t.Fatalf("Conflicting update should not be written")
+	}
+
+	_, err = stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1504000009000", "versao=x"})
+	if err == nil {
+		t.Fatalf("Expected invalid version error")
+	}
+}
+
+func TestSerializacaoCanonica(t *testing.T) {
+	fmt.Println("Entering TestSerializacaoCanonica")
+	//o mesmo pedido com outra ordem de campos e outros espacos
+	outraForma := `{"chaveNFe":"35170801234567000199550010000012341000123451","dataPrazoEntrega":1504454407000,
+		"dataVenda":1503849607000,"ItensId":"234;445","DescricaoItens":"Maquina Lavar Brastemp; Panela Tramontina","cpf":"09596397729"}`
+	simA := novoSimulador()
+	simB := novoSimulador()
+	retorno := simA.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, pedidoJson)
+	simB.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, outraForma)
+
+	gravado := simA.Stub.State[pedidoID]
+	if string(gravado) != string(simB.Stub.State[pedidoID]) {
+		t.Fatalf("Expected byte identical pedidos:\n%s\n%s", gravado, simB.Stub.State[pedidoID])
+	}
+	//o retorno e o pedido gravado, com o CPF cifrado, e nao o JSON recebido
+	if string(retorno) != string(gravado) || strings.Contains(string(retorno), "09596397729") {
+		t.Fatalf("Expected RegistrarPedido to return the stored pedido, got %s", retorno)
+	}
+	esperado, err := ioutil.ReadFile("testdata/pedido_canonico.json")
+	if err != nil {
+		t.Fatalf("Could not read golden pedido: %s", err)
+	}
+	if string(gravado) != strings.TrimSpace(string(esperado)) {
+		t.Fatalf("Stored pedido changed bytes, compare with testdata/pedido_canonico.json:\n%s", gravado)
+	}
+
+	//atualizacoes e respostas de query tambem saem canonicas
+	simA.DeveInvocar(t, "RegistrarEntrega", pedidoID, "1504000000000")
+	simB.DeveInvocar(t, "RegistrarEntrega", pedidoID, "1504000000000")
+	if string(simA.Stub.State[pedidoID]) != string(simB.Stub.State[pedidoID]) {
+		t.Fatalf("Expected byte identical pedidos after the update")
+	}
+	for _, chave := range []string{pedidoID, escritaPrefix + pedidoID} {
+		canonica, _ := canonico.JSON(simA.Stub.State[chave])
+		if string(canonica) != string(simA.Stub.State[chave]) {
+			t.Fatalf("Expected key %s stored in canonical form, got %s", chave, simA.Stub.State[chave])
+		}
+	}
+	for _, consulta := range [][]string{{"ObterPedido", pedidoID}, {"ResumoPedido", pedidoID, "1504000000000"}, {"ListarPedidosCPF", "09596397729"}} {
+		r := simA.Consultar(consulta[0], consulta[1:]...)
+		canonica, err := canonico.JSON(r.Payload)
+		if r.Err != nil || err != nil || string(canonica) != string(r.Payload) {
+			t.Fatalf("Expected canonical response from %s, got %s %v", consulta[0], r.Payload, r.Err)
+		}
+	}
+}
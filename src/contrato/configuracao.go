@@ -0,0 +1,113 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//chave da configuracao gravada no Init
+var configuracaoChave = "_configuracao"
+
+//90 dias em milissegundos, garantia legal de produtos duraveis (CDC art. 26)
+var prazoGarantia int64 = 7776000000
+
+//prazos em milissegundos; os nao informados usam os padroes prazoArrependimento e prazoGarantia
+type Configuracao struct {
+	PrazoArrependimento    int64         `json:"prazoArrependimento"`
+	PrazoGarantia          int64         `json:"prazoGarantia"`
+	// garantia diferente da padrao por SKU, por exemplo garantia estendida
+	PrazoGarantiaPorItem   map[string]int64 `json:"prazoGarantiaPorItem"`
+	// pontos de fidelidade por item vendido: a regra do SKU, senao a da categoria, senao a padrao
+	PontosPorItem          map[string]int64 `json:"pontosPorItem"`
+	PontosPorCategoria     map[string]int64 `json:"pontosPorCategoria"`
+	PontosPadrao           int64         `json:"pontosPadrao"`
+}
+
+//args[0] opcional: Configuracao em JSON
+func configurar(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var configuracao Configuracao
+	if len(args) > 0 && args[0] != "" {
+		err := json.Unmarshal([]byte(args[0]), &configuracao)
+		if err != nil {
+			logger.Error("Invalid configuracao "+args[0], err)
+			return nil, erroCodigo(CodigoArgumentoInvalido, " Invalid json format ")
+		}
+	}
+	if configuracao.PrazoArrependimento < 0 || configuracao.PrazoGarantia < 0 {
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Configured windows can not be negative")
+	}
+	for sku, prazo := range configuracao.PrazoGarantiaPorItem {
+		if prazo <= 0 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid warranty window for item " + sku)
+		}
+	}
+	if configuracao.PontosPadrao < 0 {
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Loyalty points can not be negative")
+	}
+	for sku, pontos := range configuracao.PontosPorItem {
+		if pontos < 0 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid loyalty points for item " + sku)
+		}
+	}
+	for categoria, pontos := range configuracao.PontosPorCategoria {
+		if pontos < 0 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid loyalty points for category " + categoria)
+		}
+	}
+
+	bytes, err := canonico.Marshal(&configuracao)
+	if err != nil {
+		logger.Error("Could not marshal configuracao", err)
+		return nil, err
+	}
+	err = stub.PutState(configuracaoChave, bytes)
+	if err != nil {
+		logger.Error("Could not save configuracao", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+//configuracao gravada, com os padroes nos prazos nao informados
+func lerConfiguracao(stub shim.ChaincodeStubInterface) (*Configuracao, error) {
+	var configuracao Configuracao
+	bytes, err := stub.GetState(configuracaoChave)
+	if err != nil {
+		logger.Error("Could not fetch configuracao", err)
+		return nil, err
+	}
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &configuracao)
+		if err != nil {
+			logger.Error("Invalid format for configuracao", err)
+			return nil, errors.New(" Invalid json format ")
+		}
+	}
+	if configuracao.PrazoArrependimento == 0 {
+		configuracao.PrazoArrependimento = prazoArrependimento
+	}
+	if configuracao.PrazoGarantia == 0 {
+		configuracao.PrazoGarantia = prazoGarantia
+	}
+	return &configuracao, nil
+}
+
+func garantiaDoItem(c *Configuracao, sku string) int64 {
+	if prazo, ok := c.PrazoGarantiaPorItem[sku]; ok {
+		return prazo
+	}
+	return c.PrazoGarantia
+}
+
+func pontosDoItem(c *Configuracao, item ItemPedido) int64 {
+	if pontos, ok := c.PontosPorItem[item.ID]; ok {
+		return pontos
+	}
+	if pontos, ok := c.PontosPorCategoria[item.Categoria]; ok && item.Categoria != "" {
+		return pontos
+	}
+	return c.PontosPadrao
+}
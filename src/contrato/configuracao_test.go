@@ -0,0 +1,37 @@
+package contrato
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestPrazoArrependimentoConfigurado(t *testing.T) {
+	fmt.Println("Entering TestPrazoArrependimentoConfigurado")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	//30 dias
+	_, err := stub.MockInit("t123", "init", []string{`{"prazoArrependimento":2592000000}`})
+	if err != nil {
+		t.Fatalf("Expected Init to accept the configuracao: %s", err)
+	}
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504000000000")
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err = stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1505000000000", chaveNFeDevolucao})
+	if err != nil {
+		t.Fatalf("Expected regret after 11 days to be accepted with a 30 day window: %s", err)
+	}
+}
+
+func TestConfiguracaoInvalida(t *testing.T) {
+	fmt.Println("Entering TestConfiguracaoInvalida")
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), novosAtributos())
+	_, err := stub.MockInit("t123", "init", []string{`{"prazoGarantiaPorItem":{"445":0}}`})
+	if err == nil {
+		t.Fatalf("Expected Init to reject an empty warranty window")
+	}
+}
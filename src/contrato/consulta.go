@@ -0,0 +1,341 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//indices compostos "_idx~<campo>~<valor>~<pedido ID>" usados pelo ConsultarPedidos.
+//O shim desta versao do fabric nao tem consultas ricas (CouchDB), entao o seletor e
+//resolvido com range queries sobre esses indices, que funcionam no LevelDB
+var indiceConsultaPrefix = "_idx~"
+
+//separador das partes da chave composta; nao pode aparecer nos valores indexados
+var separadorIndice = "~"
+
+var limiteConsultaPadrao = 50
+var limiteConsultaMaximo = 500
+
+//situacao do pedido derivada das datas e da devolucao/troca
+const (
+	StatusPedidoRegistrado  = "REGISTRADO"
+	StatusPedidoEntregue    = "ENTREGUE"
+	StatusPedidoEmDevolucao = "EM_DEVOLUCAO"
+	StatusPedidoDevolvido   = "DEVOLVIDO"
+	StatusPedidoTrocado     = "TROCADO"
+)
+
+//intervalo fechado de datas no formato do seletor do CouchDB
+type Intervalo struct {
+	Gte                    *int64        `json:"$gte"`
+	Lte                    *int64        `json:"$lte"`
+}
+
+//seletor aceito pelo ConsultarPedidos; os campos informados sao combinados com "e"
+type SeletorPedidos struct {
+	Status                 string        `json:"status"`
+	MotivoDevolucao        int           `json:"motivoDevolucao"`
+	CPF                    string        `json:"cpf"`
+	DataVenda              *Intervalo    `json:"dataVenda"`
+	DataEntrega            *Intervalo    `json:"dataEntrega"`
+	DataDevolucao          *Intervalo    `json:"dataDevolucao"`
+}
+
+type PaginaPedidos struct {
+	Pedidos                []Pedido      `json:"pedidos"`
+	// chave a partir da qual a proxima pagina continua; vazio na ultima pagina
+	Bookmark               string        `json:"bookmark"`
+}
+
+//args: seletor JSON, limite opcional e bookmark opcional devolvido pela pagina anterior
+func ConsultarPedidos(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ConsultarPedidos")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected selector JSON for ConsultarPedidos")
+	}
+
+	var seletor SeletorPedidos
+	err := json.Unmarshal([]byte(args[0]), &seletor)
+	if err != nil {
+		logger.Error("Invalid selector", err)
+		return nil, erroCodigo(CodigoArgumentoInvalido, " Invalid selector json format ")
+	}
+	var limite = limiteConsultaPadrao
+	if len(args) > 1 && args[1] != "" {
+		limite, err = strconv.Atoi(args[1])
+		if err != nil || limite < 1 || limite > limiteConsultaMaximo {
+			return nil, erroCodigof(CodigoArgumentoInvalido, "Invalid limit, expected 1 to %d", limiteConsultaMaximo)
+		}
+	}
+	var bookmark = ""
+	if len(args) > 2 {
+		bookmark = args[2]
+	}
+
+	for _, intervalo := range []*Intervalo{seletor.DataVenda, seletor.DataEntrega, seletor.DataDevolucao} {
+		if intervalo != nil && ((intervalo.Gte != nil && *intervalo.Gte < 0) || (intervalo.Lte != nil && *intervalo.Lte < 0)) {
+			logger.Error("Negative date in selector")
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid selector, dates can not be negative")
+		}
+	}
+
+	var cpfHash = ""
+	if seletor.CPF != "" {
+		cpfHash, err = hashCPFDoChamador(stub, seletor.CPF)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inicio, fim := faixaIndice(&seletor, cpfHash)
+	if bookmark != "" {
+		if bookmark < inicio || bookmark > fim {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Bookmark does not belong to this selector")
+		}
+		inicio = bookmark
+	}
+
+	iter, err := stub.RangeQueryState(inicio, fim)
+	if err != nil {
+		logger.Error("Could not query index", err)
+		return nil, err
+	}
+	defer iter.Close()
+
+	pagina := PaginaPedidos{Pedidos: []Pedido{}}
+	var temMais = false
+	for iter.HasNext() {
+		chave, pedidoID, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if chave == bookmark {
+			continue
+		}
+		if len(pagina.Pedidos) == limite {
+			temMais = true
+			break
+		}
+		bytes, err := stub.GetState(string(pedidoID))
+		if err != nil {
+			logger.Error("Could not fetch pedido "+string(pedidoID), err)
+			return nil, err
+		}
+		if bytes == nil {
+			continue
+		}
+		var pe Pedido
+		err = decodificarPedido(bytes, &pe)
+		if err != nil {
+			logger.Error("Invalid format for pedido "+string(pedidoID), err)
+			return nil, errors.New(" Invalid json format ")
+		}
+		//a loja do marketplace ve e filtra so o proprio subpedido
+		err = restringirAoVendedor(stub, &pe)
+		if err == erroForaDoVendedor {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if atendeSeletor(&pe, &seletor, cpfHash) {
+			pagina.Pedidos = append(pagina.Pedidos, pe)
+			pagina.Bookmark = chave
+		}
+	}
+	if !temMais {
+		pagina.Bookmark = ""
+	}
+	return canonico.Marshal(&pagina)
+}
+
+//escolhe o indice mais seletivo para o seletor e devolve a faixa de chaves a percorrer
+func faixaIndice(seletor *SeletorPedidos, cpfHash string) (string, string) {
+	if cpfHash != "" {
+		return faixaPrefixo(chaveIndice("cpf", cpfHash))
+	}
+	if seletor.Status != "" {
+		return faixaPrefixo(chaveIndice("status", seletor.Status))
+	}
+	if seletor.MotivoDevolucao != 0 {
+		return faixaPrefixo(chaveIndice("motivo", strconv.Itoa(seletor.MotivoDevolucao)))
+	}
+	if seletor.DataVenda != nil {
+		inicio, fim := faixaPrefixo(indiceConsultaPrefix + "dataVenda" + separadorIndice)
+		if seletor.DataVenda.Gte != nil {
+			inicio = chaveIndice("dataVenda", dataIndexada(*seletor.DataVenda.Gte))
+		}
+		if seletor.DataVenda.Lte != nil {
+			fim = chaveIndice("dataVenda", dataIndexada(*seletor.DataVenda.Lte)) + "\xff"
+		}
+		return inicio, fim
+	}
+	return faixaPrefixo(indiceConsultaPrefix + "id" + separadorIndice)
+}
+
+func faixaPrefixo(prefixo string) (string, string) {
+	return prefixo, prefixo + "\xff"
+}
+
+func atendeSeletor(p *Pedido, seletor *SeletorPedidos, cpfHash string) bool {
+	if seletor.Status != "" && StatusPedido(p) != seletor.Status {
+		return false
+	}
+	if seletor.MotivoDevolucao != 0 {
+		encontrado := false
+		for _, motivo := range motivosDevolucao(p) {
+			if motivo == seletor.MotivoDevolucao {
+				encontrado = true
+			}
+		}
+		if !encontrado {
+			return false
+		}
+	}
+	if cpfHash != "" && p.CPFHash != cpfHash {
+		return false
+	}
+	return dentroDoIntervalo(p.DataVenda, seletor.DataVenda) &&
+		dentroDoIntervalo(p.DataEntrega, seletor.DataEntrega) &&
+		devolucaoNoIntervalo(p, seletor.DataDevolucao)
+}
+
+//alguma devolucao do pedido ou dos subpedidos foi solicitada dentro do intervalo
+func devolucaoNoIntervalo(p *Pedido, intervalo *Intervalo) bool {
+	if intervalo == nil {
+		return true
+	}
+	for _, d := range devolucoesDoPedido(p) {
+		if d.Data != 0 && dentroDoIntervalo(d.Data, intervalo) {
+			return true
+		}
+	}
+	return false
+}
+
+func dentroDoIntervalo(valor int64, intervalo *Intervalo) bool {
+	if intervalo == nil {
+		return true
+	}
+	if intervalo.Gte != nil && valor < *intervalo.Gte {
+		return false
+	}
+	if intervalo.Lte != nil && valor > *intervalo.Lte {
+		return false
+	}
+	return true
+}
+
+//situacao atual do pedido, usada no indice de status e no seletor. No marketplace o pedido fica
+//EM_DEVOLUCAO enquanto a devolucao de algum subpedido esta em andamento, e so fica DEVOLVIDO
+//quando todos os subpedidos foram reembolsados
+func StatusPedido(p *Pedido) string {
+	if p.Troca.Data != 0 {
+		return StatusPedidoTrocado
+	}
+	for _, d := range devolucoesDoPedido(p) {
+		switch d.Status {
+		case StatusDevolucaoSolicitada, StatusDevolucaoAprovada, StatusDevolucaoRecebida:
+			return StatusPedidoEmDevolucao
+		}
+	}
+	if p.Devolucao.Status == StatusDevolucaoReembolsada {
+		return StatusPedidoDevolvido
+	}
+	if len(p.SubPedidos) > 0 {
+		reembolsados := 0
+		for _, sub := range p.SubPedidos {
+			if sub.Devolucao.Status == StatusDevolucaoReembolsada {
+				reembolsados++
+			}
+		}
+		if reembolsados == len(p.SubPedidos) {
+			return StatusPedidoDevolvido
+		}
+	}
+	if p.DataEntrega != 0 {
+		return StatusPedidoEntregue
+	}
+	return StatusPedidoRegistrado
+}
+
+//devolucao do pedido inteiro seguida das devolucoes dos subpedidos
+func devolucoesDoPedido(p *Pedido) []Devolucao {
+	devolucoes := []Devolucao{p.Devolucao}
+	for _, sub := range p.SubPedidos {
+		devolucoes = append(devolucoes, sub.Devolucao)
+	}
+	return devolucoes
+}
+
+//motivos das devolucoes do pedido e dos subpedidos, sem repeticao
+func motivosDevolucao(p *Pedido) []int {
+	motivos := []int{}
+	vistos := make(map[int]bool)
+	for _, d := range devolucoesDoPedido(p) {
+		if d.MotivoDevolucao != 0 && !vistos[d.MotivoDevolucao] {
+			vistos[d.MotivoDevolucao] = true
+			motivos = append(motivos, d.MotivoDevolucao)
+		}
+	}
+	return motivos
+}
+
+func chaveIndice(campo string, valor string) string {
+	return indiceConsultaPrefix + campo + separadorIndice + valor + separadorIndice
+}
+
+//datas com largura fixa para que a ordem das chaves seja a ordem das datas; so vale para datas
+//nao negativas, garantidas no RegistrarPedido e no seletor
+func dataIndexada(data int64) string {
+	return fmt.Sprintf("%015d", data)
+}
+
+//chaves de indice de consulta que o pedido deve ter no estado atual
+func chavesIndiceConsulta(p *Pedido) []string {
+	chaves := []string{
+		chaveIndice("id", "") + p.ID,
+		chaveIndice("status", StatusPedido(p)) + p.ID,
+		chaveIndice("dataVenda", dataIndexada(p.DataVenda)) + p.ID,
+	}
+	if p.CPFHash != "" {
+		chaves = append(chaves, chaveIndice("cpf", p.CPFHash)+p.ID)
+	}
+	for _, motivo := range motivosDevolucao(p) {
+		chaves = append(chaves, chaveIndice("motivo", strconv.Itoa(motivo))+p.ID)
+	}
+	return chaves
+}
+
+//remove as chaves de indice que deixaram de valer e grava as novas
+func atualizarIndicesConsulta(stub shim.ChaincodeStubInterface, antigas []string, p *Pedido) error {
+	novas := chavesIndiceConsulta(p)
+	validas := make(map[string]bool)
+	for _, chave := range novas {
+		validas[chave] = true
+	}
+	for _, chave := range antigas {
+		if !validas[chave] {
+			err := stub.DelState(chave)
+			if err != nil {
+				logger.Error("Could not delete index key "+chave, err)
+				return err
+			}
+		}
+	}
+	for _, chave := range novas {
+		err := stub.PutState(chave, []byte(p.ID))
+		if err != nil {
+			logger.Error("Could not save index key "+chave, err)
+			return err
+		}
+	}
+	return nil
+}
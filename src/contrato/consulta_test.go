@@ -0,0 +1,125 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func consultarPedidosForTest(t *testing.T, stub *shim.MockStub, args ...string) PaginaPedidos {
+	bytes, err := stub.MockQuery("ConsultarPedidos", args)
+	if err != nil {
+		t.Fatalf("Expected ConsultarPedidos to be invoked correctly: %s", err)
+	}
+	var pagina PaginaPedidos
+	err = json.Unmarshal(bytes, &pagina)
+	if err != nil {
+		t.Fatalf("Could not unmarshal PaginaPedidos")
+	}
+	return pagina
+}
+
+func TestConsultarPedidosPorStatusEMotivo(t *testing.T) {
+	fmt.Println("Entering TestConsultarPedidosPorStatusEMotivo")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+	deveInvocar(t, stub, "RegistrarEntrega", "la1", "1504000000000")
+	deveInvocar(t, stub, "RegistrarEntrega", "la2", "1504000000000")
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	deveInvocar(t, stub, "RegistrarArrependimento", "la2", "1504000001000", chaveNFeDevolucao)
+
+	pagina := consultarPedidosForTest(t, stub, `{"status": "ENTREGUE"}`)
+	if len(pagina.Pedidos) != 1 || pagina.Pedidos[0].ID != "la1" {
+		t.Fatalf("Expected only la1 to be delivered, status index not updated")
+	}
+
+	pagina = consultarPedidosForTest(t, stub, `{"motivoDevolucao": 1, "dataDevolucao": {"$gte": 1504000000000, "$lte": 1504999999999}}`)
+	if len(pagina.Pedidos) != 1 || pagina.Pedidos[0].ID != "la2" {
+		t.Fatalf("Expected la2 to be found by motivo and return date")
+	}
+
+	pagina = consultarPedidosForTest(t, stub, `{"cpf": "09596397729", "status": "EM_DEVOLUCAO"}`)
+	if len(pagina.Pedidos) != 1 || pagina.Pedidos[0].ID != "la2" {
+		t.Fatalf("Expected la2 to be found by CPF and status")
+	}
+
+	pagina = consultarPedidosForTest(t, stub, `{"dataVenda": {"$gte": 1503849607001}}`)
+	if len(pagina.Pedidos) != 0 {
+		t.Fatalf("Expected no pedido sold after the range start")
+	}
+}
+
+func TestConsultarPedidosPaginado(t *testing.T) {
+	fmt.Println("Entering TestConsultarPedidosPaginado")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+
+	pagina := consultarPedidosForTest(t, stub, `{}`, "1")
+	if len(pagina.Pedidos) != 1 || pagina.Pedidos[0].ID != "la1" || pagina.Bookmark == "" {
+		t.Fatalf("Expected first page with la1 and a bookmark")
+	}
+	pagina = consultarPedidosForTest(t, stub, `{}`, "1", pagina.Bookmark)
+	if len(pagina.Pedidos) != 1 || pagina.Pedidos[0].ID != "la2" || pagina.Bookmark != "" {
+		t.Fatalf("Expected last page with la2 and no bookmark")
+	}
+
+	_, err := stub.MockQuery("ConsultarPedidos", []string{`{}`, "0"})
+	if err == nil {
+		t.Fatalf("Expected invalid limit error")
+	}
+}
+
+func TestConsultarPedidosDevolucaoSubPedido(t *testing.T) {
+	fmt.Println("Entering TestConsultarPedidosDevolucaoSubPedido")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	dataDevolucao := sim.Relogio.Agora()
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "lojaB", "Panela amassada")
+
+	var pagina PaginaPedidos
+	sim.ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaB").DeveConsultar(t, &pagina, "ConsultarPedidos", `{"status": "EM_DEVOLUCAO"}`)
+	if len(pagina.Pedidos) != 1 || pagina.Pedidos[0].ID != pedidoID {
+		t.Fatalf("Expected the return of a sub-order to put the pedido in EM_DEVOLUCAO, got %+v", pagina.Pedidos)
+	}
+	if len(pagina.Pedidos[0].SubPedidos) != 1 || pagina.Pedidos[0].SubPedidos[0].Vendedor != "lojaB" {
+		t.Fatalf("Expected lojaB to see only its sub-order, got %+v", pagina.Pedidos[0].SubPedidos)
+	}
+	//a devolucao e do subpedido da lojaB: na visao da lojaA o pedido nao esta em devolucao
+	sim.ComAtributo("vendedor", "lojaA").DeveConsultar(t, &pagina, "ConsultarPedidos", `{"status": "EM_DEVOLUCAO"}`)
+	if len(pagina.Pedidos) != 0 {
+		t.Fatalf("Expected lojaA not to find the pedido by the return of lojaB, got %+v", pagina.Pedidos)
+	}
+	sim.ComAtributo("vendedor", "lojaB")
+	intervalo := fmt.Sprintf(`{"dataDevolucao": {"$gte": %d, "$lte": %d}}`, dataDevolucao, dataDevolucao)
+	sim.DeveConsultar(t, &pagina, "ConsultarPedidos", intervalo)
+	if len(pagina.Pedidos) != 1 {
+		t.Fatalf("Expected the pedido to be found by the sub-order return date")
+	}
+	sim.DeveConsultar(t, &pagina, "ConsultarPedidos", `{"dataDevolucao": {"$lte": 1}}`)
+	if len(pagina.Pedidos) != 0 {
+		t.Fatalf("Expected no pedido returned before the range end")
+	}
+}
+
+func TestConsultarPedidosDataNegativa(t *testing.T) {
+	fmt.Println("Entering TestConsultarPedidosDataNegativa")
+	sim := novoSimulador()
+	sim.PedidoRegistrado(t, pedidoID, pedidoJson)
+
+	r := sim.Consultar("ConsultarPedidos", `{"dataVenda": {"$gte": -1000}}`)
+	if r.Err == nil || !strings.Contains(r.Err.Error(), "negative") {
+		t.Fatalf("Expected a negative date in the selector to be rejected, got %v", r.Err)
+	}
+	negativa := strings.Replace(strings.Replace(pedidoJson, "1503849607000", "-1503849607000", 1), "0123451", "0123460", 1)
+	err := sim.DeveFalhar(t, "RegistrarPedido", "la2", negativa)
+	if !strings.Contains(err.Error(), "negative") {
+		t.Fatalf("Expected a negative sale date to be rejected, got %s", err)
+	}
+}
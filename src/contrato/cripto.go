@@ -0,0 +1,269 @@
+package contrato
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//atributos do certificado com as chaves (em hexadecimal) usadas para os dados pessoais;
+//as chaves nunca sao gravadas no ledger
+var atributoChaveCPF = "chaveCPF"
+var atributoChaveIndiceCPF = "chaveIndiceCPF"
+
+//metadados da chamada (o "metadata" do ChaincodeSpec), lidos pelo GetCallerMetadata. Levam a
+//chave dos campos do pedido, que vale so para a chamada e nao faz parte do certificado
+type MetadadosChamada struct {
+	// chave AES dos campos do pedido, em hexadecimal
+	ChaveCampos            string        `json:"chaveCampos,omitempty"`
+}
+
+//atributo com o cpfHash do cliente, gravado pela loja no certificado de cada cliente; liga o
+//chamador aos proprios dados, ja que a chaveIndiceCPF e a mesma para a loja toda
+var atributoCPFHash = "cpfHash"
+
+//prefixo dos valores cifrados com AES-GCM gravados no ledger
+var prefixoCifrado = "gcm:"
+
+//le uma chave do atributo do certificado do chamador, nil quando o atributo nao foi informado
+func chaveDoAtributo(stub shim.ChaincodeStubInterface, atributo string) ([]byte, error) {
+	valor, err := lerAtributo(stub, atributo)
+	if err != nil {
+		logger.Error("Could not read attribute "+atributo, err)
+		return nil, err
+	}
+	return decodificarChave(string(valor), "attribute " + atributo)
+}
+
+//le a chave dos campos dos metadados da chamada, nil quando a chamada nao traz a chave
+func chaveCamposDaChamada(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	metadados, err := stub.GetCallerMetadata()
+	if err != nil {
+		logger.Error("Could not read caller metadata", err)
+		return nil, err
+	}
+	if len(metadados) == 0 {
+		return nil, nil
+	}
+	var m MetadadosChamada
+	err = json.Unmarshal(metadados, &m)
+	if err != nil {
+		logger.Error("Invalid caller metadata", err)
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid call metadata, expected a JSON object with chaveCampos")
+	}
+	return decodificarChave(m.ChaveCampos, "chaveCampos metadata")
+}
+
+//chave AES em hexadecimal; vazio e nenhuma chave
+func decodificarChave(valor string, origem string) ([]byte, error) {
+	if len(valor) == 0 {
+		return nil, nil
+	}
+	chave, err := hex.DecodeString(valor)
+	if err != nil || (len(chave) != 16 && len(chave) != 24 && len(chave) != 32) {
+		logger.Error("Invalid key in " + origem)
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid key in " + origem + ", expected 16, 24 or 32 hex encoded bytes")
+	}
+	return chave, nil
+}
+
+//cifra com AES-GCM; o nonce e derivado da chave, do contexto e do texto para que
+//todos os peers endossantes gravem exatamente o mesmo valor
+func cifrar(chave []byte, contexto string, texto string) (string, error) {
+	block, err := aes.NewCipher(chave)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, chave)
+	mac.Write([]byte(contexto + "|" + texto))
+	nonce := mac.Sum(nil)[:gcm.NonceSize()]
+	cifrado := gcm.Seal(nonce, nonce, []byte(texto), []byte(contexto))
+	return prefixoCifrado + base64.StdEncoding.EncodeToString(cifrado), nil
+}
+
+func decifrar(chave []byte, contexto string, valor string) (string, error) {
+	if !estaCifrado(valor) {
+		return valor, nil
+	}
+	cifrado, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(valor, prefixoCifrado))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(chave)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(cifrado) < gcm.NonceSize() {
+		return "", errors.New("Invalid encrypted value")
+	}
+	texto, err := gcm.Open(nil, cifrado[:gcm.NonceSize()], cifrado[gcm.NonceSize():], []byte(contexto))
+	if err != nil {
+		return "", err
+	}
+	return string(texto), nil
+}
+
+func estaCifrado(valor string) bool {
+	return strings.HasPrefix(valor, prefixoCifrado)
+}
+
+//hash com chave (HMAC-SHA256) do CPF, usado nos indices para busca sem guardar o CPF
+func hashCPF(chave []byte, cpf string) string {
+	mac := hmac.New(sha256.New, chave)
+	mac.Write([]byte(normalizarCPF(cpf)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func normalizarCPF(cpf string) string {
+	return strings.NewReplacer(".", "", "-", "", " ", "").Replace(cpf)
+}
+
+//calcula o hash do CPF informado com a chave de indice do chamador
+func hashCPFDoChamador(stub shim.ChaincodeStubInterface, cpf string) (string, error) {
+	chaveIndice, err := chaveDoAtributo(stub, atributoChaveIndiceCPF)
+	if err != nil {
+		return "", err
+	}
+	if chaveIndice == nil {
+		logger.Error("Missing CPF index key")
+		return "", erroCodigo(CodigoArgumentoInvalido, "Missing " + atributoChaveIndiceCPF + " attribute to look up by CPF")
+	}
+	return hashCPF(chaveIndice, cpf), nil
+}
+
+//verifica se o chamador e o cliente dono do cpfHash
+func exigirTitular(stub shim.ChaincodeStubInterface, cpfHash string) error {
+	titular, err := lerAtributo(stub, atributoCPFHash)
+	if err != nil {
+		logger.Error("Could not read attribute "+atributoCPFHash, err)
+		return err
+	}
+	if len(titular) == 0 || cpfHash == "" || string(titular) != cpfHash {
+		logger.Error("Caller is not the customer " + cpfHash)
+		return erroCodigo(CodigoPapelNaoPermitido, "Caller is not the customer of this CPF")
+	}
+	return nil
+}
+
+//troca o CPF em claro do pedido pelo CPF cifrado e pelo hash usado nos indices
+func protegerCPF(stub shim.ChaincodeStubInterface, p *Pedido) error {
+	if p.CPFCliente == "" {
+		return nil
+	}
+	if estaCifrado(p.CPFCliente) {
+		logger.Error("CPF already encrypted in pedido " + p.ID)
+		return erroCodigo(CodigoArgumentoInvalido, "Invalid CPF, it must be sent in clear text and is encrypted by the chaincode")
+	}
+	chave, err := chaveDoAtributo(stub, atributoChaveCPF)
+	if err != nil {
+		return err
+	}
+	if chave == nil {
+		logger.Error("Missing CPF encryption key")
+		return erroCodigo(CodigoArgumentoInvalido, "Missing " + atributoChaveCPF + " attribute, CPF can not be stored in clear text")
+	}
+	p.CPFHash, err = hashCPFDoChamador(stub, p.CPFCliente)
+	if err != nil {
+		return err
+	}
+	p.CPFCliente, err = cifrar(chave, "cpf|"+p.ID, normalizarCPF(p.CPFCliente))
+	if err != nil {
+		logger.Error("Could not encrypt CPF", err)
+		return err
+	}
+	return nil
+}
+
+//decifra o CPF quando o chamador informa a chave; sem a chave (ou se ela foi descartada) o CPF segue cifrado
+func revelarCPF(stub shim.ChaincodeStubInterface, p *Pedido) error {
+	if !estaCifrado(p.CPFCliente) {
+		return nil
+	}
+	chave, err := chaveDoAtributo(stub, atributoChaveCPF)
+	if err != nil || chave == nil {
+		return err
+	}
+	cpf, err := decifrar(chave, "cpf|"+p.ID, p.CPFCliente)
+	if err != nil {
+		logger.Warning("Could not decrypt CPF of pedido " + p.ID)
+		return nil
+	}
+	p.CPFCliente = cpf
+	return nil
+}
+
+//campo do pedido que pode ser cifrado, com o contexto que amarra o valor ao pedido e ao campo
+type campoCifravel struct {
+	contexto string
+	valor    *string
+}
+
+//campos que revelam o que o cliente comprou e por que devolveu. O complemento do arrependimento
+//tambem e copiado na justificativa da primeira etapa do historico, entao o historico entra junto
+func camposCifraveis(p *Pedido) []campoCifravel {
+	campos := []campoCifravel{
+		{"descricaoItens|" + p.ID, &p.DescricaoItens},
+	}
+	campos = append(campos, camposDaDevolucao(&p.Devolucao, p.ID)...)
+	for i := range p.Itens {
+		campos = append(campos, campoCifravel{"item|" + p.ID + "|" + p.Itens[i].ID, &p.Itens[i].Descricao})
+	}
+	for i := range p.SubPedidos {
+		campos = append(campos, camposDaDevolucao(&p.SubPedidos[i].Devolucao, p.ID+"|"+p.SubPedidos[i].Vendedor)...)
+	}
+	return campos
+}
+
+func camposDaDevolucao(d *Devolucao, contexto string) []campoCifravel {
+	campos := []campoCifravel{
+		{"complementoMotivoDevolucao|" + contexto, &d.ComplementoMotivoDevolucao},
+	}
+	for i := range d.Historico {
+		campos = append(campos, campoCifravel{"historico|" + contexto + "|" + strconv.Itoa(i), &d.Historico[i].Justificativa})
+	}
+	return campos
+}
+
+func cifrarCampos(p *Pedido, chave []byte) error {
+	for _, campo := range camposCifraveis(p) {
+		if *campo.valor == "" || estaCifrado(*campo.valor) {
+			continue
+		}
+		cifrado, err := cifrar(chave, campo.contexto, *campo.valor)
+		if err != nil {
+			logger.Error("Could not encrypt field "+campo.contexto, err)
+			return err
+		}
+		*campo.valor = cifrado
+	}
+	return nil
+}
+
+func decifrarCampos(p *Pedido, chave []byte) error {
+	for _, campo := range camposCifraveis(p) {
+		texto, err := decifrar(chave, campo.contexto, *campo.valor)
+		if err != nil {
+			logger.Error("Could not decrypt field "+campo.contexto, err)
+			return erroCodigo(CodigoArgumentoInvalido, "Could not decrypt pedido fields, check the chaveCampos metadata")
+		}
+		*campo.valor = texto
+	}
+	return nil
+}
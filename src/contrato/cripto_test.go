@@ -0,0 +1,164 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var chaveCamposTeste = "202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f"
+
+//metadados da chamada com a chave dos campos
+var metadadosChaveCampos = `{"chaveCampos": "` + chaveCamposTeste + `"}`
+
+//stub que le os atributos como o peer: erro quando o TCert nao tem o atributo
+type stubTCert struct {
+	*shim.MockStub
+	atributos              map[string][]byte
+}
+
+func (s *stubTCert) ReadCertAttribute(nome string) ([]byte, error) {
+	valor, ok := s.atributos[nome]
+	if !ok {
+		return nil, errors.New("Failed attribute '" + nome + "' doesn't exists in the TCert.")
+	}
+	return valor, nil
+}
+
+func TestCifrarDecifrar(t *testing.T) {
+	fmt.Println("Entering TestCifrarDecifrar")
+	chave := []byte("0123456789abcdef0123456789abcdef")
+
+	cifrado, err := cifrar(chave, "contexto", "Panela Tramontina")
+	if err != nil || !estaCifrado(cifrado) {
+		t.Fatalf("Expected value to be encrypted")
+	}
+	outro, _ := cifrar(chave, "contexto", "Panela Tramontina")
+	if outro != cifrado {
+		t.Fatalf("Expected deterministic encryption for endorsing peers")
+	}
+	texto, err := decifrar(chave, "contexto", cifrado)
+	if err != nil || texto != "Panela Tramontina" {
+		t.Fatalf("Expected value to be decrypted")
+	}
+	_, err = decifrar(chave, "outro contexto", cifrado)
+	if err == nil {
+		t.Fatalf("Expected error decrypting with another context")
+	}
+}
+
+func TestCamposCifradosNoLedger(t *testing.T) {
+	fmt.Println("Entering TestCamposCifradosNoLedger")
+	sim := novoSimulador()
+	sim.ComMetadados(metadadosChaveCampos)
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+
+	var pe Pedido
+	sim.Estado(t, pedidoID, &pe)
+	if !estaCifrado(pe.DescricaoItens) {
+		t.Fatalf("Expected fields to be encrypted in the ledger")
+	}
+
+	//o cliente nao tem a chave da loja e ainda assim registra o arrependimento
+	sim.ComMetadados("").ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "", "Nao gostei da cor")
+	sim.Estado(t, pedidoID, &pe)
+	if !estaCifrado(pe.DescricaoItens) || pe.Devolucao.ComplementoMotivoDevolucao != "Nao gostei da cor" {
+		t.Fatalf("Expected encrypted fields kept and the new complement in clear text, got %+v", pe)
+	}
+
+	//a proxima atualizacao com a chave cifra os textos novos
+	sim.ComMetadados(metadadosChaveCampos).ComoPapel(RoleLoja)
+	sim.DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "Produto lacrado")
+	sim.Estado(t, pedidoID, &pe)
+	if !estaCifrado(pe.Devolucao.ComplementoMotivoDevolucao) || !estaCifrado(pe.Devolucao.Historico[1].Justificativa) {
+		t.Fatalf("Expected the return texts to be encrypted by the update with the key")
+	}
+
+	sim.DeveConsultar(t, &pe, "ObterPedido", pedidoID)
+	if pe.DescricaoItens != "Maquina Lavar Brastemp; Panela Tramontina" || pe.Devolucao.ComplementoMotivoDevolucao != "Nao gostei da cor" {
+		t.Fatalf("Expected fields to be decrypted with the caller key")
+	}
+
+	sim.ComMetadados("").DeveConsultar(t, &pe, "ObterPedido", pedidoID)
+	if !estaCifrado(pe.DescricaoItens) {
+		t.Fatalf("Expected fields to stay encrypted without the key")
+	}
+
+	err := sim.ComMetadados(`{"chaveCampos": "abc"}`).DeveFalhar(t, "RegistrarEntrega", pedidoID, sim.Relogio.Texto())
+	if !strings.Contains(err.Error(), CodigoArgumentoInvalido) {
+		t.Fatalf("Expected an invalid key in the metadata to be rejected, got %s", err)
+	}
+}
+
+func TestHistoricoCifradoNoLedger(t *testing.T) {
+	fmt.Println("Entering TestHistoricoCifradoNoLedger")
+	sim := novoSimulador()
+	sim.ComMetadados(metadadosChaveCampos)
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "lojaB", "Panela amassada")
+
+	var pe Pedido
+	sim.Estado(t, pedidoID, &pe)
+	if !estaCifrado(pe.SubPedidos[1].Devolucao.Historico[0].Justificativa) {
+		t.Fatalf("Expected the sub-order return history to be encrypted in the ledger")
+	}
+	sim.DeveConsultar(t, &pe, "ObterPedido", pedidoID)
+	if pe.SubPedidos[1].Devolucao.Historico[0].Justificativa != "Panela amassada" {
+		t.Fatalf("Expected the history to be decrypted with the caller key")
+	}
+
+	//sem a chave a etapa nova fica em claro e as cifradas seguem como estavam
+	sim.ComMetadados("").ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaB")
+	sim.DeveInvocar(t, "RejeitarDevolucao", pedidoID, sim.Relogio.Texto(), "Panela usada", "lojaB")
+	sim.Estado(t, pedidoID, &pe)
+	historico := pe.SubPedidos[1].Devolucao.Historico
+	if !estaCifrado(historico[0].Justificativa) || historico[1].Justificativa != "Panela usada" {
+		t.Fatalf("Expected only the new step in clear text, got %+v", historico)
+	}
+	sim.ComMetadados(metadadosChaveCampos).ComoPapel(RoleAdmin).DeveConsultar(t, &pe, "ObterPedido", pedidoID)
+	historico = pe.SubPedidos[1].Devolucao.Historico
+	if historico[0].Justificativa != "Panela amassada" || historico[1].Justificativa != "Panela usada" {
+		t.Fatalf("Expected encrypted and clear steps to be read with the key, got %+v", historico)
+	}
+}
+
+func TestAtributosAusentesNoTCert(t *testing.T) {
+	fmt.Println("Entering TestAtributosAusentesNoTCert")
+	attributes := novosAtributos()
+	stub := &stubTCert{shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes), attributes}
+
+	//sem chaveCampos o pedido e gravado sem cifrar os campos
+	stub.MockTransactionStart("t123")
+	_, err := RegistrarPedido(stub, []string{pedidoID, pedidoJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido without the chaveCampos attribute: %s", err)
+	}
+	_, err = RegistrarEntrega(stub, []string{pedidoID, "1504000000000"})
+	if err != nil {
+		t.Fatalf("Expected RegistrarEntrega without the chaveCampos attribute: %s", err)
+	}
+	stub.MockTransactionEnd("t123")
+
+	//sem vendedor a loja ve o pedido todo, como no MockStub
+	bytes, err := ObterPedido(stub, []string{pedidoID})
+	if err != nil {
+		t.Fatalf("Expected ObterPedido without the vendedor attribute: %s", err)
+	}
+	var pe Pedido
+	json.Unmarshal(bytes, &pe)
+	if pe.DescricaoItens != "Maquina Lavar Brastemp; Panela Tramontina" || pe.DataEntrega != 1504000000000 {
+		t.Fatalf("Expected the pedido in clear text, got %+v", pe)
+	}
+
+	delete(attributes, "role")
+	_, err = RegistrarEntrega(stub, []string{pedidoID, "1504000000000"})
+	if err == nil || !strings.Contains(err.Error(), CodigoPapelNaoPermitido) {
+		t.Fatalf("Expected a caller without role to be denied, got %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package contrato
+
+import (
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//etapas do fluxo de devolucao: solicitada -> aprovada/rejeitada -> recebida -> reembolsada
+const (
+	StatusDevolucaoSolicitada   = "SOLICITADA"
+	StatusDevolucaoAprovada     = "APROVADA"
+	StatusDevolucaoRejeitada    = "REJEITADA"
+	StatusDevolucaoRecebida     = "RECEBIDA"
+	StatusDevolucaoReembolsada  = "REEMBOLSADA"
+)
+
+//registro de cada etapa da devolucao, com quem executou e por que
+type EtapaDevolucao struct {
+	Status                 string        `json:"status"`
+	Data                   int64         `json:"data"`
+	Papel                  string        `json:"papel"`
+	Justificativa          string        `json:"justificativa"`
+}
+
+//concordancia de um vendedor com a proxima etapa da devolucao do pedido inteiro
+type ConcordanciaVendedor struct {
+	Vendedor               string        `json:"vendedor"`
+	Status                 string        `json:"status"`
+	Data                   int64         `json:"data"`
+}
+
+//args: pedido ID, timestamp, justificativa e vendedor opcional
+func AprovarDevolucao(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering AprovarDevolucao")
+	return avancarDevolucao(stub, args, RoleLoja, StatusDevolucaoSolicitada, StatusDevolucaoAprovada)
+}
+
+//args: pedido ID, timestamp, justificativa e vendedor opcional
+func RejeitarDevolucao(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering RejeitarDevolucao")
+	return avancarDevolucao(stub, args, RoleLoja, StatusDevolucaoSolicitada, StatusDevolucaoRejeitada)
+}
+
+//args: pedido ID, timestamp, justificativa e vendedor opcional
+func RegistrarRecebimentoDevolucao(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering RegistrarRecebimentoDevolucao")
+	return avancarDevolucao(stub, args, RoleLoja, StatusDevolucaoAprovada, StatusDevolucaoRecebida)
+}
+
+//args: pedido ID, timestamp, justificativa e vendedor opcional
+func RegistrarReembolso(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering RegistrarReembolso")
+	return avancarDevolucao(stub, args, RoleFinanceiro, StatusDevolucaoRecebida, StatusDevolucaoReembolsada)
+}
+
+func avancarDevolucao(stub shim.ChaincodeStubInterface, args []string, papel string, de string, para string) ([]byte, error) {
+	args, versaoEsperada, err := extrairVersaoEsperada(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected atleast pedido ID and timestamp")
+	}
+
+	var pedidoID = args[0]
+	data, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+	var justificativa = ""
+	if len(args) > 2 {
+		justificativa = args[2]
+	}
+	var vendedor = ""
+	if len(args) > 3 {
+		vendedor = args[3]
+	}
+	if para == StatusDevolucaoRejeitada && justificativa == "" {
+		logger.Error("Missing justificativa")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "A justificativa is required to reject a return")
+	}
+
+	//o admin pode avancar as etapas da loja em nome de todos os vendedores
+	if papel == RoleLoja {
+		err = exigirPapel(stub, RoleLoja, RoleAdmin)
+	} else {
+		err = exigirPapel(stub, papel)
+	}
+	if err != nil {
+		return nil, err
+	}
+	role, err := lerAtributo(stub, "role")
+	if err != nil {
+		logger.Error("Could not read role attribute", err)
+		return nil, err
+	}
+	vendedorChamador, err := lerAtributo(stub, "vendedor")
+	if err != nil {
+		logger.Error("Could not read vendedor attribute", err)
+		return nil, err
+	}
+	var papelChamador = string(role)
+
+	//devolucao rejeitada deixa de contar nas estatisticas
+	var motivoRejeitado = 0
+	var dataRejeitada int64
+	var skus []string
+	var cpfHash string
+	fn := func(p *Pedido) error {
+		devolucao, _, err := devolucaoDoPedido(p, vendedor)
+		if err != nil {
+			return err
+		}
+		if devolucao.Status != de {
+			return erroCodigo(CodigoOperacaoNaoPermitida, "Return is " + devolucao.Status + ", expected " + de)
+		}
+		if len(devolucao.Historico) > 0 && data < devolucao.Historico[len(devolucao.Historico)-1].Data {
+			return erroCodigo(CodigoOperacaoNaoPermitida, "Timestamp before the previous return step")
+		}
+		if papelChamador == RoleLoja {
+			concluida, err := concordanciaDosVendedores(p, devolucao, vendedor, string(vendedorChamador), para, data)
+			if err != nil {
+				return err
+			}
+			//falta a concordancia de outro vendedor: grava so a deste e a etapa nao avanca
+			if !concluida {
+				return nil
+			}
+		}
+		devolucao.Concordancias = nil
+		devolucao.Status = para
+		devolucao.Historico = append(devolucao.Historico, EtapaDevolucao{para, data, papelChamador, justificativa})
+		//rejeitada, o pedido volta a ser apenas entregue
+		if para == StatusDevolucaoRejeitada {
+			motivoRejeitado = devolucao.MotivoDevolucao
+			dataRejeitada = devolucao.Data
+			skus = skusDaDevolucao(p, vendedor)
+			cpfHash = p.CPFHash
+			devolucao.MotivoDevolucao = 0
+		}
+		return nil
+	}
+	bytes, err := AtualizarPedidoVersao(stub, pedidoID, versaoEsperada, fn)
+	if err != nil {
+		return nil, err
+	}
+	if motivoRejeitado != 0 {
+		err = contarDevolucao(stub, dataRejeitada, skus, motivoRejeitado, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	//arrependimento rejeitado devolve os pontos estornados
+	if motivoRejeitado == 1 {
+		err = estornarPontos(stub, cpfHash, pedidoID, skus, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes, nil
+}
+
+//confere o vendedor do chamador com os vendedores dos subpedidos envolvidos: o do subpedido
+//informado ou todos os do pedido. Pedido sem itens de marketplace e da propria loja e nao tem
+//vendedor a conferir. No pedido inteiro com mais de um vendedor a etapa so avanca quando todos
+//concordam; ate la devolve false e a concordancia fica registrada na devolucao
+func concordanciaDosVendedores(p *Pedido, devolucao *Devolucao, vendedor string, chamador string, para string, data int64) (bool, error) {
+	envolvidos := []string{vendedor}
+	if vendedor == "" {
+		envolvidos = []string{}
+		for _, sub := range p.SubPedidos {
+			envolvidos = append(envolvidos, sub.Vendedor)
+		}
+	}
+	if len(envolvidos) == 0 {
+		return true, nil
+	}
+	var envolvido = false
+	for _, v := range envolvidos {
+		envolvido = envolvido || v == chamador
+	}
+	if !envolvido {
+		logger.Error("Caller " + chamador + " is not a seller of pedido " + p.ID)
+		return false, erroCodigo(CodigoPapelNaoPermitido, "Only the sellers of the sub-orders can handle their return")
+	}
+	if len(envolvidos) == 1 {
+		return true, nil
+	}
+	for _, c := range devolucao.Concordancias {
+		if c.Status != para {
+			return false, erroCodigo(CodigoOperacaoNaoPermitida, "Seller " + c.Vendedor + " agreed to " + c.Status + " for this return, an admin must decide")
+		}
+		if c.Vendedor == chamador {
+			return false, erroCodigo(CodigoOperacaoNaoPermitida, "Seller " + chamador + " already agreed to " + para + " for this return")
+		}
+	}
+	devolucao.Concordancias = append(devolucao.Concordancias, ConcordanciaVendedor{chamador, para, data})
+	return len(devolucao.Concordancias) == len(envolvidos), nil
+}
+
+//devolucao do pedido inteiro ou do subpedido do vendedor, com a respectiva data de entrega
+func devolucaoDoPedido(p *Pedido, vendedor string) (*Devolucao, int64, error) {
+	if vendedor == "" {
+		return &p.Devolucao, p.DataEntrega, nil
+	}
+	sub, err := subPedidoDoVendedor(p, vendedor)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &sub.Devolucao, sub.DataEntrega, nil
+}
+
+//devolucao que impede a troca: solicitada ou ja em andamento no pedido ou em algum subpedido.
+//Devolucao rejeitada nao conta, o pedido volta a ser apenas entregue
+func temDevolucaoAtiva(p *Pedido) bool {
+	devolucoes := []Devolucao{p.Devolucao}
+	for _, sub := range p.SubPedidos {
+		devolucoes = append(devolucoes, sub.Devolucao)
+	}
+	for _, d := range devolucoes {
+		if d.Status != "" && d.Status != StatusDevolucaoRejeitada {
+			return true
+		}
+	}
+	return false
+}
+
+//devolucao ativa fora da escolhida pelo vendedor: para o pedido inteiro, a de algum subpedido;
+//para um subpedido, a do pedido inteiro
+func temOutraDevolucaoAtiva(p *Pedido, vendedor string) bool {
+	ativa := func(d Devolucao) bool {
+		return d.Status != "" && d.Status != StatusDevolucaoRejeitada
+	}
+	if vendedor != "" {
+		return ativa(p.Devolucao)
+	}
+	for _, sub := range p.SubPedidos {
+		if ativa(sub.Devolucao) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package contrato
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+func registrarPedidoComArrependimento(t *testing.T, attributes map[string][]byte) *shim.MockStub {
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504000000000")
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1504000001000", chaveNFeDevolucao, "", "Nao gostei da cor"})
+	if err != nil {
+		t.Fatalf("Expected arrependimento to be requested: %s", err)
+	}
+	return stub
+}
+
+func TestArrependimentoSemPapelCliente(t *testing.T) {
+	fmt.Println("Entering TestArrependimentoSemPapelCliente")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504000000000")
+
+	attributes["role"] = []byte(RoleLoja)
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1504000001000", chaveNFeDevolucao})
+	if err == nil {
+		t.Fatalf("Expected only cliente to request a return")
+	}
+}
+
+func TestFluxoDevolucaoCompleto(t *testing.T) {
+	fmt.Println("Entering TestFluxoDevolucaoCompleto")
+	attributes := novosAtributos()
+	stub := registrarPedidoComArrependimento(t, attributes)
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Devolucao.Status != StatusDevolucaoSolicitada || pe.Devolucao.ComplementoMotivoDevolucao != "Nao gostei da cor" {
+		t.Fatalf("Return should be requested")
+	}
+
+	_, err := stub.MockInvoke("t123", "AprovarDevolucao", []string{pedidoID, "1504000002000", "Dentro do prazo"})
+	if err == nil {
+		t.Fatalf("Expected cliente not to approve the return")
+	}
+
+	attributes["role"] = []byte(RoleLoja)
+	_, err = stub.MockInvoke("t123", "RegistrarRecebimentoDevolucao", []string{pedidoID, "1504000002000"})
+	if err == nil {
+		t.Fatalf("Expected error receiving a return that was not approved")
+	}
+	_, err = stub.MockInvoke("t123", "AprovarDevolucao", []string{pedidoID, "1504000002000", "Dentro do prazo"})
+	if err != nil {
+		t.Fatalf("Expected return to be approved: %s", err)
+	}
+	_, err = stub.MockInvoke("t123", "RegistrarRecebimentoDevolucao", []string{pedidoID, "1504000003000", "Produto lacrado"})
+	if err != nil {
+		t.Fatalf("Expected return to be received: %s", err)
+	}
+	_, err = stub.MockInvoke("t123", "RegistrarReembolso", []string{pedidoID, "1504000004000"})
+	if err == nil {
+		t.Fatalf("Expected only financeiro to refund")
+	}
+
+	attributes["role"] = []byte(RoleFinanceiro)
+	_, err = stub.MockInvoke("t123", "RegistrarReembolso", []string{pedidoID, "1504000004000", "Estorno no cartao"})
+	if err != nil {
+		t.Fatalf("Expected refund to be registered: %s", err)
+	}
+
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Devolucao.Status != StatusDevolucaoReembolsada || len(pe.Devolucao.Historico) != 4 {
+		t.Fatalf("Expected four return steps ending in refund")
+	}
+	if pe.Devolucao.Historico[2].Papel != RoleLoja || pe.Devolucao.Historico[2].Justificativa != "Produto lacrado" {
+		t.Fatalf("Step role and justificativa not recorded")
+	}
+}
+
+func TestRejeitarDevolucao(t *testing.T) {
+	fmt.Println("Entering TestRejeitarDevolucao")
+	attributes := novosAtributos()
+	stub := registrarPedidoComArrependimento(t, attributes)
+
+	attributes["role"] = []byte(RoleLoja)
+	_, err := stub.MockInvoke("t123", "RejeitarDevolucao", []string{pedidoID, "1504000002000"})
+	if err == nil {
+		t.Fatalf("Expected justificativa to be required")
+	}
+	_, err = stub.MockInvoke("t123", "RejeitarDevolucao", []string{pedidoID, "1504000002000", "Produto usado"})
+	if err != nil {
+		t.Fatalf("Expected return to be rejected: %s", err)
+	}
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Devolucao.Status != StatusDevolucaoRejeitada || pe.Devolucao.MotivoDevolucao != 0 || pe.DataEntrega == 0 {
+		t.Fatalf("Rejected return should keep the pedido delivered")
+	}
+}
+
+func TestRejeitarDevolucaoComVersao(t *testing.T) {
+	fmt.Println("Entering TestRejeitarDevolucaoComVersao")
+	attributes := novosAtributos()
+	stub := registrarPedidoComArrependimento(t, attributes)
+
+	attributes["role"] = []byte(RoleLoja)
+	_, err := stub.MockInvoke("t123", "RejeitarDevolucao", []string{pedidoID, "1504000002000", "versao=3"})
+	if err == nil {
+		t.Fatalf("Expected justificativa to be required when only the version is sent")
+	}
+	_, err = stub.MockInvoke("t123", "RejeitarDevolucao", []string{pedidoID, "1504000002000", "Produto usado", "", "versao=2"})
+	if err == nil {
+		t.Fatalf("Expected version conflict error")
+	}
+	_, err = stub.MockInvoke("t123", "RejeitarDevolucao", []string{pedidoID, "1504000002000", "Produto usado", "", "versao=3"})
+	if err != nil {
+		t.Fatalf("Expected return to be rejected at version 3: %s", err)
+	}
+}
+
+func TestArrependimentoSoPeloClienteDoPedido(t *testing.T) {
+	fmt.Println("Entering TestArrependimentoSoPeloClienteDoPedido")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	sim.Relogio.Avancar(simulador.Dia)
+
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", "outro-cliente")
+	err := sim.DeveFalhar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao)
+	if !strings.Contains(err.Error(), CodigoPapelNaoPermitido) {
+		t.Fatalf("Expected another customer to be refused a regret, got %s", err)
+	}
+	//o subpedido de um vendedor tambem e so do dono do pedido
+	err = sim.DeveFalhar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "lojaA")
+	if !strings.Contains(err.Error(), CodigoPapelNaoPermitido) {
+		t.Fatalf("Expected another customer to be refused a sub-order regret, got %s", err)
+	}
+	sim.AssertCampo(t, pedidoID, "devolucao.status", "")
+	sim.ComoClienteDe(t, pedidoID).DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao)
+}
+
+func TestArrependimentoForaDoPrazo(t *testing.T) {
+	fmt.Println("Entering TestArrependimentoForaDoPrazo")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+
+	sim.Relogio.Avancar(8 * simulador.Dia)
+	err := sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).DeveFalhar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao)
+	if err.Error() != erroCodigo(CodigoPrazoExcedido, "Time of regret exceeded").Error() {
+		t.Fatalf("Expected regret window error, got %s", err)
+	}
+	sim.AssertCampo(t, pedidoID, "devolucao.status", "")
+	//a chave da NF-e e gravada antes da validacao, mas a transacao com erro nao grava nada
+	if bytes, _ := sim.Stub.GetState(nfeIndexPrefix + chaveNFeDevolucao); bytes != nil {
+		t.Fatalf("Expected the NF-e of the failed regret not to be registered")
+	}
+}
+
+func TestAprovarDevolucaoNoSimulador(t *testing.T) {
+	fmt.Println("Entering TestAprovarDevolucaoNoSimulador")
+	sim := novoSimulador()
+	sim.PedidoDevolvido(t, pedidoID, pedidoJson, chaveNFeDevolucao)
+	sim.AssertCampo(t, pedidoID, "devolucao.status", StatusDevolucaoSolicitada)
+	//o cenario deixa o relogio na hora do arrependimento
+	sim.AssertCampo(t, pedidoID, "devolucao.data", sim.Relogio.Agora())
+
+	sim.Relogio.Avancar(simulador.Dia)
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto())
+	sim.AssertCampo(t, pedidoID, "devolucao.historico.1.papel", RoleLoja)
+}
+
+func TestTrocaEDevolucaoExclusivas(t *testing.T) {
+	fmt.Println("Entering TestTrocaEDevolucaoExclusivas")
+	sim := novoSimulador()
+	sim.PedidoDevolvido(t, pedidoID, pedidoJson, chaveNFeDevolucao)
+
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	err := sim.DeveFalhar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveNFeDevolucao)
+	if err.Error() != erroCodigo(CodigoOperacaoNaoPermitida, "Pedido with a return can not be exchanged").Error() {
+		t.Fatalf("Expected exchange to be refused during a return, got %s", err)
+	}
+	var resumo ResumoDoPedido
+	sim.ComoPapel(RoleCliente).DeveConsultar(t, &resumo, "ResumoPedido", pedidoID, sim.Relogio.Texto())
+	if resumo.TrocaPossivel {
+		t.Fatalf("Expected ResumoPedido not to offer an exchange during a return")
+	}
+
+	//rejeitada a devolucao, a troca volta a ser possivel
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RejeitarDevolucao", pedidoID, sim.Relogio.Texto(), "Produto usado")
+	sim.ComoPapel(RoleCliente).DeveConsultar(t, &resumo, "ResumoPedido", pedidoID, sim.Relogio.Texto())
+	if !resumo.TrocaPossivel {
+		t.Fatalf("Expected exchange to be possible after the return was rejected")
+	}
+	sim.DeveInvocar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveNFeDevolucao)
+}
+
+func TestArrependimentoDepoisDaTroca(t *testing.T) {
+	fmt.Println("Entering TestArrependimentoDepoisDaTroca")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+
+	sim.Relogio.Avancar(simulador.Dia)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveNFeDevolucao)
+	var resumo ResumoDoPedido
+	sim.DeveConsultar(t, &resumo, "ResumoPedido", pedidoID, sim.Relogio.Texto())
+	if len(resumo.AcoesPermitidas) != 1 || resumo.AcoesPermitidas[0] != "AbrirDisputa" {
+		t.Fatalf("Expected only a dispute after the exchange, got %v", resumo.AcoesPermitidas)
+	}
+	err := sim.DeveFalhar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao)
+	if err.Error() != erroCodigo(CodigoOperacaoNaoPermitida, "Pedido was already exchanged").Error() {
+		t.Fatalf("Expected regret to be refused after an exchange, got %s", err)
+	}
+	sim.AssertCampo(t, pedidoID, "devolucao.status", "")
+}
+
+func TestTrocaSoPeloClienteDoPedido(t *testing.T) {
+	fmt.Println("Entering TestTrocaSoPeloClienteDoPedido")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+	sim.Relogio.Avancar(simulador.Dia)
+
+	err := sim.ComoPapel(RoleLoja).DeveFalhar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveNFeDevolucao)
+	if !strings.Contains(err.Error(), CodigoPapelNaoPermitido) {
+		t.Fatalf("Expected a store to be refused an exchange, got %s", err)
+	}
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", "outro-cliente")
+	err = sim.DeveFalhar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveNFeDevolucao)
+	if !strings.Contains(err.Error(), CodigoPapelNaoPermitido) {
+		t.Fatalf("Expected another customer to be refused an exchange, got %s", err)
+	}
+	sim.AssertCampo(t, pedidoID, "troca.data", float64(0))
+}
+
+func TestTrocaComChaveDaVenda(t *testing.T) {
+	fmt.Println("Entering TestTrocaComChaveDaVenda")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+	sim.Relogio.Avancar(simulador.Dia)
+
+	chaveVenda := "35170801234567000199550010000012341000123451"
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	err := sim.DeveFalhar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveVenda)
+	if !strings.Contains(err.Error(), CodigoNFeJaRegistrada) {
+		t.Fatalf("Expected the sale NF-e key to be refused as return key, got %s", err)
+	}
+	sim.DeveInvocar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "1", "3", chaveNFeDevolucao)
+}
+
+//pedido de dois vendedores entregue, com arrependimento do pedido inteiro
+func devolucaoMarketplaceForTest(t *testing.T) *simuladortest.Simulador {
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	sim.Relogio.Avancar(simulador.Dia)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao)
+	return sim
+}
+
+func TestDevolucaoMarketplaceExigeTodosOsVendedores(t *testing.T) {
+	fmt.Println("Entering TestDevolucaoMarketplaceExigeTodosOsVendedores")
+	sim := devolucaoMarketplaceForTest(t)
+
+	sim.ComoPapel(RoleLoja)
+	err := sim.DeveFalhar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto())
+	if err.Error() != erroCodigo(CodigoPapelNaoPermitido, "Only the sellers of the sub-orders can handle their return").Error() {
+		t.Fatalf("Expected a caller without vendedor to be refused, got %s", err)
+	}
+	sim.ComAtributo("vendedor", "lojaC").DeveFalhar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto())
+
+	sim.ComAtributo("vendedor", "lojaA").DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "Ok da lojaA")
+	sim.AssertCampo(t, pedidoID, "devolucao.status", StatusDevolucaoSolicitada)
+	sim.AssertCampo(t, pedidoID, "devolucao.concordancias.0.vendedor", "lojaA")
+	sim.DeveFalhar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto())
+	err = sim.ComAtributo("vendedor", "lojaB").DeveFalhar(t, "RejeitarDevolucao", pedidoID, sim.Relogio.Texto(), "Panela usada")
+	if err.Error() != erroCodigo(CodigoOperacaoNaoPermitida, "Seller lojaA agreed to APROVADA for this return, an admin must decide").Error() {
+		t.Fatalf("Expected conflicting sellers to be refused, got %s", err)
+	}
+
+	sim.DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "Ok da lojaB")
+	var pe Pedido
+	sim.Estado(t, pedidoID, &pe)
+	if pe.Devolucao.Status != StatusDevolucaoAprovada || len(pe.Devolucao.Concordancias) != 0 || len(pe.Devolucao.Historico) != 2 {
+		t.Fatalf("Expected the return approved once both sellers agreed, got %+v", pe.Devolucao)
+	}
+}
+
+func TestDevolucaoMarketplacePeloAdmin(t *testing.T) {
+	fmt.Println("Entering TestDevolucaoMarketplacePeloAdmin")
+	sim := devolucaoMarketplaceForTest(t)
+
+	sim.ComoPapel(RoleAdmin).DeveInvocar(t, "RejeitarDevolucao", pedidoID, sim.Relogio.Texto(), "Produtos usados")
+	sim.AssertCampo(t, pedidoID, "devolucao.status", StatusDevolucaoRejeitada)
+	sim.AssertCampo(t, pedidoID, "devolucao.historico.1.papel", RoleAdmin)
+	sim.DeveFalhar(t, "RegistrarReembolso", pedidoID, sim.Relogio.Texto())
+}
+
+func TestDevolucaoSubPedidoDeOutroVendedor(t *testing.T) {
+	fmt.Println("Entering TestDevolucaoSubPedidoDeOutroVendedor")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "lojaA")
+
+	sim.ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaB")
+	sim.DeveFalhar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "", "lojaA")
+	sim.ComAtributo("vendedor", "lojaA").DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "", "lojaA")
+	sim.AssertCampo(t, pedidoID, "subPedidos.0.devolucao.status", StatusDevolucaoAprovada)
+}
@@ -0,0 +1,480 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//prefixos das chaves das disputas e dos indices por pedido e por CPF
+var disputaPrefix = "_disputa_"
+var disputaIndexStr = "_disputaindex"
+var disputaPedidoIndexPrefix = "_disputas_pedido_"
+var disputaCPFIndexPrefix = "_disputas_cpf_"
+
+//10 dias em milissegundos para a loja responder, como no Procon
+var prazoRespostaDisputa int64 = 864000000
+
+const (
+	StatusDisputaAberta     = "ABERTA"
+	StatusDisputaRespondida = "RESPONDIDA"
+	StatusDisputaResolvida  = "RESOLVIDA"
+)
+
+//resolucoes possiveis de uma disputa
+const (
+	ResolucaoDevolucao    = "DEVOLUCAO"
+	ResolucaoTroca        = "TROCA"
+	ResolucaoImprocedente = "IMPROCEDENTE"
+)
+
+type RespostaDisputa struct {
+	Papel                  string        `json:"papel"`
+	Texto                  string        `json:"texto"`
+	Data                   int64         `json:"data"`
+	// vendedor do certificado da loja que respondeu, vazio fora do marketplace
+	Vendedor               string        `json:"vendedor,omitempty"`
+}
+
+//reclamacao do cliente sobre um pedido, aberta quando a loja recusa a devolucao
+type Disputa struct {
+	ID                     string        `json:"id"`
+	PedidoID               string        `json:"pedidoId"`
+	// HMAC do CPF do cliente, o mesmo do pedido
+	CPFHash                string        `json:"cpfHash"`
+	Descricao              string        `json:"descricao"`
+	DataAbertura           int64         `json:"dataAbertura"`
+	// limite para a primeira resposta da loja
+	PrazoResposta          int64         `json:"prazoResposta"`
+	RespostaForaDoPrazo    bool          `json:"respostaForaDoPrazo"`
+	Respostas              []RespostaDisputa `json:"respostas"`
+	// preenchida quando um mediador resolve a disputa
+	DecisaoMediador        string        `json:"decisaoMediador"`
+	Resolucao              string        `json:"resolucao"`
+	DataResolucao          int64         `json:"dataResolucao"`
+	Status                 string        `json:"status"`
+}
+
+//args: disputa ID, pedido ID, timestamp e descricao
+func AbrirDisputa(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering AbrirDisputa")
+
+	if len(args) < 4 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected disputa ID, pedido ID, timestamp and descricao for AbrirDisputa")
+	}
+	var disputaID = args[0]
+	var pedidoID = args[1]
+	dataAbertura, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+
+	err = exigirPapel(stub, RoleCliente)
+	if err != nil {
+		return nil, err
+	}
+
+	existente, err := stub.GetState(disputaPrefix + disputaID)
+	if err != nil {
+		logger.Error("Could not fetch disputa "+disputaID+" from ledger", err)
+		return nil, err
+	}
+	if existente != nil {
+		logger.Error("Disputa already exists " + disputaID)
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Disputa " + disputaID + " already exists")
+	}
+
+	bytes, err := ObterPedido(stub, []string{pedidoID})
+	if err != nil {
+		return nil, err
+	}
+	var pe Pedido
+	err = json.Unmarshal(bytes, &pe)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+pedidoID, err)
+		return nil, erroCodigo(CodigoPedidoNaoEncontrado, "Pedido " + pedidoID + " not found")
+	}
+	//so o cliente do pedido abre disputa sobre ele
+	err = exigirTitular(stub, pe.CPFHash)
+	if err != nil {
+		return nil, err
+	}
+
+	d := Disputa{
+		ID:            disputaID,
+		PedidoID:      pedidoID,
+		CPFHash:       pe.CPFHash,
+		Descricao:     args[3],
+		DataAbertura:  dataAbertura,
+		PrazoResposta: dataAbertura + prazoRespostaDisputa,
+		Respostas:     []RespostaDisputa{},
+		Status:        StatusDisputaAberta,
+	}
+
+	err = adicionarAoIndice(stub, disputaIndexStr, disputaID)
+	if err != nil {
+		return nil, err
+	}
+	err = adicionarAoIndice(stub, disputaPedidoIndexPrefix+pedidoID, disputaID)
+	if err != nil {
+		return nil, err
+	}
+	err = adicionarAoIndice(stub, disputaCPFIndexPrefix+pe.CPFHash, disputaID)
+	if err != nil {
+		return nil, err
+	}
+	return salvarDisputa(stub, &d)
+}
+
+//args: disputa ID, timestamp e texto da resposta da loja
+func ResponderDisputa(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ResponderDisputa")
+
+	if len(args) < 3 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected disputa ID, timestamp and texto for ResponderDisputa")
+	}
+	data, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+
+	err = exigirPapel(stub, RoleLoja)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := lerDisputa(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == StatusDisputaResolvida {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Disputa already resolved")
+	}
+	//so responde a loja dona do pedido ou, no marketplace, um vendedor com subpedido nele
+	bytes, err := stub.GetState(d.PedidoID)
+	if err != nil {
+		logger.Error("Could not fetch pedido "+d.PedidoID+" from ledger", err)
+		return nil, err
+	}
+	if bytes == nil {
+		return nil, erroCodigo(CodigoPedidoNaoEncontrado, "Pedido " + d.PedidoID + " not found")
+	}
+	var pe Pedido
+	err = decodificarPedido(bytes, &pe)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+d.PedidoID, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	err = restringirAoVendedor(stub, &pe)
+	if err != nil {
+		return nil, err
+	}
+	vendedor, err := lerAtributo(stub, "vendedor")
+	if err != nil {
+		logger.Error("Could not read vendedor attribute", err)
+		return nil, err
+	}
+	if d.Status == StatusDisputaAberta && data > d.PrazoResposta {
+		d.RespostaForaDoPrazo = true
+	}
+	d.Respostas = append(d.Respostas, RespostaDisputa{RoleLoja, args[2], data, string(vendedor)})
+	d.Status = StatusDisputaRespondida
+	return salvarDisputa(stub, d)
+}
+
+//args: disputa ID, timestamp, resolucao, justificativa, motivo (devolucao ou troca) e, na troca, opcao
+//e chave da NF-e de devolucao; na devolucao, o vendedor opcional do subpedido devolvido
+func ResolverDisputa(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ResolverDisputa")
+
+	if len(args) < 4 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected disputa ID, timestamp, resolucao and justificativa for ResolverDisputa")
+	}
+	data, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+	var resolucao = args[2]
+	var justificativa = args[3]
+
+	//a loja e parte na disputa, entao so o mediador decide
+	err = exigirPapel(stub, RoleMediador)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := lerDisputa(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == StatusDisputaResolvida {
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Disputa already resolved")
+	}
+
+	var fn func(p *Pedido) error
+	var contar func() error
+	switch resolucao {
+	case ResolucaoDevolucao:
+		if len(args) < 5 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Expected motivo de devolucao to force a Devolucao")
+		}
+		motivo, err := strconv.Atoi(args[4])
+		if err != nil || motivo < 1 || motivo > 3 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid motivo devolucao, expected 1, 2 or 3")
+		}
+		//vendedor opcional: forca a devolucao do subpedido dele, como no RegistrarArrependimento
+		var vendedor = ""
+		if len(args) > 5 {
+			vendedor = args[5]
+		}
+		var skus []string
+		var cpfHash string
+		var dataDevolucao int64
+		var motivoAnterior int
+		fn = func(p *Pedido) error {
+			if p.Troca.Data != 0 {
+				return erroCodigo(CodigoOperacaoNaoPermitida, "Pedido was already exchanged")
+			}
+			devolucao, dataEntrega, err := devolucaoDoPedido(p, vendedor)
+			if err != nil {
+				return err
+			}
+			if dataEntrega == 0 {
+				return erroCodigo(CodigoOperacaoNaoPermitida, "Product that was not delivered can not be returned")
+			}
+			//devolucao ja recebida ou reembolsada terminou; aprovar de novo permitiria outro reembolso
+			if devolucao.Status == StatusDevolucaoRecebida || devolucao.Status == StatusDevolucaoReembolsada {
+				return erroCodigo(CodigoOperacaoNaoPermitida, "Return is already " + devolucao.Status)
+			}
+			//a devolucao do pedido inteiro e a de um subpedido contariam os mesmos itens duas vezes
+			if temOutraDevolucaoAtiva(p, vendedor) {
+				return erroCodigo(CodigoOperacaoNaoPermitida, "Pedido has another return in progress, resolve the return of that sub-order")
+			}
+			//devolucao ainda em andamento ja foi contada e teve os pontos estornados quando solicitada
+			motivoAnterior = devolucao.MotivoDevolucao
+			skus = skusDaDevolucao(p, vendedor)
+			cpfHash = p.CPFHash
+			devolucao.MotivoDevolucao = motivo
+			if devolucao.Data == 0 {
+				devolucao.Data = data
+			}
+			devolucao.Concordancias = nil
+			devolucao.Status = StatusDevolucaoAprovada
+			devolucao.Historico = append(devolucao.Historico, EtapaDevolucao{StatusDevolucaoAprovada, data, RoleMediador, "Disputa " + d.ID + ": " + justificativa})
+			dataDevolucao = devolucao.Data
+			return nil
+		}
+		contar = func() error {
+			//o mediador pode mudar o motivo, por exemplo de arrependimento para defeito:
+			//a devolucao passa a contar no motivo novo
+			if motivoAnterior == motivo {
+				return nil
+			}
+			if motivoAnterior != 0 {
+				err := contarDevolucao(stub, dataDevolucao, skus, motivoAnterior, -1)
+				if err != nil {
+					return err
+				}
+				return contarDevolucao(stub, dataDevolucao, skus, motivo, 1)
+			}
+			err := contarDevolucao(stub, dataDevolucao, skus, motivo, 1)
+			if err != nil {
+				return err
+			}
+			return estornarPontos(stub, cpfHash, d.PedidoID, skus, 1)
+		}
+	case ResolucaoTroca:
+		if len(args) < 7 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Expected motivo, opcao de troca and NF-e key to force a Troca")
+		}
+		motivo, err := strconv.Atoi(args[4])
+		if err != nil || motivo < 1 || motivo > 2 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid motivo troca, expected 1 or 2")
+		}
+		opcao, err := strconv.Atoi(args[5])
+		if err != nil || opcao < 1 || opcao > 3 {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid opcao troca, expected 1, 2 or 3")
+		}
+		var chaveNFeDevolucao = args[6]
+		err = validarChaveNFe(chaveNFeDevolucao)
+		if err != nil {
+			logger.Error("Invalid return NF-e key", err)
+			return nil, err
+		}
+		err = registrarChaveNFe(stub, chaveNFeDevolucao, d.PedidoID)
+		if err != nil {
+			return nil, err
+		}
+		var skus []string
+		//o mediador decide fora do prazo, mas nao troca o que ja foi trocado ou esta em devolucao
+		fn = func(p *Pedido) error {
+			err := validarTroca(p, data)
+			if err != nil {
+				return err
+			}
+			err = validarChaveDevolucao(p, chaveNFeDevolucao)
+			if err != nil {
+				return err
+			}
+			p.Troca = Troca{motivo, opcao, data, chaveNFeDevolucao}
+			skus = skusDoPedido(p)
+			return nil
+		}
+		contar = func() error {
+			return contarTroca(stub, data, skus, motivo, opcao)
+		}
+	case ResolucaoImprocedente:
+	default:
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid resolucao " + resolucao)
+	}
+
+	if fn != nil {
+		_, err = AtualizarPedido(stub, d.PedidoID, fn)
+		if err != nil {
+			return nil, err
+		}
+		err = contar()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.DecisaoMediador = justificativa
+	d.Resolucao = resolucao
+	d.DataResolucao = data
+	d.Status = StatusDisputaResolvida
+	return salvarDisputa(stub, d)
+}
+
+func ObterDisputa(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ObterDisputa")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing disputa ID")
+	}
+	bytes, err := stub.GetState(disputaPrefix + args[0])
+	if err != nil || bytes == nil {
+		return bytes, err
+	}
+	//disputas gravadas antes da serializacao canonica saem canonicas tambem
+	return canonico.JSON(bytes)
+}
+
+func ListarDisputasPedido(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ListarDisputasPedido")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing pedido ID")
+	}
+	return listarDisputasDoIndice(stub, disputaPedidoIndexPrefix+args[0])
+}
+
+func ListarDisputasCPF(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ListarDisputasCPF")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing CPF")
+	}
+	cpfHash, err := hashCPFDoChamador(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return listarDisputasDoIndice(stub, disputaCPFIndexPrefix+cpfHash)
+}
+
+//lista as disputas ainda sem resposta da loja cujo prazo venceu na data de referencia
+func ListarDisputasVencidas(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ListarDisputasVencidas")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected reference timestamp for ListarDisputasVencidas")
+	}
+	dataReferencia, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+
+	disputas, err := lerDisputasDoIndice(stub, disputaIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	vencidas := []Disputa{}
+	for _, d := range disputas {
+		if d.Status == StatusDisputaAberta && dataReferencia > d.PrazoResposta {
+			vencidas = append(vencidas, d)
+		}
+	}
+	return canonico.Marshal(vencidas)
+}
+
+func listarDisputasDoIndice(stub shim.ChaincodeStubInterface, chave string) ([]byte, error) {
+	disputas, err := lerDisputasDoIndice(stub, chave)
+	if err != nil {
+		return nil, err
+	}
+	return canonico.Marshal(disputas)
+}
+
+func lerDisputasDoIndice(stub shim.ChaincodeStubInterface, chave string) ([]Disputa, error) {
+	ids, err := lerIndice(stub, chave)
+	if err != nil {
+		return nil, err
+	}
+	disputas := []Disputa{}
+	for _, id := range ids {
+		d, err := lerDisputa(stub, id)
+		if err != nil {
+			return nil, err
+		}
+		disputas = append(disputas, *d)
+	}
+	return disputas, nil
+}
+
+func lerDisputa(stub shim.ChaincodeStubInterface, id string) (*Disputa, error) {
+	bytes, err := stub.GetState(disputaPrefix + id)
+	if err != nil {
+		logger.Error("Could not fetch disputa "+id+" from ledger", err)
+		return nil, err
+	}
+	if bytes == nil {
+		logger.Error("Disputa not found " + id)
+		return nil, erroCodigo(CodigoDisputaNaoEncontrada, "Disputa " + id + " not found")
+	}
+	var d Disputa
+	err = json.Unmarshal(bytes, &d)
+	if err != nil {
+		logger.Error("Invalid format for disputa "+id, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	return &d, nil
+}
+
+func salvarDisputa(stub shim.ChaincodeStubInterface, d *Disputa) ([]byte, error) {
+	bytes, err := canonico.Marshal(d)
+	if err != nil {
+		logger.Error("Could not marshal Disputa", err)
+		return nil, err
+	}
+	err = stub.PutState(disputaPrefix+d.ID, bytes)
+	if err != nil {
+		logger.Error("Could not save disputa to ledger", err)
+		return nil, err
+	}
+	logger.Info("Successfully saved Disputa")
+	return bytes, nil
+}
@@ -0,0 +1,206 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+func TestAbrirDisputaSemPedido(t *testing.T) {
+	fmt.Println("Entering TestAbrirDisputaSemPedido")
+	attributes := novosAtributos()
+	attributes["role"] = []byte(RoleCliente)
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	_, err := stub.MockInvoke("t123", "AbrirDisputa", []string{"d1", pedidoID, "1504000005000", "Loja recusou a devolucao"})
+	if err == nil {
+		t.Fatalf("Expected error opening a disputa for an unknown pedido")
+	}
+}
+
+func TestDisputaRespostaForaDoPrazo(t *testing.T) {
+	fmt.Println("Entering TestDisputaRespostaForaDoPrazo")
+	attributes := novosAtributos()
+	stub := registrarPedidoComArrependimento(t, attributes)
+
+	_, err := stub.MockInvoke("t123", "AbrirDisputa", []string{"d1", pedidoID, "1504000005000", "Loja recusou a devolucao"})
+	if err != nil {
+		t.Fatalf("Expected disputa to be opened: %s", err)
+	}
+
+	bytes, _ := stub.MockQuery("ListarDisputasVencidas", []string{"1504864005000"})
+	var vencidas []Disputa
+	json.Unmarshal(bytes, &vencidas)
+	if len(vencidas) != 0 {
+		t.Fatalf("Disputa should still be within the response SLA")
+	}
+	bytes, _ = stub.MockQuery("ListarDisputasVencidas", []string{"1504864005001"})
+	json.Unmarshal(bytes, &vencidas)
+	if len(vencidas) != 1 {
+		t.Fatalf("Disputa should be past the response SLA")
+	}
+
+	attributes["role"] = []byte(RoleLoja)
+	bytes, err = stub.MockInvoke("t123", "ResponderDisputa", []string{"d1", "1504864005001", "Produto com sinais de uso"})
+	if err != nil {
+		t.Fatalf("Expected loja to answer the disputa: %s", err)
+	}
+	var d Disputa
+	json.Unmarshal(bytes, &d)
+	if !d.RespostaForaDoPrazo || d.Status != StatusDisputaRespondida {
+		t.Fatalf("Expected late answer to be flagged")
+	}
+}
+
+func TestResolverDisputaForcaDevolucao(t *testing.T) {
+	fmt.Println("Entering TestResolverDisputaForcaDevolucao")
+	attributes := novosAtributos()
+	stub := registrarPedidoComArrependimento(t, attributes)
+
+	attributes["role"] = []byte(RoleLoja)
+	deveInvocar(t, stub, "RejeitarDevolucao", pedidoID, "1504000002000", "Produto usado")
+
+	attributes["role"] = []byte(RoleCliente)
+	deveInvocar(t, stub, "AbrirDisputa", "d1", pedidoID, "1504000005000", "Loja recusou a devolucao")
+
+	_, err := stub.MockInvoke("t123", "ResolverDisputa", []string{"d1", "1504000006000", ResolucaoDevolucao, "Cliente tem razao", "1"})
+	if err == nil {
+		t.Fatalf("Expected cliente not to resolve the disputa")
+	}
+	attributes["role"] = []byte(RoleLoja)
+	_, err = stub.MockInvoke("t123", "ResolverDisputa", []string{"d1", "1504000006000", ResolucaoImprocedente, "Loja tem razao"})
+	if err == nil {
+		t.Fatalf("Expected loja, a party to the disputa, not to resolve it")
+	}
+
+	attributes["role"] = []byte(RoleMediador)
+	_, err = stub.MockInvoke("t123", "ResolverDisputa", []string{"d1", "1504000006000", ResolucaoDevolucao, "Cliente tem razao", "1"})
+	if err != nil {
+		t.Fatalf("Expected mediador to resolve the disputa: %s", err)
+	}
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.Devolucao.Status != StatusDevolucaoAprovada || pe.Devolucao.MotivoDevolucao != 1 {
+		t.Fatalf("Expected disputa resolution to force the Devolucao")
+	}
+
+	bytes, err := stub.MockQuery("ListarDisputasCPF", []string{"09596397729"})
+	if err != nil {
+		t.Fatalf("Expected ListarDisputasCPF to be invoked correctly")
+	}
+	var disputas []Disputa
+	json.Unmarshal(bytes, &disputas)
+	if len(disputas) != 1 || disputas[0].Status != StatusDisputaResolvida || disputas[0].DecisaoMediador != "Cliente tem razao" {
+		t.Fatalf("Expected resolved disputa with mediator decision")
+	}
+}
+
+func TestAbrirDisputaDeOutroCliente(t *testing.T) {
+	fmt.Println("Entering TestAbrirDisputaDeOutroCliente")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", "outro")
+	err := sim.DeveFalhar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Nao recebi")
+	if err.Error() != erroCodigo(CodigoPapelNaoPermitido, "Caller is not the customer of this CPF").Error() {
+		t.Fatalf("Expected only the customer of the pedido to open a disputa, got %s", err)
+	}
+	sim.ComAtributo("cpfHash", cpfHashForTest()).DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Nao recebi")
+}
+
+func TestResolverDisputaForcaTroca(t *testing.T) {
+	fmt.Println("Entering TestResolverDisputaForcaTroca")
+	sim := novoSimulador()
+	sim.PedidoDevolvido(t, pedidoID, pedidoJson, chaveNFeDevolucao)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Prefiro trocar")
+
+	sim.ComoPapel(RoleMediador)
+	sim.DeveFalhar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoTroca, "Troca", "2", "3")
+	err := sim.DeveFalhar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoTroca, "Troca", "2", "3", chaveNFeDevolucao)
+	if err.Error() != erroCodigo(CodigoOperacaoNaoPermitida, "Pedido with a return can not be exchanged").Error() {
+		t.Fatalf("Expected the forced exchange to be refused during a return, got %s", err)
+	}
+
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RejeitarDevolucao", pedidoID, sim.Relogio.Texto(), "Produto usado")
+	//fora do prazo de arrependimento o mediador ainda pode decidir pela troca
+	sim.Relogio.Avancar(30 * simulador.Dia)
+	sim.ComoPapel(RoleMediador).DeveInvocar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoTroca, "Troca", "2", "3", chaveNFeDevolucao)
+	sim.AssertCampo(t, pedidoID, "troca.chaveNFeDevolucao", chaveNFeDevolucao)
+	sim.AssertCampo(t, "_disputa_d1", "status", StatusDisputaResolvida)
+}
+
+func TestResolverDisputaDevolucaoEncerradaOuNaoEntregue(t *testing.T) {
+	fmt.Println("Entering TestResolverDisputaDevolucaoEncerradaOuNaoEntregue")
+	sim := novoSimulador()
+	sim.PedidoRegistrado(t, "la2", pedidoJson)
+	sim.PedidoDevolvido(t, pedidoID, strings.Replace(pedidoJson, "0123451", "0123460", 1), chaveNFeDevolucao)
+	sim.DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "Ok")
+	sim.DeveInvocar(t, "RegistrarRecebimentoDevolucao", pedidoID, sim.Relogio.Texto(), "Recebido")
+
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Nao recebi o reembolso")
+	sim.DeveInvocar(t, "AbrirDisputa", "d2", "la2", sim.Relogio.Texto(), "Nao recebi o pedido")
+	err := sim.DeveFalhar(t, "AbrirDisputa", "d2", "la2", sim.Relogio.Texto(), "Nao recebi o pedido")
+	if !strings.Contains(err.Error(), CodigoOperacaoNaoPermitida) {
+		t.Fatalf("Expected a repeated disputa ID to be refused with a code, got %s", err)
+	}
+
+	sim.ComoPapel(RoleMediador)
+	err = sim.DeveFalhar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoDevolucao, "Cliente tem razao", "2")
+	if err.Error() != erroCodigo(CodigoOperacaoNaoPermitida, "Return is already " + StatusDevolucaoRecebida).Error() {
+		t.Fatalf("Expected a received return not to go back to approved, got %s", err)
+	}
+	sim.AssertCampo(t, pedidoID, "devolucao.status", StatusDevolucaoRecebida)
+	err = sim.DeveFalhar(t, "ResolverDisputa", "d2", sim.Relogio.Texto(), ResolucaoDevolucao, "Cliente tem razao", "2")
+	if err.Error() != erroCodigo(CodigoOperacaoNaoPermitida, "Product that was not delivered can not be returned").Error() {
+		t.Fatalf("Expected an undelivered pedido not to be returned, got %s", err)
+	}
+	err = sim.DeveFalhar(t, "ResolverDisputa", "d3", sim.Relogio.Texto(), ResolucaoImprocedente, "Sem disputa")
+	if !strings.Contains(err.Error(), CodigoDisputaNaoEncontrada) {
+		t.Fatalf("Expected an unknown disputa to be not found, got %s", err)
+	}
+}
+
+func TestResolverDisputaDevolucaoDoSubPedido(t *testing.T) {
+	fmt.Println("Entering TestResolverDisputaDevolucaoDoSubPedido")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "lojaB")
+	sim.DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Panela chegou amassada")
+
+	//so um vendedor com subpedido no pedido responde
+	sim.ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaC")
+	err := sim.DeveFalhar(t, "ResponderDisputa", "d1", sim.Relogio.Texto(), "Nao e conosco")
+	if err.Error() != erroForaDoVendedor.Error() {
+		t.Fatalf("Expected a seller outside the pedido not to answer, got %s", err)
+	}
+	sim.ComAtributo("vendedor", "lojaB").DeveInvocar(t, "ResponderDisputa", "d1", sim.Relogio.Texto(), "Vamos analisar")
+	sim.AssertCampo(t, "_disputa_d1", "respostas.0.vendedor", "lojaB")
+
+	//a devolucao do pedido inteiro contaria de novo os itens da lojaB
+	sim.ComoPapel(RoleMediador)
+	err = sim.DeveFalhar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoDevolucao, "Defeito", "2")
+	if !strings.Contains(err.Error(), CodigoOperacaoNaoPermitida) {
+		t.Fatalf("Expected the whole pedido return to be refused, got %s", err)
+	}
+	sim.DeveInvocar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoDevolucao, "Defeito", "2", "lojaB")
+	sim.AssertCampo(t, pedidoID, "subPedidos.1.devolucao.status", StatusDevolucaoAprovada)
+	sim.AssertCampo(t, pedidoID, "devolucao.status", "")
+
+	var periodos []EstatisticasPeriodo
+	sim.DeveConsultar(t, &periodos, "EstatisticasDevolucao", "2017-01", "2018-12")
+	var total int64
+	for _, periodo := range periodos {
+		total += periodo.DevolucoesPorSKU["445"]["1"] + periodo.DevolucoesPorSKU["445"]["2"]
+	}
+	if total != 1 {
+		t.Fatalf("Expected the sub-order return counted once, got %+v", periodos)
+	}
+}
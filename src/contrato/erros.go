@@ -0,0 +1,33 @@
+package contrato
+
+import (
+	"errors"
+	"fmt"
+)
+
+//codigos dos erros devolvidos pelas funcoes do contrato, para os clientes nao dependerem do texto
+//das mensagens. Os erros sem codigo sao falhas internas, como um registro invalido no ledger
+const (
+	CodigoPedidoNaoEncontrado  = "PEDIDO_NAO_ENCONTRADO"
+	CodigoConflitoVersao       = "CONFLITO_VERSAO"
+	CodigoPapelNaoPermitido    = "PAPEL_NAO_PERMITIDO"
+	CodigoPrazoExcedido        = "PRAZO_EXCEDIDO"
+	CodigoNFeJaRegistrada      = "NFE_JA_REGISTRADA"
+	CodigoPedidoExistente      = "PEDIDO_EXISTENTE"
+	CodigoDisputaNaoEncontrada = "DISPUTA_NAO_ENCONTRADA"
+	// a regra do contrato nao permite a operacao no estado atual do pedido ou da disputa
+	CodigoOperacaoNaoPermitida = "OPERACAO_NAO_PERMITIDA"
+	CodigoArgumentoInvalido    = "ARGUMENTO_INVALIDO"
+)
+
+//o peer do v0.6 so repassa o texto do erro, entao o codigo vai no inicio da mensagem:
+//"codigo:PEDIDO_NAO_ENCONTRADO Pedido la1 not found"
+const PrefixoCodigo = "codigo:"
+
+func erroCodigo(codigo string, mensagem string) error {
+	return errors.New(PrefixoCodigo + codigo + " " + mensagem)
+}
+
+func erroCodigof(codigo string, formato string, args ...interface{}) error {
+	return erroCodigo(codigo, fmt.Sprintf(formato, args...))
+}
@@ -0,0 +1,182 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//prefixo dos contadores de cada periodo (AAAA-MM)
+var estatisticasPrefix = "_estatisticas_"
+
+//contadores de um mes, atualizados a cada venda, devolucao e troca
+type EstatisticasPeriodo struct {
+	Periodo                string        `json:"periodo"`
+	PedidosPorSKU          map[string]int64 `json:"pedidosPorSku"`
+	// SKU -> motivo de devolucao -> quantidade
+	DevolucoesPorSKU       map[string]map[string]int64 `json:"devolucoesPorSku"`
+	TrocasPorOpcao         map[string]int64 `json:"trocasPorOpcao"`
+	// SKU -> motivo da troca -> quantidade; os defeitos do SKU somam devolucoes e trocas com motivo 2
+	TrocasPorSKU           map[string]map[string]int64 `json:"trocasPorSku"`
+	// calculada na consulta: devolucoes / pedidos de cada SKU no periodo
+	TaxaDevolucaoPorSKU    map[string]float64 `json:"taxaDevolucaoPorSku,omitempty"`
+}
+
+//args: periodo inicial e periodo final opcional, no formato AAAA-MM
+func EstatisticasDevolucao(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering EstatisticasDevolucao")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected period (AAAA-MM) for EstatisticasDevolucao")
+	}
+	var inicio = args[0]
+	var fim = args[0]
+	if len(args) > 1 {
+		fim = args[1]
+	}
+	for _, periodo := range []string{inicio, fim} {
+		_, err := time.Parse("2006-01", periodo)
+		if err != nil {
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid period " + periodo + ", expected AAAA-MM")
+		}
+	}
+
+	iter, err := stub.RangeQueryState(estatisticasPrefix+inicio, estatisticasPrefix+fim)
+	if err != nil {
+		logger.Error("Could not query statistics", err)
+		return nil, err
+	}
+	defer iter.Close()
+
+	periodos := []EstatisticasPeriodo{}
+	for iter.HasNext() {
+		_, bytes, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		var e EstatisticasPeriodo
+		err = json.Unmarshal(bytes, &e)
+		if err != nil {
+			logger.Error("Invalid statistics format", err)
+			return nil, errors.New(" Invalid json format ")
+		}
+		e.TaxaDevolucaoPorSKU = make(map[string]float64)
+		for sku, motivos := range e.DevolucoesPorSKU {
+			var devolucoes int64
+			for _, quantidade := range motivos {
+				devolucoes += quantidade
+			}
+			if e.PedidosPorSKU[sku] > 0 {
+				e.TaxaDevolucaoPorSKU[sku] = float64(devolucoes) / float64(e.PedidosPorSKU[sku])
+			}
+		}
+		periodos = append(periodos, e)
+	}
+	return canonico.Marshal(periodos)
+}
+
+func contarPedido(stub shim.ChaincodeStubInterface, p *Pedido) error {
+	return atualizarEstatisticas(stub, p.DataVenda, func(e *EstatisticasPeriodo) {
+		for _, sku := range skusDoPedido(p) {
+			e.PedidosPorSKU[sku]++
+		}
+	})
+}
+
+//quantidade 1 para uma nova devolucao, -1 quando ela e rejeitada
+func contarDevolucao(stub shim.ChaincodeStubInterface, data int64, skus []string, motivo int, quantidade int64) error {
+	return atualizarEstatisticas(stub, data, func(e *EstatisticasPeriodo) {
+		for _, sku := range skus {
+			if e.DevolucoesPorSKU[sku] == nil {
+				e.DevolucoesPorSKU[sku] = make(map[string]int64)
+			}
+			e.DevolucoesPorSKU[sku][strconv.Itoa(motivo)] += quantidade
+		}
+	})
+}
+
+func contarTroca(stub shim.ChaincodeStubInterface, data int64, skus []string, motivo int, opcao int) error {
+	return atualizarEstatisticas(stub, data, func(e *EstatisticasPeriodo) {
+		e.TrocasPorOpcao[strconv.Itoa(opcao)]++
+		for _, sku := range skus {
+			if e.TrocasPorSKU[sku] == nil {
+				e.TrocasPorSKU[sku] = make(map[string]int64)
+			}
+			e.TrocasPorSKU[sku][strconv.Itoa(motivo)]++
+		}
+	})
+}
+
+func atualizarEstatisticas(stub shim.ChaincodeStubInterface, data int64, fn func(e *EstatisticasPeriodo)) error {
+	var periodo = time.Unix(data/1000, 0).UTC().Format("2006-01")
+	bytes, err := stub.GetState(estatisticasPrefix + periodo)
+	if err != nil {
+		logger.Error("Could not fetch statistics for "+periodo, err)
+		return err
+	}
+	e := EstatisticasPeriodo{Periodo: periodo}
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &e)
+		if err != nil {
+			logger.Error("Invalid statistics format", err)
+			return errors.New(" Invalid json format ")
+		}
+	}
+	if e.PedidosPorSKU == nil {
+		e.PedidosPorSKU = make(map[string]int64)
+	}
+	if e.DevolucoesPorSKU == nil {
+		e.DevolucoesPorSKU = make(map[string]map[string]int64)
+	}
+	if e.TrocasPorOpcao == nil {
+		e.TrocasPorOpcao = make(map[string]int64)
+	}
+	if e.TrocasPorSKU == nil {
+		e.TrocasPorSKU = make(map[string]map[string]int64)
+	}
+
+	fn(&e)
+
+	bytes, err = canonico.Marshal(&e)
+	if err != nil {
+		logger.Error("Could not marshal statistics", err)
+		return err
+	}
+	return stub.PutState(estatisticasPrefix+periodo, bytes)
+}
+
+//SKUs dos itens do marketplace ou, nos pedidos sem itens, da lista ItensId separada por ";"
+func skusDoPedido(p *Pedido) []string {
+	skus := []string{}
+	for _, item := range p.Itens {
+		skus = append(skus, item.ID)
+	}
+	if len(skus) > 0 {
+		return skus
+	}
+	for _, sku := range strings.Split(p.ItensId, ";") {
+		sku = strings.TrimSpace(sku)
+		if sku != "" {
+			skus = append(skus, sku)
+		}
+	}
+	return skus
+}
+
+//SKUs afetados pela devolucao do pedido inteiro ou do subpedido do vendedor
+func skusDaDevolucao(p *Pedido, vendedor string) []string {
+	if vendedor == "" {
+		return skusDoPedido(p)
+	}
+	sub, err := subPedidoDoVendedor(p, vendedor)
+	if err != nil {
+		return []string{}
+	}
+	return sub.ItensId
+}
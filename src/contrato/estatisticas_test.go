@@ -0,0 +1,70 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestEstatisticasDevolucao(t *testing.T) {
+	fmt.Println("Entering TestEstatisticasDevolucao")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+	deveInvocar(t, stub, "RegistrarEntrega", "la1", "1504000000000")
+	deveInvocar(t, stub, "RegistrarEntrega", "la2", "1504000000000")
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	deveInvocar(t, stub, "RegistrarArrependimento", "la1", "1504000001000", chaveNFeDevolucao)
+	deveInvocar(t, stub, "RegistrarTroca", "la2", "1504000001000", "2", "3", "35170901234567000199550010000043211000543226")
+
+	bytes, err := stub.MockQuery("EstatisticasDevolucao", []string{"2017-08", "2017-09"})
+	if err != nil {
+		t.Fatalf("Expected EstatisticasDevolucao to be invoked correctly: %s", err)
+	}
+	var periodos []EstatisticasPeriodo
+	json.Unmarshal(bytes, &periodos)
+	if len(periodos) != 1 {
+		t.Fatalf("Expected only 2017-08 to have data, got %d periods", len(periodos))
+	}
+	if periodos[0].Periodo != "2017-08" || periodos[0].PedidosPorSKU["234"] != 2 {
+		t.Fatalf("Expected two orders of SKU 234 in 2017-08")
+	}
+	if periodos[0].DevolucoesPorSKU["445"]["1"] != 1 || periodos[0].TaxaDevolucaoPorSKU["445"] != 0.5 {
+		t.Fatalf("Expected one regret return of SKU 445 out of two orders")
+	}
+	if periodos[0].TrocasPorOpcao["3"] != 1 || periodos[0].TrocasPorSKU["445"]["2"] != 1 {
+		t.Fatalf("Expected one exchange by product of defective SKU 445")
+	}
+
+	attributes["role"] = []byte(RoleLoja)
+	deveInvocar(t, stub, "RejeitarDevolucao", "la1", "1504000002000", "Produto usado")
+	bytes, _ = stub.MockQuery("EstatisticasDevolucao", []string{"2017-08"})
+	json.Unmarshal(bytes, &periodos)
+	if periodos[0].DevolucoesPorSKU["445"]["1"] != 0 {
+		t.Fatalf("Expected rejected return to be discounted")
+	}
+}
+
+func TestEstatisticasMotivoAlteradoNaDisputa(t *testing.T) {
+	fmt.Println("Entering TestEstatisticasMotivoAlteradoNaDisputa")
+	attributes := novosAtributos()
+	stub := registrarPedidoComArrependimento(t, attributes)
+
+	deveInvocar(t, stub, "AbrirDisputa", "d1", pedidoID, "1504000005000", "Produto chegou quebrado")
+	attributes["role"] = []byte(RoleMediador)
+	_, err := stub.MockInvoke("t123", "ResolverDisputa", []string{"d1", "1504000006000", ResolucaoDevolucao, "Produto com defeito", "2"})
+	if err != nil {
+		t.Fatalf("Expected mediador to resolve the disputa: %s", err)
+	}
+
+	bytes, _ := stub.MockQuery("EstatisticasDevolucao", []string{"2017-08"})
+	var periodos []EstatisticasPeriodo
+	json.Unmarshal(bytes, &periodos)
+	if len(periodos) != 1 || periodos[0].DevolucoesPorSKU["445"]["1"] != 0 || periodos[0].DevolucoesPorSKU["445"]["2"] != 1 {
+		t.Fatalf("Expected the return to move from regret to defect, got %+v", periodos)
+	}
+}
@@ -0,0 +1,67 @@
+package contrato
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//nome do evento dos invokes que gravam pedidos. O fabric v0.6 guarda um evento por transacao,
+//entao um lote vai num unico evento com todos os pedidos
+const NomeEventoPedidos = "pedidos"
+
+//payload do evento: a funcao do invoke e os pedidos como ficaram gravados no ledger, com o CPF
+//e os campos cifrados
+type EventoPedidos struct {
+	Funcao                 string        `json:"funcao"`
+	Pedidos                []json.RawMessage `json:"pedidos"`
+}
+
+//stub que guarda os pedidos gravados durante o invoke; as chaves com "_" sao indices e
+//registros auxiliares e ficam fora do evento
+type stubComEventos struct {
+	shim.ChaincodeStubInterface
+	chaves                 []string
+	gravados               map[string][]byte
+}
+
+func novoStubComEventos(stub shim.ChaincodeStubInterface) *stubComEventos {
+	return &stubComEventos{ChaincodeStubInterface: stub, chaves: []string{}, gravados: make(map[string][]byte)}
+}
+
+func (s *stubComEventos) PutState(key string, value []byte) error {
+	err := s.ChaincodeStubInterface.PutState(key, value)
+	if err != nil || strings.HasPrefix(key, "_") {
+		return err
+	}
+	if _, ok := s.gravados[key]; !ok {
+		s.chaves = append(s.chaves, key)
+	}
+	//um pedido gravado duas vezes no mesmo invoke vai no evento como ficou no fim
+	s.gravados[key] = value
+	return nil
+}
+
+//emite o evento quando o invoke gravou algum pedido
+func (s *stubComEventos) emitir(funcao string) error {
+	if len(s.chaves) == 0 {
+		return nil
+	}
+	evento := EventoPedidos{Funcao: funcao, Pedidos: []json.RawMessage{}}
+	for _, chave := range s.chaves {
+		evento.Pedidos = append(evento.Pedidos, json.RawMessage(s.gravados[chave]))
+	}
+	payload, err := canonico.Marshal(&evento)
+	if err != nil {
+		logger.Error("Could not marshal pedidos event", err)
+		return err
+	}
+	err = s.ChaincodeStubInterface.SetEvent(NomeEventoPedidos, payload)
+	if err != nil {
+		logger.Error("Could not set pedidos event", err)
+		return err
+	}
+	return nil
+}
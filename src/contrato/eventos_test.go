@@ -0,0 +1,65 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func eventosPedidosForTest(t *testing.T, payload []byte) EventoPedidos {
+	var evento EventoPedidos
+	err := json.Unmarshal(payload, &evento)
+	if err != nil {
+		t.Fatalf("Invalid pedidos event payload: %s", err)
+	}
+	return evento
+}
+
+func TestEventoPorInvoke(t *testing.T) {
+	fmt.Println("Entering TestEventoPorInvoke")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, pedidoJson)
+	sim.DeveInvocar(t, "RegistrarEntrega", pedidoID, "1504000000000")
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).DeveFalhar(t, "RegistrarArrependimento", pedidoID, "1504000000000", "123")
+
+	eventos := sim.EventosComNome(NomeEventoPedidos)
+	if len(eventos) != 2 || len(sim.Eventos) != 2 {
+		t.Fatalf("Expected one event per successful invoke, got %d", len(sim.Eventos))
+	}
+	evento := eventosPedidosForTest(t, eventos[1].Payload)
+	if evento.Funcao != "RegistrarEntrega" || len(evento.Pedidos) != 1 || eventos[1].TxID != sim.Historico[1].TxID {
+		t.Fatalf("Unexpected event %+v", evento)
+	}
+	//o evento leva o pedido exatamente como foi gravado
+	if string(evento.Pedidos[0]) != string(sim.Stub.State[pedidoID]) {
+		t.Fatalf("Expected the stored pedido in the event:\n%s\n%s", evento.Pedidos[0], sim.Stub.State[pedidoID])
+	}
+}
+
+func TestEventoDoLote(t *testing.T) {
+	fmt.Println("Entering TestEventoDoLote")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+	//lote com ID repetido nao grava nada e nao emite evento
+	sim.DeveInvocar(t, "RegistrarPedidosEmLote", loteDePedidos("la3", "la3"))
+
+	if len(sim.Eventos) != 1 {
+		t.Fatalf("Expected a single event for the batch, got %d", len(sim.Eventos))
+	}
+	evento := eventosPedidosForTest(t, sim.Eventos[0].Payload)
+	var p Pedido
+	json.Unmarshal(evento.Pedidos[1], &p)
+	if evento.Funcao != "RegistrarPedidosEmLote" || len(evento.Pedidos) != 2 || p.ID != "la2" {
+		t.Fatalf("Expected both pedidos in the batch event, got %+v", evento)
+	}
+}
+
+func TestInvokeSemPedidoNaoEmiteEvento(t *testing.T) {
+	fmt.Println("Entering TestInvokeSemPedidoNaoEmiteEvento")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, pedidoJson)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, "1504000000000", "Produto nao entregue")
+	if len(sim.Eventos) != 1 {
+		t.Fatalf("Expected no event for an invoke that writes no pedido, got %d events", len(sim.Eventos))
+	}
+}
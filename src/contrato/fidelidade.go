@@ -0,0 +1,280 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//prefixo da conta de pontos de cada cliente, pelo hash do CPF
+var fidelidadePrefix = "_fidelidade_"
+
+//pontos ganhos em um pedido; so ficam disponiveis quando acaba o prazo de arrependimento
+type AcumuloPontos struct {
+	PedidoID               string        `json:"pedidoId"`
+	DataVenda              int64         `json:"dataVenda"`
+	PontosPorItem          map[string]int64 `json:"pontosPorItem"`
+	Pontos                 int64         `json:"pontos"`
+	// pontos dos itens devolvidos por arrependimento ou por decisao de disputa
+	PontosEstornados       int64         `json:"pontosEstornados"`
+}
+
+type ResgatePontos struct {
+	Data                   int64         `json:"data"`
+	Pontos                 int64         `json:"pontos"`
+	Descricao              string        `json:"descricao"`
+}
+
+type ContaFidelidade struct {
+	CPFHash                string        `json:"cpfHash"`
+	Acumulos               []AcumuloPontos `json:"acumulos"`
+	Resgates               []ResgatePontos `json:"resgates"`
+}
+
+//saldo na data de referencia
+type SaldoFidelidade struct {
+	Disponivel             int64         `json:"disponivel"`
+	// ganhos em pedidos ainda nao entregues ou dentro do prazo de arrependimento
+	Pendente               int64         `json:"pendente"`
+	Resgatado              int64         `json:"resgatado"`
+	Estornado              int64         `json:"estornado"`
+	Conta                  ContaFidelidade `json:"conta"`
+}
+
+//args[0]: CPF do cliente
+//args[1]: data de referencia (timestamp em milissegundos)
+func SaldoPontos(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering SaldoPontos")
+
+	if len(args) < 2 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected CPF and reference timestamp")
+	}
+	cpfHash, err := hashCPFDoChamador(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	dataReferencia, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+	conta, err := lerContaFidelidade(stub, cpfHash)
+	if err != nil {
+		return nil, err
+	}
+	saldo, err := calcularSaldo(stub, conta, dataReferencia)
+	if err != nil {
+		return nil, err
+	}
+	return canonico.Marshal(saldo)
+}
+
+//args[0]: CPF do cliente, que tem que ser o do atributo cpfHash do chamador
+//args[1]: timestamp do resgate, nao posterior ao da transacao
+//args[2]: quantidade de pontos
+//args[3]: descricao opcional do que foi resgatado
+func ResgatarPontos(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ResgatarPontos")
+
+	if len(args) < 3 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected CPF, timestamp and pontos for ResgatarPontos")
+	}
+	err := exigirPapel(stub, RoleCliente)
+	if err != nil {
+		return nil, err
+	}
+	cpfHash, err := hashCPFDoChamador(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = exigirTitular(stub, cpfHash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+	//os pontos liberados sao calculados no timestamp da transacao, que o cliente nao escolhe
+	agora := timestampTransacao(stub)
+	if agora == 0 {
+		logger.Error("Missing transaction timestamp")
+		return nil, errors.New("Transaction timestamp not available to release loyalty points")
+	}
+	if data > agora {
+		logger.Error("Redeem timestamp after the transaction timestamp")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Redeem timestamp can not be after the transaction timestamp")
+	}
+	pontos, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || pontos <= 0 {
+		logger.Error("Invalid pontos " + args[2])
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Pontos must be a positive number")
+	}
+	var descricao = ""
+	if len(args) > 3 {
+		descricao = args[3]
+	}
+
+	conta, err := lerContaFidelidade(stub, cpfHash)
+	if err != nil {
+		return nil, err
+	}
+	saldo, err := calcularSaldo(stub, conta, agora)
+	if err != nil {
+		return nil, err
+	}
+	if saldo.Disponivel < pontos {
+		logger.Error("Insufficient loyalty points")
+		return nil, erroCodigo(CodigoOperacaoNaoPermitida, "Only " + strconv.FormatInt(saldo.Disponivel, 10) + " points available")
+	}
+	conta.Resgates = append(conta.Resgates, ResgatePontos{data, pontos, descricao})
+	err = gravarContaFidelidade(stub, conta)
+	if err != nil {
+		return nil, err
+	}
+	saldo.Disponivel -= pontos
+	saldo.Resgatado += pontos
+	saldo.Conta = *conta
+	return canonico.Marshal(saldo)
+}
+
+//credita os pontos do pedido novo na conta do cliente, ainda pendentes
+func acumularPontos(stub shim.ChaincodeStubInterface, p *Pedido) error {
+	if p.CPFHash == "" {
+		return nil
+	}
+	configuracao, err := lerConfiguracao(stub)
+	if err != nil {
+		return err
+	}
+	acumulo := AcumuloPontos{PedidoID: p.ID, DataVenda: p.DataVenda, PontosPorItem: make(map[string]int64)}
+	for _, item := range itensDoPedido(p) {
+		pontos := pontosDoItem(configuracao, item)
+		acumulo.PontosPorItem[item.ID] += pontos
+		acumulo.Pontos += pontos
+	}
+	if acumulo.Pontos == 0 {
+		return nil
+	}
+	conta, err := lerContaFidelidade(stub, p.CPFHash)
+	if err != nil {
+		return err
+	}
+	conta.Acumulos = append(conta.Acumulos, acumulo)
+	return gravarContaFidelidade(stub, conta)
+}
+
+//estorna (sinal 1) ou devolve (sinal -1) os pontos dos SKUs devolvidos do pedido
+func estornarPontos(stub shim.ChaincodeStubInterface, cpfHash string, pedidoID string, skus []string, sinal int64) error {
+	if cpfHash == "" {
+		return nil
+	}
+	conta, err := lerContaFidelidade(stub, cpfHash)
+	if err != nil {
+		return err
+	}
+	for i := range conta.Acumulos {
+		acumulo := &conta.Acumulos[i]
+		if acumulo.PedidoID != pedidoID {
+			continue
+		}
+		vistos := make(map[string]bool)
+		for _, sku := range skus {
+			if !vistos[sku] {
+				vistos[sku] = true
+				acumulo.PontosEstornados += sinal * acumulo.PontosPorItem[sku]
+			}
+		}
+		if acumulo.PontosEstornados < 0 {
+			acumulo.PontosEstornados = 0
+		}
+		if acumulo.PontosEstornados > acumulo.Pontos {
+			acumulo.PontosEstornados = acumulo.Pontos
+		}
+		return gravarContaFidelidade(stub, conta)
+	}
+	return nil
+}
+
+func calcularSaldo(stub shim.ChaincodeStubInterface, conta *ContaFidelidade, dataReferencia int64) (*SaldoFidelidade, error) {
+	configuracao, err := lerConfiguracao(stub)
+	if err != nil {
+		return nil, err
+	}
+	saldo := SaldoFidelidade{Conta: *conta}
+	for _, acumulo := range conta.Acumulos {
+		bytes, err := stub.GetState(acumulo.PedidoID)
+		if err != nil {
+			logger.Error("Could not fetch pedido "+acumulo.PedidoID, err)
+			return nil, err
+		}
+		var pe Pedido
+		if bytes != nil {
+			err = decodificarPedido(bytes, &pe)
+			if err != nil {
+				logger.Error("Invalid format for pedido "+acumulo.PedidoID, err)
+				return nil, errors.New(" Invalid json format ")
+			}
+		}
+		liquido := acumulo.Pontos - acumulo.PontosEstornados
+		saldo.Estornado += acumulo.PontosEstornados
+		//liberados somente depois do prazo de arrependimento contado da entrega
+		if pe.DataEntrega != 0 && dataReferencia > pe.DataEntrega+configuracao.PrazoArrependimento {
+			saldo.Disponivel += liquido
+		} else {
+			saldo.Pendente += liquido
+		}
+	}
+	for _, resgate := range conta.Resgates {
+		saldo.Resgatado += resgate.Pontos
+	}
+	saldo.Disponivel -= saldo.Resgatado
+	//pontos estornados depois de resgatados (devolucao forcada em disputa) consomem os pendentes;
+	//o saldo nunca fica negativo
+	if saldo.Disponivel < 0 {
+		saldo.Pendente += saldo.Disponivel
+		saldo.Disponivel = 0
+		if saldo.Pendente < 0 {
+			saldo.Pendente = 0
+		}
+	}
+	return &saldo, nil
+}
+
+func lerContaFidelidade(stub shim.ChaincodeStubInterface, cpfHash string) (*ContaFidelidade, error) {
+	conta := ContaFidelidade{CPFHash: cpfHash, Acumulos: []AcumuloPontos{}, Resgates: []ResgatePontos{}}
+	bytes, err := stub.GetState(fidelidadePrefix + cpfHash)
+	if err != nil {
+		logger.Error("Could not fetch loyalty account", err)
+		return nil, err
+	}
+	if bytes == nil {
+		return &conta, nil
+	}
+	err = json.Unmarshal(bytes, &conta)
+	if err != nil {
+		logger.Error("Invalid format for loyalty account", err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	return &conta, nil
+}
+
+func gravarContaFidelidade(stub shim.ChaincodeStubInterface, conta *ContaFidelidade) error {
+	bytes, err := canonico.Marshal(conta)
+	if err != nil {
+		logger.Error("Could not marshal loyalty account", err)
+		return err
+	}
+	err = stub.PutState(fidelidadePrefix+conta.CPFHash, bytes)
+	if err != nil {
+		logger.Error("Could not save loyalty account", err)
+		return err
+	}
+	return nil
+}
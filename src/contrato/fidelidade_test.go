@@ -0,0 +1,140 @@
+package contrato
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+var configuracaoPontos = `{"pontosPadrao":10,"pontosPorItem":{"445":50}}`
+
+func saldoPontosForTest(t *testing.T, stub *shim.MockStub, data string) SaldoFidelidade {
+	bytes, err := stub.MockQuery("SaldoPontos", []string{"095.963.977-29", data})
+	if err != nil {
+		t.Fatalf("Expected SaldoPontos to be invoked correctly: %s", err)
+	}
+	var saldo SaldoFidelidade
+	json.Unmarshal(bytes, &saldo)
+	return saldo
+}
+
+//cpfHash do CPF de pedidoJson com a chave de indice de novosAtributos, como a loja grava no
+//certificado do cliente
+func cpfHashForTest() string {
+	chave, _ := hex.DecodeString(string(novosAtributos()["chaveIndiceCPF"]))
+	return hashCPF(chave, "09596397729")
+}
+
+func TestPontosLiberadosAposArrependimento(t *testing.T) {
+	fmt.Println("Entering TestPontosLiberadosAposArrependimento")
+	sim := novoSimulador()
+	if r := sim.Init(configuracaoPontos); r.Err != nil {
+		t.Fatalf("Expected init to succeed: %s", r.Err)
+	}
+	sim.PedidoRegistrado(t, pedidoID, pedidoJson)
+
+	saldo := saldoPontosForTest(t, sim.Stub, "1504000000000")
+	if saldo.Pendente != 60 || saldo.Disponivel != 0 {
+		t.Fatalf("Expected 60 pending points before delivery, got %+v", saldo)
+	}
+
+	sim.DeveInvocar(t, "RegistrarEntrega", pedidoID, sim.Relogio.Texto())
+	entrega := sim.Relogio.Agora()
+	saldo = saldoPontosForTest(t, sim.Stub, strconv.FormatInt(entrega+100000000, 10))
+	if saldo.Pendente != 60 {
+		t.Fatalf("Expected points still pending within the regret window")
+	}
+	saldo = saldoPontosForTest(t, sim.Stub, strconv.FormatInt(entrega+1000000000, 10))
+	if saldo.Disponivel != 60 || saldo.Pendente != 0 {
+		t.Fatalf("Expected points released after the regret window, got %+v", saldo)
+	}
+
+	//dentro do prazo de arrependimento uma data futura no argumento nao libera os pontos
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveFalhar(t, "ResgatarPontos", "09596397729", strconv.FormatInt(entrega+1000000000, 10), "40")
+	sim.DeveFalhar(t, "ResgatarPontos", "09596397729", sim.Relogio.Texto(), "40")
+
+	sim.Relogio.Avancar(8 * simulador.Dia)
+	sim.DeveFalhar(t, "ResgatarPontos", "09596397729", sim.Relogio.Texto(), "100")
+	sim.DeveInvocar(t, "ResgatarPontos", "09596397729", sim.Relogio.Texto(), "40", "Cupom")
+	saldo = saldoPontosForTest(t, sim.Stub, sim.Relogio.Texto())
+	if saldo.Disponivel != 20 || saldo.Resgatado != 40 {
+		t.Fatalf("Expected 20 points left after redeeming 40, got %+v", saldo)
+	}
+}
+
+func TestResgatarPontosDeOutroCliente(t *testing.T) {
+	fmt.Println("Entering TestResgatarPontosDeOutroCliente")
+	sim := novoSimulador()
+	if r := sim.Init(configuracaoPontos); r.Err != nil {
+		t.Fatalf("Expected init to succeed: %s", r.Err)
+	}
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+	sim.Relogio.Avancar(8 * simulador.Dia)
+
+	sim.ComoPapel(RoleCliente)
+	err := sim.DeveFalhar(t, "ResgatarPontos", "09596397729", sim.Relogio.Texto(), "10")
+	if err.Error() != erroCodigo(CodigoPapelNaoPermitido, "Caller is not the customer of this CPF").Error() {
+		t.Fatalf("Expected redeem without the cpfHash attribute to fail, got %s", err)
+	}
+	sim.ComAtributo("cpfHash", "outro")
+	sim.DeveFalhar(t, "ResgatarPontos", "09596397729", sim.Relogio.Texto(), "10")
+	var conta ContaFidelidade
+	sim.Estado(t, fidelidadePrefix+cpfHashForTest(), &conta)
+	if len(conta.Resgates) != 0 {
+		t.Fatalf("Expected no redeem recorded, got %+v", conta.Resgates)
+	}
+}
+
+func TestPontosEstornadosNoArrependimento(t *testing.T) {
+	fmt.Println("Entering TestPontosEstornadosNoArrependimento")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	_, err := stub.MockInit("t123", "init", []string{configuracaoPontos})
+	if err != nil {
+		t.Fatalf("Expected Init to accept the configuracao: %s", err)
+	}
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504000000000")
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	deveInvocar(t, stub, "RegistrarArrependimento", pedidoID, "1504000001000", chaveNFeDevolucao)
+	saldo := saldoPontosForTest(t, stub, "1505000000000")
+	if saldo.Estornado != 60 || saldo.Disponivel != 0 {
+		t.Fatalf("Expected all points reversed by the regret, got %+v", saldo)
+	}
+
+	attributes["role"] = []byte(RoleLoja)
+	deveInvocar(t, stub, "RejeitarDevolucao", pedidoID, "1504000002000", "Produto usado")
+	saldo = saldoPontosForTest(t, stub, "1505000000000")
+	if saldo.Estornado != 0 || saldo.Disponivel != 60 {
+		t.Fatalf("Expected points back after the return was rejected, got %+v", saldo)
+	}
+}
+
+func TestDisputaEstornaPontosResgatados(t *testing.T) {
+	fmt.Println("Entering TestDisputaEstornaPontosResgatados")
+	sim := novoSimulador()
+	if r := sim.Init(configuracaoPontos); r.Err != nil {
+		t.Fatalf("Expected init to succeed: %s", r.Err)
+	}
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+	sim.Relogio.Avancar(8 * simulador.Dia)
+	sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest())
+	sim.DeveInvocar(t, "ResgatarPontos", "09596397729", sim.Relogio.Texto(), "40")
+
+	//defeito reconhecido em disputa depois do resgate: os pontos do pedido sao estornados e o
+	//saldo fica zerado, nao negativo
+	sim.DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Produto com defeito")
+	sim.ComoPapel(RoleMediador).DeveInvocar(t, "ResolverDisputa", "d1", sim.Relogio.Texto(), ResolucaoDevolucao, "Defeito comprovado", "2")
+	saldo := saldoPontosForTest(t, sim.Stub, sim.Relogio.Texto())
+	if saldo.Estornado != 60 || saldo.Disponivel != 0 || saldo.Pendente != 0 || saldo.Resgatado != 40 {
+		t.Fatalf("Expected the dispute to reverse the points without a negative balance, got %+v", saldo)
+	}
+}
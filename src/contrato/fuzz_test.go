@@ -0,0 +1,126 @@
+//go:build go1.18
+// +build go1.18
+
+package contrato
+
+//alvos de fuzzing (go test -fuzz=FuzzRegistrarPedido). Precisam do Go 1.18; com o Go 1.6 do
+//chaincode este arquivo e ignorado e os testes de propriedades cobrem as sequencias de invokes
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func FuzzDecodificarPedido(f *testing.F) {
+	f.Add([]byte(pedidoJson))
+	f.Add([]byte(`{"id":"v0","devolucao":{"devolvido":2},"subPedidos":[{"devolucao":{"devolvido":1}}]}`))
+	f.Add([]byte(`{"versaoSchema":99}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, bytes []byte) {
+		var p Pedido
+		if decodificarPedido(bytes, &p) != nil {
+			return
+		}
+		if p.VersaoSchema != versaoSchemaAtual {
+			t.Fatalf("Expected decoded pedido in the current schema, got %d", p.VersaoSchema)
+		}
+		//o que foi decodificado e gravado de novo deve ser lido igual
+		gravado, err := json.Marshal(&p)
+		if err != nil {
+			t.Fatalf("Could not marshal decoded pedido: %s", err)
+		}
+		var relido Pedido
+		err = decodificarPedido(gravado, &relido)
+		if err != nil {
+			t.Fatalf("Could not decode rewritten pedido: %s", err)
+		}
+		regravado, _ := json.Marshal(&relido)
+		if string(regravado) != string(gravado) {
+			t.Fatalf("Decoding is not stable:\n%s\n%s", gravado, regravado)
+		}
+	})
+}
+
+func FuzzRegistrarPedido(f *testing.F) {
+	f.Add(pedidoID, pedidoJson)
+	f.Add("_pedidoindex", pedidoJson)
+	f.Add("la2", `{"dataVenda":1,"dataPrazoEntrega":0}`)
+	f.Add("la3", `{"id":"outro","dataVenda":1503849607000,"dataPrazoEntrega":1504454407000,"chaveNFe":"35170801234567000199550010000012341000123451"}`)
+	f.Fuzz(func(t *testing.T, id string, pedido string) {
+		stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), novosAtributos())
+		_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{id, pedido})
+		if err != nil {
+			return
+		}
+		bytes, _ := stub.GetState(id)
+		var p Pedido
+		err = json.Unmarshal(bytes, &p)
+		if err != nil {
+			t.Fatalf("Stored pedido is not valid JSON: %s", err)
+		}
+		if p.ID != id {
+			t.Fatalf("Stored id %q differs from key %q", p.ID, id)
+		}
+		if p.Versao != 1 || p.DataPrazoEntrega < p.DataVenda {
+			t.Fatalf("Accepted invalid pedido %+v", p)
+		}
+	})
+}
+
+func FuzzRegistrarEntregaTimestamp(f *testing.F) {
+	f.Add("1504000000000")
+	f.Add("-1")
+	f.Add("9223372036854775808")
+	f.Add(" 1504000000000")
+	f.Add("1e12")
+	f.Add("versao=1")
+	f.Fuzz(func(t *testing.T, data string) {
+		stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), novosAtributos())
+		deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+		antes, _ := stub.GetState(pedidoID)
+
+		_, err := stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, data})
+		depois, _ := stub.GetState(pedidoID)
+		if err != nil {
+			if string(antes) != string(depois) {
+				t.Fatalf("Failed RegistrarEntrega changed the pedido")
+			}
+			return
+		}
+		esperado, err := strconv.ParseInt(data, 10, 64)
+		if err != nil {
+			t.Fatalf("Accepted invalid timestamp %q", data)
+		}
+		var p Pedido
+		json.Unmarshal(depois, &p)
+		if p.DataEntrega != esperado {
+			t.Fatalf("Expected DataEntrega %d, got %d", esperado, p.DataEntrega)
+		}
+	})
+}
+
+func FuzzExtrairVersaoEsperada(f *testing.F) {
+	f.Add("versao=3")
+	f.Add("versao=0")
+	f.Add("versao=-1")
+	f.Add("versao=")
+	f.Add("1504000000000")
+	f.Fuzz(func(t *testing.T, ultimo string) {
+		args, versao, err := extrairVersaoEsperada([]string{pedidoID, ultimo})
+		if err != nil {
+			return
+		}
+		if versao < 0 {
+			t.Fatalf("Negative version %d from %q", versao, ultimo)
+		}
+		if versao == 0 && len(args) != 2 {
+			t.Fatalf("Argument %q dropped without a version", ultimo)
+		}
+		if versao > 0 && (len(args) != 1 || args[0] != pedidoID) {
+			t.Fatalf("Expected only the version to be removed from %q", ultimo)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package contrato
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//resultado de um item de uma operacao em lote
+type ResultadoLote struct {
+	ID                     string        `json:"id"`
+	Sucesso                bool          `json:"sucesso"`
+	Erro                   string        `json:"erro,omitempty"`
+}
+
+//item do manifesto de entregas da transportadora
+type EntregaLote struct {
+	PedidoID               string        `json:"pedidoId"`
+	Data                   int64         `json:"data"`
+	// hash do comprovante de entrega
+	Comprovante            string        `json:"comprovante"`
+	Vendedor               string        `json:"vendedor"`
+	// versao esperada do pedido, como no "versao=N" do RegistrarEntrega; 0 nao verifica
+	Versao                 int64         `json:"versao"`
+}
+
+//modos do RegistrarEntregasEmLote
+const (
+	ModoLoteAtomico = "atomico"
+	ModoLoteParcial = "parcial"
+)
+
+type RelatorioLote struct {
+	// false quando nada foi gravado
+	Gravado                bool          `json:"gravado"`
+	Resultados             []ResultadoLote `json:"resultados"`
+}
+
+//args[0]: array JSON de pedidos, cada um com o seu "id". Todos sao validados antes
+//da gravacao; se algum for invalido nenhum e gravado e o relatorio indica o erro de cada um
+func RegistrarPedidosEmLote(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering RegistrarPedidosEmLote")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected a JSON array of pedidos for RegistrarPedidosEmLote")
+	}
+
+	var entradas []json.RawMessage
+	err := json.Unmarshal([]byte(args[0]), &entradas)
+	if err != nil {
+		logger.Error("Invalid format", err)
+		return nil, erroCodigo(CodigoArgumentoInvalido, " Invalid json format, expected an array of pedidos ")
+	}
+	if len(entradas) == 0 {
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Empty batch")
+	}
+
+	relatorio := RelatorioLote{Gravado: true, Resultados: []ResultadoLote{}}
+	pedidos := []*Pedido{}
+	ids := make(map[string]bool)
+	chavesNFe := make(map[string]bool)
+	for _, entrada := range entradas {
+		var identificacao struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(entrada, &identificacao)
+		resultado := ResultadoLote{ID: identificacao.ID, Sucesso: true}
+
+		pe, err := prepararPedido(stub, identificacao.ID, entrada)
+		if err == nil && ids[pe.ID] {
+			err = erroCodigo(CodigoArgumentoInvalido, "Duplicated pedido ID in batch")
+		}
+		if err == nil && chavesNFe[pe.ChaveNFe] {
+			err = erroCodigo(CodigoNFeJaRegistrada, "Duplicated NF-e key in batch")
+		}
+		if err != nil {
+			resultado.Sucesso = false
+			resultado.Erro = err.Error()
+			relatorio.Gravado = false
+		} else {
+			ids[pe.ID] = true
+			chavesNFe[pe.ChaveNFe] = true
+			pedidos = append(pedidos, pe)
+		}
+		relatorio.Resultados = append(relatorio.Resultados, resultado)
+	}
+
+	if relatorio.Gravado {
+		for _, pe := range pedidos {
+			_, err = gravarPedido(stub, pe)
+			if err != nil {
+				return nil, err
+			}
+		}
+		logger.Info("Successfully saved batch of Pedidos")
+	} else {
+		logger.Warning("Batch of Pedidos rejected, nothing was saved")
+	}
+
+	return canonico.Marshal(&relatorio)
+}
+
+//args[0]: array JSON de EntregaLote; args[1]: "atomico" (padrao), nada e gravado se alguma
+//entrega for invalida, ou "parcial", grava as validas e informa o erro das demais
+func RegistrarEntregasEmLote(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering RegistrarEntregasEmLote")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of args")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected a JSON array of entregas for RegistrarEntregasEmLote")
+	}
+	//os mesmos papeis do RegistrarEntrega
+	err := exigirPapel(stub, papeisEntrega...)
+	if err != nil {
+		return nil, err
+	}
+	vendedorChamador, err := vendedorDoChamador(stub)
+	if err != nil {
+		return nil, err
+	}
+	var modo = ModoLoteAtomico
+	if len(args) > 1 && args[1] != "" {
+		modo = args[1]
+	}
+	if modo != ModoLoteAtomico && modo != ModoLoteParcial {
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid mode " + modo + ", expected atomico or parcial")
+	}
+
+	var entregas []EntregaLote
+	err = json.Unmarshal([]byte(args[0]), &entregas)
+	if err != nil {
+		logger.Error("Invalid format", err)
+		return nil, erroCodigo(CodigoArgumentoInvalido, " Invalid json format, expected an array of entregas ")
+	}
+	if len(entregas) == 0 {
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Empty batch")
+	}
+
+	relatorio := RelatorioLote{Gravado: true, Resultados: []ResultadoLote{}}
+
+	if modo == ModoLoteAtomico {
+		for _, entrega := range entregas {
+			resultado := ResultadoLote{ID: entrega.PedidoID, Sucesso: true}
+			err := validarEntregaLote(entrega)
+			if err == nil {
+				err = simularAtualizacao(stub, entrega.PedidoID, entrega.Versao, funcaoEntrega(entrega.Data, entrega.Vendedor, vendedorChamador, entrega.Comprovante))
+			}
+			if err != nil {
+				resultado.Sucesso = false
+				resultado.Erro = err.Error()
+				relatorio.Gravado = false
+			}
+			relatorio.Resultados = append(relatorio.Resultados, resultado)
+		}
+		if !relatorio.Gravado {
+			logger.Warning("Batch of entregas rejected, nothing was saved")
+			return canonico.Marshal(&relatorio)
+		}
+	}
+
+	relatorio.Resultados = []ResultadoLote{}
+	for i, entrega := range entregas {
+		resultado := ResultadoLote{ID: entrega.PedidoID, Sucesso: true}
+		err := validarEntregaLote(entrega)
+		if err == nil {
+			_, err = AtualizarPedidoVersao(stub, entrega.PedidoID, entrega.Versao, funcaoEntrega(entrega.Data, entrega.Vendedor, vendedorChamador, entrega.Comprovante))
+		}
+		if err != nil {
+			if modo == ModoLoteAtomico {
+				logger.Error("Could not save entrega "+strconv.Itoa(i)+" of atomic batch", err)
+				return nil, err
+			}
+			resultado.Sucesso = false
+			resultado.Erro = err.Error()
+		}
+		relatorio.Resultados = append(relatorio.Resultados, resultado)
+	}
+	logger.Info("Successfully saved batch of entregas")
+	return canonico.Marshal(&relatorio)
+}
+
+func validarEntregaLote(entrega EntregaLote) error {
+	if entrega.PedidoID == "" {
+		return erroCodigo(CodigoArgumentoInvalido, "Missing pedidoId")
+	}
+	if entrega.Data <= 0 {
+		return erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+	if entrega.Versao < 0 {
+		return erroCodigo(CodigoArgumentoInvalido, "Invalid versao value")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func loteDePedidos(ids ...string) string {
+	pedidos := []string{}
+	for i, id := range ids {
+		//cada pedido com uma NF-e valida diferente
+		nfe := []string{"0123451", "0123460"}[i%2]
+		pedidos = append(pedidos, strings.Replace(strings.Replace(pedidoJson, "{", `{"id": "`+id+`", `, 1), "0123451", nfe, 1))
+	}
+	return "[" + strings.Join(pedidos, ",") + "]"
+}
+
+func TestRegistrarPedidosEmLote(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidosEmLote")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	bytes, err := stub.MockInvoke("t123", "RegistrarPedidosEmLote", []string{loteDePedidos("la1", "la2")})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedidosEmLote to be invoked: %s", err)
+	}
+	var relatorio RelatorioLote
+	json.Unmarshal(bytes, &relatorio)
+	if !relatorio.Gravado || len(relatorio.Resultados) != 2 {
+		t.Fatalf("Expected both pedidos to be saved")
+	}
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, "la2", &pe)
+	if pe.ID != "la2" || pe.CPFHash == "" {
+		t.Fatalf("Expected la2 to be saved with the same rules as RegistrarPedido")
+	}
+}
+
+func TestRegistrarPedidosEmLoteTudoOuNada(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidosEmLoteTudoOuNada")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	//la1 repetido no lote: nenhum pedido deve ser gravado
+	bytes, err := stub.MockInvoke("t123", "RegistrarPedidosEmLote", []string{loteDePedidos("la1", "la2", "la1")})
+	if err != nil {
+		t.Fatalf("Expected a report instead of an error: %s", err)
+	}
+	var relatorio RelatorioLote
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Gravado || !relatorio.Resultados[0].Sucesso || relatorio.Resultados[2].Sucesso {
+		t.Fatalf("Expected only the third item to fail and nothing to be saved")
+	}
+
+	bytes, _ = stub.GetState("la1")
+	if bytes != nil {
+		t.Fatalf("No pedido should be saved when the batch is invalid")
+	}
+}
+
+func TestRegistrarPedidosEmLoteExistente(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidosEmLoteExistente")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedidosEmLote", []string{loteDePedidos("la1")})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedidosEmLote to be invoked: %s", err)
+	}
+	//la1 ja gravado: o lote nao pode sobrescrever
+	bytes, err := stub.MockInvoke("t123", "RegistrarPedidosEmLote", []string{loteDePedidos("la1", "la2")})
+	if err != nil {
+		t.Fatalf("Expected a report instead of an error: %s", err)
+	}
+	var relatorio RelatorioLote
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Gravado || relatorio.Resultados[0].Sucesso || !strings.Contains(relatorio.Resultados[0].Erro, "already exists") || !relatorio.Resultados[1].Sucesso {
+		t.Fatalf("Expected the existing pedido to fail the batch, got %+v", relatorio)
+	}
+	bytes, _ = stub.GetState("la2")
+	if bytes != nil {
+		t.Fatalf("No pedido should be saved when the batch is invalid")
+	}
+}
+
+func TestRegistrarEntregasEmLote(t *testing.T) {
+	fmt.Println("Entering TestRegistrarEntregasEmLote")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+
+	manifesto := `[{"pedidoId": "la1", "data": 1504000000000, "comprovante": "a1b2"}, {"pedidoId": "la3", "data": 1504000000000, "comprovante": "c3d4"}, {"pedidoId": "la2", "data": 1504000001000, "comprovante": "e5f6"}]`
+
+	bytes, err := stub.MockInvoke("t123", "RegistrarEntregasEmLote", []string{manifesto, "atomico"})
+	if err != nil {
+		t.Fatalf("Expected a report instead of an error: %s", err)
+	}
+	var relatorio RelatorioLote
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Gravado || relatorio.Resultados[1].Sucesso {
+		t.Fatalf("Expected atomic batch to be rejected because of la3")
+	}
+	var pe Pedido
+	ObterPedidoForTest(t, stub, "la1", &pe)
+	if pe.DataEntrega != 0 {
+		t.Fatalf("No entrega should be saved in a rejected atomic batch")
+	}
+
+	bytes, err = stub.MockInvoke("t123", "RegistrarEntregasEmLote", []string{manifesto, "parcial"})
+	if err != nil {
+		t.Fatalf("Expected partial batch to be saved: %s", err)
+	}
+	json.Unmarshal(bytes, &relatorio)
+	if !relatorio.Resultados[0].Sucesso || relatorio.Resultados[1].Sucesso || !relatorio.Resultados[2].Sucesso {
+		t.Fatalf("Expected only la3 to fail in partial mode")
+	}
+	ObterPedidoForTest(t, stub, "la2", &pe)
+	if pe.DataEntrega != 1504000001000 || pe.ComprovanteEntrega != "e5f6" {
+		t.Fatalf("Expected la2 delivery with proof hash")
+	}
+}
+
+func TestRegistrarEntregasEmLoteComVersao(t *testing.T) {
+	fmt.Println("Entering TestRegistrarEntregasEmLoteComVersao")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+
+	attributes["role"] = []byte(RoleCliente)
+	_, err := stub.MockInvoke("t123", "RegistrarEntregasEmLote", []string{`[{"pedidoId": "la1", "data": 1504000000000}]`})
+	if err == nil || err.Error() != erroCodigo(CodigoPapelNaoPermitido, "Caller role not allowed for this operation").Error() {
+		t.Fatalf("Expected cliente to be denied RegistrarEntregasEmLote, got %v", err)
+	}
+
+	//a simulacao do modo atomico confere a versao como a gravacao
+	attributes["role"] = []byte(RoleTransportadora)
+	manifesto := `[{"pedidoId": "la1", "data": 1504000000000, "versao": 1}, {"pedidoId": "la2", "data": 1504000000000, "versao": 2}]`
+	bytes := deveInvocar(t, stub, "RegistrarEntregasEmLote", manifesto)
+	var relatorio RelatorioLote
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Gravado || !relatorio.Resultados[0].Sucesso || !strings.Contains(relatorio.Resultados[1].Erro, CodigoConflitoVersao) {
+		t.Fatalf("Expected atomic batch to be rejected by the version of la2, got %+v", relatorio)
+	}
+	var pe Pedido
+	ObterPedidoForTest(t, stub, "la1", &pe)
+	if pe.DataEntrega != 0 {
+		t.Fatalf("No entrega should be saved in a rejected atomic batch")
+	}
+
+	manifesto = `[{"pedidoId": "la1", "data": 1504000000000, "versao": 1}, {"pedidoId": "la2", "data": 1504000000000, "versao": 1}]`
+	bytes = deveInvocar(t, stub, "RegistrarEntregasEmLote", manifesto)
+	json.Unmarshal(bytes, &relatorio)
+	if !relatorio.Gravado {
+		t.Fatalf("Expected the batch of the transportadora to be saved, got %+v", relatorio)
+	}
+	ObterPedidoForTest(t, stub, "la2", &pe)
+	if pe.DataEntrega != 1504000000000 || pe.Versao != 2 {
+		t.Fatalf("Expected la2 delivered at version 2, got %+v", pe)
+	}
+}
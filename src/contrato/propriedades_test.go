@@ -0,0 +1,109 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+//quantidade de sequencias aleatorias e de invokes em cada uma
+var sequenciasPropriedades = 200
+var passosPorSequencia = 40
+
+var idsPropriedades = []string{"pa", "pb", "pc"}
+
+//um invoke aleatorio sobre um dos pedidos, com datas proximas da data da venda
+func invokeAleatorio(sim *simuladortest.Simulador, r *rand.Rand, notas *int) {
+	id := idsPropriedades[r.Intn(len(idsPropriedades))]
+	//ate 15 dias antes ou depois da venda, para cair dentro e fora dos prazos
+	data := strconv.FormatInt(1503849607000+int64(r.Intn(30*24)-15*24)*3600000, 10)
+	proximaNota := func() string {
+		*notas++
+		return simulador.ChaveNFe(*notas)
+	}
+	switch r.Intn(9) {
+	case 0:
+		pedido := strings.Replace(pedidoJson, "35170801234567000199550010000012341000123451", proximaNota(), 1)
+		sim.ComoPapel(RoleLoja).Invocar("RegistrarPedido", id, pedido)
+	case 1, 2:
+		sim.ComoPapel(RoleLoja).Invocar("RegistrarEntrega", id, data)
+	case 3:
+		sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).Invocar("RegistrarArrependimento", id, data, proximaNota())
+	case 4:
+		motivo := strconv.Itoa(1 + r.Intn(2))
+		opcao := strconv.Itoa(1 + r.Intn(3))
+		sim.ComoPapel(RoleCliente).ComAtributo("cpfHash", cpfHashForTest()).Invocar("RegistrarTroca", id, data, motivo, opcao, proximaNota())
+	case 5:
+		sim.ComoPapel(RoleLoja).Invocar("AprovarDevolucao", id, data)
+	case 6:
+		sim.ComoPapel(RoleLoja).Invocar("RejeitarDevolucao", id, data, "Produto usado")
+	case 7:
+		sim.ComoPapel(RoleLoja).Invocar("RegistrarRecebimentoDevolucao", id, data)
+	case 8:
+		sim.ComoPapel(RoleFinanceiro).Invocar("RegistrarReembolso", id, data)
+	}
+}
+
+//invariantes que todo pedido gravado deve respeitar depois de qualquer sequencia de invokes
+func verificarInvariantes(sim *simuladortest.Simulador, id string) error {
+	bytes := sim.Stub.State[id]
+	if bytes == nil {
+		return nil
+	}
+	var bruto map[string]interface{}
+	err := json.Unmarshal(bytes, &bruto)
+	if err != nil {
+		return fmt.Errorf("stored pedido is not JSON: %s", err)
+	}
+	if bruto["id"] != id {
+		return fmt.Errorf("stored id %v differs from key %s", bruto["id"], id)
+	}
+	var p Pedido
+	err = decodificarPedido(bytes, &p)
+	if err != nil {
+		return err
+	}
+	if p.Devolucao.Status != "" && p.DataEntrega == 0 {
+		return fmt.Errorf("returned pedido without DataEntrega")
+	}
+	if p.Devolucao.Status != "" && p.Devolucao.Data < p.DataEntrega {
+		return fmt.Errorf("return date %d precedes delivery %d", p.Devolucao.Data, p.DataEntrega)
+	}
+	if p.Troca.Data != 0 && p.Troca.Data < p.DataEntrega {
+		return fmt.Errorf("exchange date %d precedes delivery %d", p.Troca.Data, p.DataEntrega)
+	}
+	for i, etapa := range p.Devolucao.Historico {
+		if i > 0 && etapa.Data < p.Devolucao.Historico[i-1].Data {
+			return fmt.Errorf("return history out of order")
+		}
+	}
+	if p.Versao < 1 || p.VersaoSchema != versaoSchemaAtual {
+		return fmt.Errorf("invalid versao %d or schema %d", p.Versao, p.VersaoSchema)
+	}
+	return nil
+}
+
+func TestPropriedadesSequenciasAleatorias(t *testing.T) {
+	fmt.Println("Entering TestPropriedadesSequenciasAleatorias")
+	for semente := 1; semente <= sequenciasPropriedades; semente++ {
+		r := rand.New(rand.NewSource(int64(semente)))
+		sim := novoSimulador()
+		notas := 0
+		for passo := 0; passo < passosPorSequencia; passo++ {
+			invokeAleatorio(sim, r, &notas)
+			for _, id := range idsPropriedades {
+				err := verificarInvariantes(sim, id)
+				if err != nil {
+					ultimo := sim.Historico[len(sim.Historico)-1]
+					t.Fatalf("Seed %d, step %d, after %s: pedido %s: %s", semente, passo, ultimo.Funcao, id, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+	"github.com/rodneicouto/chaincode/src/recibo"
+)
+
+//prefixo do registro da ultima transacao que gravou cada pedido
+var escritaPrefix = "_escrita_"
+
+//ultima transacao que gravou o pedido e o hash canonico do que ela gravou
+type Escrita struct {
+	TxID                   string        `json:"txId"`
+	// timestamp da transacao em milissegundos; 0 quando o stub nao informa
+	Timestamp              int64         `json:"timestamp"`
+	Hash                   string        `json:"hash"`
+}
+
+//stub que informa o ID da transacao, como o stub do simulador e o ChaincodeStubInterface das
+//versoes seguintes do fabric
+type comIDTransacao interface {
+	GetTxID() string
+}
+
+//ID da transacao. A interface do stub no v0.6 nao expoe o ID: ele fica no campo UUID do stub do
+//peer e no TxID do MockStub. Todos os validadores executam a mesma transacao com o mesmo ID, entao
+//o valor gravado e o mesmo em todos. Outros stubs gravam o ID vazio
+func idTransacao(stub shim.ChaincodeStubInterface) string {
+	switch s := stub.(type) {
+	case *shim.ChaincodeStub:
+		return s.UUID
+	case *shim.MockStub:
+		return s.TxID
+	case comIDTransacao:
+		return s.GetTxID()
+	}
+	return ""
+}
+
+//timestamp da transacao em milissegundos; o MockStub nao implementa e fica 0
+func timestampTransacao(stub shim.ChaincodeStubInterface) int64 {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return 0
+	}
+	return ts.Seconds*1000 + int64(ts.Nanos)/1000000
+}
+
+//grava a transacao atual como ultima escrita de cada pedido gravado no invoke
+func registrarEscritas(stub *stubComEventos) error {
+	if len(stub.chaves) == 0 {
+		return nil
+	}
+	txID := idTransacao(stub.ChaincodeStubInterface)
+	timestamp := timestampTransacao(stub.ChaincodeStubInterface)
+	for _, chave := range stub.chaves {
+		hash, err := canonico.Hash(stub.gravados[chave])
+		if err != nil {
+			logger.Error("Could not hash pedido "+chave, err)
+			return err
+		}
+		bytes, err := canonico.Marshal(&Escrita{txID, timestamp, hash})
+		if err != nil {
+			logger.Error("Could not marshal write record of pedido "+chave, err)
+			return err
+		}
+		err = stub.PutState(escritaPrefix+chave, bytes)
+		if err != nil {
+			logger.Error("Could not save write record of pedido "+chave, err)
+			return err
+		}
+	}
+	return nil
+}
+
+//recibo do pedido para conferencia fora da rede: o pedido como esta no ledger, o hash canonico e
+//a transacao que o gravou por ultimo. O CPF continua cifrado; o cliente abre com a propria chave
+func ObterRecibo(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ObterRecibo")
+
+	if len(args) < 1 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Missing pedido ID")
+	}
+
+	var pedidoId = args[0]
+	bytes, err := stub.GetState(pedidoId)
+	if err != nil {
+		logger.Error("Could not fetch pedido with id "+pedidoId+" from ledger", err)
+		return nil, err
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+	//o recibo leva o pedido inteiro, porque o hash e do registro do ledger: a loja do marketplace
+	//so recebe o recibo dos pedidos em que tem subpedido
+	var pe Pedido
+	err = decodificarPedido(bytes, &pe)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+pedidoId, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	err = restringirAoVendedor(stub, &pe)
+	if err != nil {
+		return nil, err
+	}
+
+	var escrita Escrita
+	registro, err := stub.GetState(escritaPrefix + pedidoId)
+	if err != nil {
+		logger.Error("Could not fetch write record of pedido "+pedidoId, err)
+		return nil, err
+	}
+	//pedidos gravados antes do registro de escritas saem sem transacao
+	if registro != nil {
+		err = json.Unmarshal(registro, &escrita)
+		if err != nil {
+			logger.Error("Invalid write record for pedido "+pedidoId, err)
+			return nil, errors.New(" Invalid json format ")
+		}
+	}
+
+	r, err := recibo.Novo(pedidoId, bytes, escrita.TxID, escrita.Timestamp)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+pedidoId, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	if registro != nil && escrita.Hash != r.Hash {
+		logger.Error("Pedido " + pedidoId + " does not match its write record")
+		return nil, errors.New("Pedido " + pedidoId + " does not match the hash of its last write")
+	}
+	return canonico.Marshal(r)
+}
@@ -0,0 +1,100 @@
+package contrato
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/recibo"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+func TestObterRecibo(t *testing.T) {
+	fmt.Println("Entering TestObterRecibo")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, pedidoJson)
+	sim.Relogio.Avancar(simulador.Dia)
+	sim.DeveInvocar(t, "RegistrarEntrega", pedidoID, sim.Relogio.Texto())
+	entrega := sim.Historico[len(sim.Historico)-1]
+
+	var r recibo.Recibo
+	sim.DeveConsultar(t, &r, "ObterRecibo", pedidoID)
+	if r.TxID != entrega.TxID || r.Timestamp != sim.Relogio.Agora() || r.PedidoID != pedidoID {
+		t.Fatalf("Expected the delivery transaction in the receipt, got %+v", r)
+	}
+	if !bytes.Equal(r.Pedido, sim.Stub.State[pedidoID]) {
+		t.Fatalf("Expected the stored pedido in the receipt:\n%s\n%s", r.Pedido, sim.Stub.State[pedidoID])
+	}
+	err := recibo.Verificar(&r)
+	if err != nil {
+		t.Fatalf("Expected a valid receipt: %s", err)
+	}
+
+	//consulta nao e escrita e nao muda o recibo
+	sim.DeveConsultar(t, nil, "ObterPedido", pedidoID)
+	var depois recibo.Recibo
+	sim.DeveConsultar(t, &depois, "ObterRecibo", pedidoID)
+	if depois.TxID != r.TxID || depois.Hash != r.Hash {
+		t.Fatalf("Expected the same receipt after a query, got %+v", depois)
+	}
+}
+
+func TestReciboDoLote(t *testing.T) {
+	fmt.Println("Entering TestReciboDoLote")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedidosEmLote", loteDePedidos("la1", "la2"))
+	lote := sim.Historico[0].TxID
+	for _, id := range []string{"la1", "la2"} {
+		var escrita Escrita
+		sim.Estado(t, escritaPrefix+id, &escrita)
+		if escrita.TxID != lote || escrita.Timestamp != sim.Relogio.Agora() {
+			t.Fatalf("Expected the batch transaction as last write of %s, got %+v", id, escrita)
+		}
+	}
+}
+
+func TestReciboPedidoAlterado(t *testing.T) {
+	fmt.Println("Entering TestReciboPedidoAlterado")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, pedidoJson)
+
+	//pedido mudado no ledger sem passar por um invoke do contrato
+	var p map[string]interface{}
+	json.Unmarshal(sim.Stub.State[pedidoID], &p)
+	p["descricaoItens"] = "Geladeira"
+	sim.Stub.State[pedidoID], _ = json.Marshal(p)
+	r := sim.Consultar("ObterRecibo", pedidoID)
+	if r.Err == nil {
+		t.Fatalf("Expected a pedido that does not match its last write to be refused")
+	}
+
+	//pedido gravado antes do registro de escritas sai sem transacao
+	delete(sim.Stub.State, escritaPrefix+pedidoID)
+	var semEscrita recibo.Recibo
+	sim.DeveConsultar(t, &semEscrita, "ObterRecibo", pedidoID)
+	if semEscrita.TxID != "" || recibo.Verificar(&semEscrita) != nil {
+		t.Fatalf("Expected a receipt without transaction, got %+v", semEscrita)
+	}
+
+	r = sim.Consultar("ObterRecibo", "nao-existe")
+	if r.Err != nil || r.Payload != nil {
+		t.Fatalf("Expected no receipt for a missing pedido")
+	}
+}
+
+func TestIdTransacao(t *testing.T) {
+	fmt.Println("Entering TestIdTransacao")
+	stub := shim.NewMockStub("ex01", new(SaleContractChainCode))
+	stub.MockTransactionStart("t123")
+	if idTransacao(stub) != "t123" || idTransacao(novoStubComEventos(stub)) != "" {
+		t.Fatalf("Expected the MockStub TxID")
+	}
+	if idTransacao(&shim.ChaincodeStub{UUID: "u456"}) != "u456" {
+		t.Fatalf("Expected the peer stub UUID")
+	}
+	if timestampTransacao(stub) != 0 {
+		t.Fatalf("Expected no timestamp from the MockStub")
+	}
+}
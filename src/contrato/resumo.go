@@ -0,0 +1,259 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//fim da garantia de um item, zero enquanto o item nao foi entregue
+type GarantiaItem struct {
+	ItemID                 string        `json:"itemId"`
+	FimGarantia            int64         `json:"fimGarantia"`
+	EmGarantia             bool          `json:"emGarantia"`
+}
+
+//comprovante para o cliente: o pedido com os prazos calculados na data de referencia
+type ResumoDoPedido struct {
+	Pedido                 Pedido        `json:"pedido"`
+	Status                 string        `json:"status"`
+	// DataEntrega + prazo de arrependimento configurado; zero antes da entrega
+	FimPrazoArrependimento int64         `json:"fimPrazoArrependimento"`
+	Garantias              []GarantiaItem `json:"garantias"`
+	TrocaPossivel          bool          `json:"trocaPossivel"`
+	// funcoes que o papel do chamador pode invocar agora sobre o pedido
+	AcoesPermitidas        []string      `json:"acoesPermitidas"`
+}
+
+//args[0]: pedido ID
+//args[1]: data de referencia (timestamp em milissegundos), normalmente a data atual
+func ResumoPedido(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ResumoPedido")
+
+	if len(args) < 2 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected pedido ID and reference timestamp")
+	}
+	var pedidoID = args[0]
+	dataReferencia, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Error("Invalid timestamp value")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Invalid timestamp value")
+	}
+
+	bytes, err := ObterPedido(stub, []string{pedidoID})
+	if err != nil {
+		return nil, err
+	}
+	if bytes == nil {
+		return nil, erroCodigo(CodigoPedidoNaoEncontrado, "Pedido " + pedidoID + " not found")
+	}
+	var pe Pedido
+	err = json.Unmarshal(bytes, &pe)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+pedidoID, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	configuracao, err := lerConfiguracao(stub)
+	if err != nil {
+		return nil, err
+	}
+	role, err := lerAtributo(stub, "role")
+	if err != nil {
+		logger.Error("Could not read role attribute", err)
+		return nil, err
+	}
+	vendedorChamador, err := lerAtributo(stub, "vendedor")
+	if err != nil {
+		logger.Error("Could not read vendedor attribute", err)
+		return nil, err
+	}
+	//o pedido devolvido pode ser so o subpedido da loja, mas os invokes conferem o pedido inteiro,
+	//entao as acoes sao calculadas sobre ele
+	bytes, err = stub.GetState(pedidoID)
+	if err != nil {
+		logger.Error("Could not fetch pedido "+pedidoID+" from ledger", err)
+		return nil, err
+	}
+	var completo Pedido
+	err = decodificarPedido(bytes, &completo)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+pedidoID, err)
+		return nil, errors.New(" Invalid json format ")
+	}
+	disputas, err := lerDisputasDoIndice(stub, disputaPedidoIndexPrefix+pedidoID)
+	if err != nil {
+		return nil, err
+	}
+	var disputaAberta = false
+	for _, d := range disputas {
+		disputaAberta = disputaAberta || d.Status != StatusDisputaResolvida
+	}
+
+	resumo := ResumoDoPedido{Pedido: pe, Status: StatusPedido(&pe), Garantias: garantiasDoPedido(&pe, dataReferencia, configuracao)}
+	if pe.DataEntrega != 0 {
+		resumo.FimPrazoArrependimento = pe.DataEntrega + configuracao.PrazoArrependimento
+	}
+	//por arrependimento dentro do prazo ou por defeito enquanto houver item em garantia, com as
+	//mesmas regras do RegistrarTroca
+	resumo.TrocaPossivel = trocaPermitida(&completo, dataReferencia, configuracao)
+	resumo.AcoesPermitidas = acoesPermitidas(&completo, string(role), string(vendedorChamador), dataReferencia, configuracao, disputaAberta)
+
+	return canonico.Marshal(&resumo)
+}
+
+//fim da garantia de cada item na data de referencia
+func garantiasDoPedido(p *Pedido, data int64, configuracao *Configuracao) []GarantiaItem {
+	garantias := []GarantiaItem{}
+	for _, item := range itensDoPedido(p) {
+		garantia := GarantiaItem{ItemID: item.ID}
+		dataEntrega := dataEntregaDoItem(p, item)
+		if dataEntrega != 0 {
+			garantia.FimGarantia = dataEntrega + garantiaDoItem(configuracao, item.ID)
+			garantia.EmGarantia = data <= garantia.FimGarantia
+		}
+		garantias = append(garantias, garantia)
+	}
+	return garantias
+}
+
+func algumItemEmGarantia(p *Pedido, data int64, configuracao *Configuracao) bool {
+	for _, garantia := range garantiasDoPedido(p, data, configuracao) {
+		if garantia.EmGarantia {
+			return true
+		}
+	}
+	return false
+}
+
+//itens com vendedor quando o pedido e de marketplace, senao os SKUs de ItensId
+func itensDoPedido(p *Pedido) []ItemPedido {
+	if len(p.Itens) > 0 {
+		return p.Itens
+	}
+	itens := []ItemPedido{}
+	for _, sku := range skusDoPedido(p) {
+		itens = append(itens, ItemPedido{ID: sku})
+	}
+	return itens
+}
+
+//no marketplace cada item e entregue com o subpedido do seu vendedor
+func dataEntregaDoItem(p *Pedido, item ItemPedido) int64 {
+	for _, sub := range p.SubPedidos {
+		if sub.Vendedor == item.Vendedor && sub.DataEntrega != 0 {
+			return sub.DataEntrega
+		}
+	}
+	return p.DataEntrega
+}
+
+//troca por algum dos motivos na data, com as validacoes do RegistrarTroca
+func trocaPermitida(p *Pedido, data int64, configuracao *Configuracao) bool {
+	if validarTroca(p, data) != nil {
+		return false
+	}
+	return validarPrazoTroca(p, 1, data, configuracao) == nil || validarPrazoTroca(p, 2, data, configuracao) == nil
+}
+
+//arrependimento do pedido inteiro ou do subpedido de algum vendedor
+func arrependimentoPermitido(p *Pedido, data int64, configuracao *Configuracao) bool {
+	for _, vendedor := range escoposDevolucao(p) {
+		if _, err := validarArrependimento(p, vendedor, data, configuracao); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//o pedido inteiro ("") e o subpedido de cada vendedor, como no argumento vendedor das devolucoes
+func escoposDevolucao(p *Pedido) []string {
+	escopos := []string{""}
+	for _, sub := range p.SubPedidos {
+		escopos = append(escopos, sub.Vendedor)
+	}
+	return escopos
+}
+
+//entrega ainda pendente que o chamador pode registrar: a loja do marketplace so a do proprio subpedido
+func entregaPendente(p *Pedido, papel string, vendedorChamador string) bool {
+	if p.Troca.Data != 0 || p.Devolucao.Status != "" {
+		return false
+	}
+	if papel == RoleLoja && vendedorChamador != "" && len(p.SubPedidos) > 0 {
+		sub, err := subPedidoDoVendedor(p, vendedorChamador)
+		return err == nil && sub.DataEntrega == 0 && sub.Devolucao.Status == ""
+	}
+	return p.DataEntrega == 0
+}
+
+//etapa de devolucao de algum escopo que o chamador pode avancar, com as regras do avancarDevolucao
+func etapaPermitida(p *Pedido, papel string, vendedorChamador string, data int64, de string, para string) bool {
+	for _, vendedor := range escoposDevolucao(p) {
+		devolucao, _, err := devolucaoDoPedido(p, vendedor)
+		if err != nil || devolucao.Status != de {
+			continue
+		}
+		if len(devolucao.Historico) > 0 && data < devolucao.Historico[len(devolucao.Historico)-1].Data {
+			continue
+		}
+		if papel == RoleLoja {
+			//a concordancia e conferida numa copia, o resumo nao grava nada
+			copia := *devolucao
+			copia.Concordancias = append([]ConcordanciaVendedor{}, devolucao.Concordancias...)
+			_, err = concordanciaDosVendedores(p, &copia, vendedor, vendedorChamador, para, data)
+			if err != nil {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func acoesPermitidas(p *Pedido, papel string, vendedorChamador string, data int64, configuracao *Configuracao, disputaAberta bool) []string {
+	acoes := []string{}
+	switch papel {
+	case RoleCliente:
+		if arrependimentoPermitido(p, data, configuracao) {
+			acoes = append(acoes, "RegistrarArrependimento")
+		}
+		if trocaPermitida(p, data, configuracao) {
+			acoes = append(acoes, "RegistrarTroca")
+		}
+		acoes = append(acoes, "AbrirDisputa")
+	case RoleLoja, RoleAdmin:
+		if entregaPendente(p, papel, vendedorChamador) {
+			acoes = append(acoes, "RegistrarEntrega")
+		}
+		if etapaPermitida(p, papel, vendedorChamador, data, StatusDevolucaoSolicitada, StatusDevolucaoAprovada) {
+			acoes = append(acoes, "AprovarDevolucao")
+		}
+		if etapaPermitida(p, papel, vendedorChamador, data, StatusDevolucaoSolicitada, StatusDevolucaoRejeitada) {
+			acoes = append(acoes, "RejeitarDevolucao")
+		}
+		if etapaPermitida(p, papel, vendedorChamador, data, StatusDevolucaoAprovada, StatusDevolucaoRecebida) {
+			acoes = append(acoes, "RegistrarRecebimentoDevolucao")
+		}
+		//a loja e parte na disputa; o admin nao responde por ela
+		if papel == RoleLoja && disputaAberta {
+			acoes = append(acoes, "ResponderDisputa")
+		}
+	case RoleTransportadora:
+		if entregaPendente(p, papel, vendedorChamador) {
+			acoes = append(acoes, "RegistrarEntrega")
+		}
+	case RoleFinanceiro:
+		if etapaPermitida(p, papel, vendedorChamador, data, StatusDevolucaoRecebida, StatusDevolucaoReembolsada) {
+			acoes = append(acoes, "RegistrarReembolso")
+		}
+	case RoleMediador:
+		if disputaAberta {
+			acoes = append(acoes, "ResolverDisputa")
+		}
+	}
+	return acoes
+}
@@ -0,0 +1,129 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+func TestResumoPedido(t *testing.T) {
+	fmt.Println("Entering TestResumoPedido")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	_, err := stub.MockInit("t123", "init", []string{`{"prazoGarantiaPorItem":{"445":31536000000}}`})
+	if err != nil {
+		t.Fatalf("Expected Init to accept the configuracao: %s", err)
+	}
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+
+	attributes["role"] = []byte(RoleLoja)
+	bytes, err := stub.MockQuery("ResumoPedido", []string{pedidoID, "1504000000000"})
+	if err != nil {
+		t.Fatalf("Expected ResumoPedido to be invoked correctly: %s", err)
+	}
+	var resumo ResumoDoPedido
+	json.Unmarshal(bytes, &resumo)
+	if resumo.Status != StatusPedidoRegistrado || resumo.FimPrazoArrependimento != 0 || resumo.TrocaPossivel {
+		t.Fatalf("Expected an undelivered pedido without deadlines, got %+v", resumo)
+	}
+	if len(resumo.AcoesPermitidas) != 1 || resumo.AcoesPermitidas[0] != "RegistrarEntrega" {
+		t.Fatalf("Expected loja to be able to register the delivery, got %v", resumo.AcoesPermitidas)
+	}
+
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504000000000")
+	attributes["role"] = []byte(RoleCliente)
+	bytes, _ = stub.MockQuery("ResumoPedido", []string{pedidoID, "1504100000000"})
+	json.Unmarshal(bytes, &resumo)
+	if resumo.FimPrazoArrependimento != 1504000000000+prazoArrependimento || !resumo.TrocaPossivel {
+		t.Fatalf("Expected regret window counted from delivery, got %d", resumo.FimPrazoArrependimento)
+	}
+	if len(resumo.Garantias) != 2 || resumo.Garantias[0].FimGarantia != 1504000000000+prazoGarantia ||
+		resumo.Garantias[1].FimGarantia != 1504000000000+31536000000 {
+		t.Fatalf("Expected default warranty for 234 and configured one for 445, got %+v", resumo.Garantias)
+	}
+	if len(resumo.AcoesPermitidas) != 3 || resumo.AcoesPermitidas[0] != "RegistrarArrependimento" {
+		t.Fatalf("Expected cliente to be able to regret, exchange or open a dispute, got %v", resumo.AcoesPermitidas)
+	}
+
+	//passados os 90 dias so o item com garantia estendida permite troca
+	bytes, _ = stub.MockQuery("ResumoPedido", []string{pedidoID, "1514000000000"})
+	json.Unmarshal(bytes, &resumo)
+	if resumo.Garantias[0].EmGarantia || !resumo.Garantias[1].EmGarantia || !resumo.TrocaPossivel {
+		t.Fatalf("Expected only item 445 still under warranty")
+	}
+	if len(resumo.AcoesPermitidas) != 2 || resumo.AcoesPermitidas[0] != "RegistrarTroca" {
+		t.Fatalf("Expected regret no longer allowed, got %v", resumo.AcoesPermitidas)
+	}
+}
+
+func TestTrocaPorDefeitoForaDaGarantia(t *testing.T) {
+	fmt.Println("Entering TestTrocaPorDefeitoForaDaGarantia")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoJson)
+	sim.Relogio.Avancar(91 * simulador.Dia)
+
+	var resumo ResumoDoPedido
+	sim.ComoClienteDe(t, pedidoID).DeveConsultar(t, &resumo, "ResumoPedido", pedidoID, sim.Relogio.Texto())
+	if resumo.TrocaPossivel {
+		t.Fatalf("Expected no exchange after the warranty of every item")
+	}
+	err := sim.DeveFalhar(t, "RegistrarTroca", pedidoID, sim.Relogio.Texto(), "2", "1", chaveNFeDevolucao)
+	if !strings.Contains(err.Error(), CodigoPrazoExcedido) {
+		t.Fatalf("Expected a defect exchange after the warranty to be refused, got %s", err)
+	}
+}
+
+//acoes do resumo para o papel e o vendedor do certificado
+func acoesForTest(t *testing.T, sim *simuladortest.Simulador, papel string, vendedor string) []string {
+	var resumo ResumoDoPedido
+	sim.ComoPapel(papel).ComAtributo("vendedor", vendedor).DeveConsultar(t, &resumo, "ResumoPedido", pedidoID, sim.Relogio.Texto())
+	return resumo.AcoesPermitidas
+}
+
+func TestAcoesPermitidasComDevolucaoDeSubPedido(t *testing.T) {
+	fmt.Println("Entering TestAcoesPermitidasComDevolucaoDeSubPedido")
+	sim := novoSimulador()
+	sim.PedidoEntregue(t, pedidoID, pedidoMarketplaceJson)
+	sim.Relogio.Avancar(simulador.Dia)
+	sim.ComoClienteDe(t, pedidoID).DeveInvocar(t, "RegistrarArrependimento", pedidoID, sim.Relogio.Texto(), chaveNFeDevolucao, "lojaB")
+
+	casos := []struct {
+		papel                  string
+		vendedor               string
+		acoes                  []string
+	}{
+		//o subpedido da lojaA ainda pode ser devolvido, mas a troca e do pedido inteiro
+		{RoleCliente, "", []string{"RegistrarArrependimento", "AbrirDisputa"}},
+		{RoleLoja, "lojaB", []string{"AprovarDevolucao", "RejeitarDevolucao"}},
+		{RoleLoja, "lojaA", []string{}},
+		{RoleAdmin, "", []string{"AprovarDevolucao", "RejeitarDevolucao"}},
+		{RoleTransportadora, "", []string{}},
+		{RoleFinanceiro, "", []string{}},
+		{RoleMediador, "", []string{}},
+	}
+	for _, c := range casos {
+		if acoes := acoesForTest(t, sim, c.papel, c.vendedor); !reflect.DeepEqual(acoes, c.acoes) {
+			t.Fatalf("Expected %v for %s %s, got %v", c.acoes, c.papel, c.vendedor, acoes)
+		}
+	}
+
+	sim.ComoClienteDe(t, pedidoID).DeveInvocar(t, "AbrirDisputa", "d1", pedidoID, sim.Relogio.Texto(), "Panela amassada")
+	if acoes := acoesForTest(t, sim, RoleMediador, ""); !reflect.DeepEqual(acoes, []string{"ResolverDisputa"}) {
+		t.Fatalf("Expected the mediador to resolve the open dispute, got %v", acoes)
+	}
+	if acoes := acoesForTest(t, sim, RoleLoja, "lojaA"); !reflect.DeepEqual(acoes, []string{"ResponderDisputa"}) {
+		t.Fatalf("Expected lojaA to answer the dispute, got %v", acoes)
+	}
+
+	sim.ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaB").DeveInvocar(t, "AprovarDevolucao", pedidoID, sim.Relogio.Texto(), "", "lojaB")
+	sim.DeveInvocar(t, "RegistrarRecebimentoDevolucao", pedidoID, sim.Relogio.Texto(), "", "lojaB")
+	if acoes := acoesForTest(t, sim, RoleFinanceiro, ""); !reflect.DeepEqual(acoes, []string{"RegistrarReembolso"}) {
+		t.Fatalf("Expected the refund of the lojaB sub-order, got %v", acoes)
+	}
+}
@@ -0,0 +1,16 @@
+package contrato
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+//executa os cenarios de aceitacao de cenarios/ escritos pela area de negocio
+func TestRoteirosDeAceitacao(t *testing.T) {
+	fmt.Println("Entering TestRoteirosDeAceitacao")
+	config := simulador.ConfigRoteiro{PedidoJSON: pedidoJson}
+	simuladortest.ExecutarRoteiros(t, "cenarios/*.cenario", func() *simulador.Simulador { return novoSimulador().Simulador }, config)
+}
@@ -0,0 +1,209 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//versao do formato do Pedido gravada em VersaoSchema. Pedidos sem o campo sao da versao 0.
+//Ao mudar o modelo, incremente a versao e acrescente a migracao em migracoesPedido
+const versaoSchemaAtual = 1
+
+//migracoesPedido[v] leva um pedido da versao v para a v+1. Recebe tambem o JSON gravado,
+//para ler campos que nao existem mais no modelo
+var migracoesPedido = []func(bytes []byte, p *Pedido) error{
+	migrarPedidoV0,
+}
+
+//relatorio de uma chamada do MigrarPedidos
+type RelatorioMigracao struct {
+	Verificados            int           `json:"verificados"`
+	Migrados               int           `json:"migrados"`
+	// chave inicial da proxima chamada; vazia quando a faixa terminou
+	ProximaChave           string        `json:"proximaChave"`
+	Concluido              bool          `json:"concluido"`
+}
+
+//le um pedido gravado no ledger em qualquer versao do schema e o devolve no formato atual
+func decodificarPedido(bytes []byte, pe *Pedido) error {
+	_, err := atualizarSchema(bytes, pe)
+	return err
+}
+
+//indica se o pedido precisou ser migrado
+func atualizarSchema(bytes []byte, pe *Pedido) (bool, error) {
+	err := json.Unmarshal(bytes, pe)
+	if err != nil {
+		return false, err
+	}
+	if pe.VersaoSchema > versaoSchemaAtual {
+		return false, errors.New("Pedido " + pe.ID + " has schema version " + strconv.Itoa(pe.VersaoSchema) + ", newer than this chaincode")
+	}
+	if pe.VersaoSchema == versaoSchemaAtual {
+		return false, nil
+	}
+	for v := pe.VersaoSchema; v < versaoSchemaAtual; v++ {
+		err = migracoesPedido[v](bytes, pe)
+		if err != nil {
+			logger.Error("Could not migrate pedido "+pe.ID+" from schema version "+strconv.Itoa(v), err)
+			return false, err
+		}
+	}
+	pe.VersaoSchema = versaoSchemaAtual
+	return true, nil
+}
+
+type devolucaoV0 struct {
+	MotivoDevolucao        int           `json:"devolvido"`
+}
+
+type pedidoV0 struct {
+	Devolucao              devolucaoV0   `json:"devolucao"`
+	SubPedidos             []struct {
+		Devolucao              devolucaoV0   `json:"devolucao"`
+	}                                    `json:"subPedidos"`
+}
+
+//versao 0: o motivo da devolucao era gravado como "devolvido" e nao havia controle de versao
+func migrarPedidoV0(bytes []byte, p *Pedido) error {
+	var antigo pedidoV0
+	err := json.Unmarshal(bytes, &antigo)
+	if err != nil {
+		return err
+	}
+	if p.Devolucao.MotivoDevolucao == 0 {
+		p.Devolucao.MotivoDevolucao = antigo.Devolucao.MotivoDevolucao
+	}
+	for i := range p.SubPedidos {
+		if i < len(antigo.SubPedidos) && p.SubPedidos[i].Devolucao.MotivoDevolucao == 0 {
+			p.SubPedidos[i].Devolucao.MotivoDevolucao = antigo.SubPedidos[i].Devolucao.MotivoDevolucao
+		}
+	}
+	if p.Versao == 0 {
+		p.Versao = 1
+	}
+	return nil
+}
+
+//regrava no formato atual os pedidos de uma faixa de chaves. Somente o papel admin.
+//args[0]: chave inicial, vazia para o inicio
+//args[1]: chave final, vazia para o fim
+//args[2]: quantidade maxima de pedidos verificados na chamada (opcional)
+//Chamar de novo com a ProximaChave do relatorio ate Concluido
+func MigrarPedidos(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering MigrarPedidos")
+
+	err := exigirPapel(stub, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		logger.Error("Invalid number of arguments")
+		return nil, erroCodigo(CodigoArgumentoInvalido, "Expected chave inicial and chave final")
+	}
+	inicio, fim := args[0], args[1]
+	if fim == "" {
+		fim = "\xff"
+	}
+	var limite = limiteConsultaPadrao
+	if len(args) > 2 {
+		limite, err = strconv.Atoi(args[2])
+		if err != nil || limite <= 0 {
+			logger.Error("Invalid limit " + args[2])
+			return nil, erroCodigo(CodigoArgumentoInvalido, "Limit must be a positive number")
+		}
+	}
+
+	iter, err := stub.RangeQueryState(inicio, fim)
+	if err != nil {
+		logger.Error("Could not query range "+inicio+" - "+fim, err)
+		return nil, err
+	}
+	defer iter.Close()
+
+	relatorio := RelatorioMigracao{Concluido: true}
+	for iter.HasNext() {
+		chave, bytes, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		//indices, disputas e estatisticas
+		if strings.HasPrefix(chave, "_") {
+			continue
+		}
+		if relatorio.Verificados == limite {
+			relatorio.ProximaChave = chave
+			relatorio.Concluido = false
+			break
+		}
+		relatorio.Verificados++
+
+		migrado, err := migrarRegistro(stub, chave, bytes)
+		if err != nil {
+			return nil, err
+		}
+		if migrado {
+			relatorio.Migrados++
+		}
+	}
+	logger.Info("Migrated " + strconv.Itoa(relatorio.Migrados) + " pedidos")
+	return canonico.Marshal(&relatorio)
+}
+
+func migrarRegistro(stub shim.ChaincodeStubInterface, id string, bytes []byte) (bool, error) {
+	var antigo Pedido
+	err := json.Unmarshal(bytes, &antigo)
+	if err != nil {
+		logger.Error("Invalid format for pedido "+id, err)
+		return false, errors.New(" Invalid json format ")
+	}
+	var pe Pedido
+	migrado, err := atualizarSchema(bytes, &pe)
+	if err != nil {
+		return false, err
+	}
+	//pedidos gravados antes da protecao do CPF o tem em claro e sem o hash dos indices. O admin
+	//precisa das chaves do CPF; sem elas a migracao para em vez de regravar o CPF em claro
+	if pe.CPFCliente != "" && !estaCifrado(pe.CPFCliente) {
+		err = protegerCPF(stub, &pe)
+		if err != nil {
+			return false, err
+		}
+		migrado = true
+	}
+	novo, err := canonico.Marshal(&pe)
+	if err != nil {
+		logger.Error("Could not marshal Pedido: migration", err)
+		return false, err
+	}
+	//no schema atual so regrava o que foi gravado antes da serializacao canonica
+	if !migrado && string(novo) == string(bytes) {
+		return false, nil
+	}
+	err = stub.PutState(id, novo)
+	if err != nil {
+		logger.Error("Could not save migrated pedido "+id, err)
+		return false, err
+	}
+	//pedidos antigos podem nao estar nos indices criados depois deles
+	err = atualizarIndicesConsulta(stub, chavesIndiceConsulta(&antigo), &pe)
+	if err != nil {
+		return false, err
+	}
+	err = adicionarAoIndice(stub, pedidoIndexStr, id)
+	if err != nil {
+		return false, err
+	}
+	if pe.CPFHash != "" {
+		err = adicionarAoIndice(stub, cpfIndexPrefix+pe.CPFHash, id)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,151 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//pedido gravado antes do controle de schema, com o motivo em "devolvido"
+var pedidoV0Json = `{"id":"%s","cpfHash":"abc","descricaoItens":"Geladeira","itensId":"445",
+	"dataVenda":1503000000000,"dataEntrega":1503500000000,"devolucao":{"devolvido":2,"data":1503600000000}}`
+
+func gravarPedidoV0ForTest(stub *shim.MockStub, id string) {
+	stub.MockTransactionStart("t123")
+	stub.PutState(id, []byte(fmt.Sprintf(pedidoV0Json, id)))
+	stub.MockTransactionEnd("t123")
+}
+
+func TestObterPedidoSchemaAntigo(t *testing.T) {
+	fmt.Println("Entering TestObterPedidoSchemaAntigo")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	gravarPedidoV0ForTest(stub, "v0a")
+
+	bytes, err := stub.MockQuery("ObterPedido", []string{"v0a"})
+	if err != nil {
+		t.Fatalf("Expected ObterPedido to read an old pedido: %s", err)
+	}
+	var p Pedido
+	json.Unmarshal(bytes, &p)
+	if p.Devolucao.MotivoDevolucao != 2 {
+		t.Fatalf("Expected motivo from the old \"devolvido\" field, got %d", p.Devolucao.MotivoDevolucao)
+	}
+	if p.VersaoSchema != versaoSchemaAtual || p.Versao != 1 {
+		t.Fatalf("Expected pedido upgraded to the current schema")
+	}
+
+	_, err = stub.MockInvoke("t123", "RegistrarEntrega", []string{"v0a", "1503500000000", "versao=1"})
+	if err != nil {
+		t.Fatalf("Expected update of an old pedido to succeed: %s", err)
+	}
+	var gravado Pedido
+	ObterPedidoForTest(t, stub, "v0a", &gravado)
+	if gravado.VersaoSchema != versaoSchemaAtual || gravado.Devolucao.MotivoDevolucao != 2 {
+		t.Fatalf("Expected update to write the current schema")
+	}
+}
+
+func TestMigrarPedidos(t *testing.T) {
+	fmt.Println("Entering TestMigrarPedidos")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoJson)
+	gravarPedidoV0ForTest(stub, "v0a")
+	gravarPedidoV0ForTest(stub, "v0b")
+	gravarPedidoV0ForTest(stub, "v0c")
+
+	_, err := stub.MockInvoke("t123", "MigrarPedidos", []string{"", ""})
+	if err == nil {
+		t.Fatalf("Expected MigrarPedidos to require the admin role")
+	}
+
+	attributes["role"] = []byte(RoleAdmin)
+	bytes, err := stub.MockInvoke("t123", "MigrarPedidos", []string{"v0", "v0\xff", "2"})
+	if err != nil {
+		t.Fatalf("Expected MigrarPedidos to be invoked correctly: %s", err)
+	}
+	var relatorio RelatorioMigracao
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Migrados != 2 || relatorio.Concluido || relatorio.ProximaChave != "v0c" {
+		t.Fatalf("Expected first batch to stop before v0c, got %+v", relatorio)
+	}
+
+	bytes = deveInvocar(t, stub, "MigrarPedidos", relatorio.ProximaChave, "v0\xff", "2")
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Migrados != 1 || !relatorio.Concluido {
+		t.Fatalf("Expected second batch to finish the range, got %+v", relatorio)
+	}
+
+	bytes = deveInvocar(t, stub, "MigrarPedidos", "", "")
+	json.Unmarshal(bytes, &relatorio)
+	if relatorio.Verificados != 4 || relatorio.Migrados != 0 {
+		t.Fatalf("Expected nothing left to migrate, got %+v", relatorio)
+	}
+
+	var p Pedido
+	ObterPedidoForTest(t, stub, "v0b", &p)
+	if p.VersaoSchema != versaoSchemaAtual || p.Devolucao.MotivoDevolucao != 2 {
+		t.Fatalf("Expected v0b rewritten in the current schema")
+	}
+
+	bytes, _ = stub.MockQuery("ConsultarPedidos", []string{`{"motivoDevolucao":2}`})
+	var pagina PaginaPedidos
+	json.Unmarshal(bytes, &pagina)
+	if len(pagina.Pedidos) != 3 {
+		t.Fatalf("Expected migrated pedidos in the query indexes, got %d", len(pagina.Pedidos))
+	}
+}
+
+func TestMigrarPedidoNaoCanonico(t *testing.T) {
+	fmt.Println("Entering TestMigrarPedidoNaoCanonico")
+	sim := novoSimulador()
+	sim.ComoPapel(RoleLoja).DeveInvocar(t, "RegistrarPedido", pedidoID, pedidoJson)
+	canonico := string(sim.Stub.State[pedidoID])
+
+	//pedido no schema atual gravado pelo json.Marshal da struct, antes da forma canonica
+	var p Pedido
+	json.Unmarshal(sim.Stub.State[pedidoID], &p)
+	sim.Stub.State[pedidoID], _ = json.Marshal(&p)
+
+	var relatorio RelatorioMigracao
+	json.Unmarshal(sim.ComoPapel(RoleAdmin).DeveInvocar(t, "MigrarPedidos", "", ""), &relatorio)
+	if relatorio.Migrados != 1 || string(sim.Stub.State[pedidoID]) != canonico {
+		t.Fatalf("Expected the pedido rewritten in canonical form, got %+v %s", relatorio, sim.Stub.State[pedidoID])
+	}
+	json.Unmarshal(sim.DeveInvocar(t, "MigrarPedidos", "", ""), &relatorio)
+	if relatorio.Migrados != 0 {
+		t.Fatalf("Expected a canonical pedido to be left alone, got %+v", relatorio)
+	}
+}
+
+func TestMigrarPedidoComCPFEmClaro(t *testing.T) {
+	fmt.Println("Entering TestMigrarPedidoComCPFEmClaro")
+	sim := novoSimulador()
+	//pedido da versao 0, gravado antes da protecao do CPF
+	sim.Stub.MockTransactionStart("t123")
+	sim.Stub.PutState("v0a", []byte(`{"id":"v0a","cpf":"095.963.977-29","itensId":"445","dataVenda":1503000000000}`))
+	sim.Stub.MockTransactionEnd("t123")
+
+	sim.ComoPapel(RoleAdmin).ComAtributo("chaveCPF", "")
+	err := sim.DeveFalhar(t, "MigrarPedidos", "", "")
+	if !strings.Contains(err.Error(), "chaveCPF") {
+		t.Fatalf("Expected the migration to stop without the CPF key, got %s", err)
+	}
+	sim.AssertCampo(t, "v0a", "cpf", "095.963.977-29")
+
+	sim.ComAtributo("chaveCPF", string(novosAtributos()["chaveCPF"]))
+	sim.DeveInvocar(t, "MigrarPedidos", "", "")
+	if strings.Contains(string(sim.Stub.State["v0a"]), "09596397729") || !estaCifrado(fmt.Sprint(sim.Campo(t, "v0a", "cpf"))) {
+		t.Fatalf("Expected the CPF encrypted by the migration, got %s", sim.Stub.State["v0a"])
+	}
+	sim.AssertCampo(t, "v0a", "cpfHash", cpfHashForTest())
+	var pedidos []Pedido
+	sim.DeveConsultar(t, &pedidos, "ListarPedidosCPF", "09596397729")
+	if len(pedidos) != 1 || pedidos[0].ID != "v0a" || pedidos[0].CPFCliente != "09596397729" {
+		t.Fatalf("Expected the migrated pedido found by CPF, got %+v", pedidos)
+	}
+}
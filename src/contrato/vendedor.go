@@ -0,0 +1,165 @@
+package contrato
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//prefixo do indice com os pedidos de cada vendedor do marketplace
+var vendedorIndexPrefix = "_vendedor_"
+
+//visao de um subpedido para o vendedor, sem os itens dos outros vendedores
+type SubPedidoVendedor struct {
+	PedidoID               string        `json:"pedidoId"`
+	DataVenda              int64         `json:"dataVenda"`
+	DataPrazoEntrega       int64         `json:"dataPrazoEntrega"`
+	Itens                  []ItemPedido  `json:"itens"`
+	SubPedido              SubPedido     `json:"subPedido"`
+}
+
+//lista os subpedidos do vendedor identificado pelo atributo "vendedor" do certificado do chamador
+func ListarSubPedidosVendedor(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	logger.Debug("Entering ListarSubPedidosVendedor")
+
+	vendedorBytes, err := lerAtributo(stub, "vendedor")
+	if err != nil {
+		logger.Error("Could not read vendedor attribute", err)
+		return nil, err
+	}
+	var vendedor = string(vendedorBytes)
+	if vendedor == "" {
+		logger.Error("Caller has no vendedor attribute")
+		return nil, erroCodigo(CodigoPapelNaoPermitido, "Only sellers can list their sub-orders")
+	}
+
+	ids, err := lerIndice(stub, vendedorIndexPrefix+vendedor)
+	if err != nil {
+		return nil, err
+	}
+
+	subPedidos := []SubPedidoVendedor{}
+	for _, id := range ids {
+		bytes, err := ObterPedido(stub, []string{id})
+		if err != nil {
+			return nil, err
+		}
+		var pe Pedido
+		err = json.Unmarshal(bytes, &pe)
+		if err != nil {
+			logger.Error("Invalid format for pedido "+id, err)
+			return nil, errors.New(" Invalid json format ")
+		}
+		sub, err := subPedidoDoVendedor(&pe, vendedor)
+		if err != nil {
+			continue
+		}
+		itens := []ItemPedido{}
+		for _, item := range pe.Itens {
+			if item.Vendedor == vendedor {
+				itens = append(itens, item)
+			}
+		}
+		subPedidos = append(subPedidos, SubPedidoVendedor{
+			PedidoID:         pe.ID,
+			DataVenda:        pe.DataVenda,
+			DataPrazoEntrega: pe.DataPrazoEntrega,
+			Itens:            itens,
+			SubPedido:        *sub,
+		})
+	}
+
+	return canonico.Marshal(subPedidos)
+}
+
+//agrupa os itens do pedido em um subpedido por vendedor, na ordem em que aparecem
+func montarSubPedidos(p *Pedido) error {
+	p.SubPedidos = nil
+	for _, item := range p.Itens {
+		if item.Vendedor == "" {
+			return erroCodigo(CodigoArgumentoInvalido, "Missing vendedor for item " + item.ID)
+		}
+		sub, err := subPedidoDoVendedor(p, item.Vendedor)
+		if err != nil {
+			p.SubPedidos = append(p.SubPedidos, SubPedido{Vendedor: item.Vendedor})
+			sub = &p.SubPedidos[len(p.SubPedidos)-1]
+		}
+		sub.ItensId = append(sub.ItensId, item.ID)
+	}
+	return nil
+}
+
+//pedido do marketplace sem subpedido do vendedor da loja que chamou
+var erroForaDoVendedor = erroCodigo(CodigoPapelNaoPermitido, "Pedido has no sub-order of the caller vendedor")
+
+//no marketplace a loja so ve os subpedidos e os itens do vendedor do seu certificado;
+//os pedidos sem subpedidos e os outros papeis continuam vendo o pedido inteiro
+func restringirAoVendedor(stub shim.ChaincodeStubInterface, p *Pedido) error {
+	if len(p.SubPedidos) == 0 {
+		return nil
+	}
+	role, err := lerAtributo(stub, "role")
+	if err != nil {
+		logger.Error("Could not read role attribute", err)
+		return err
+	}
+	if string(role) != RoleLoja {
+		return nil
+	}
+	vendedorBytes, err := lerAtributo(stub, "vendedor")
+	if err != nil {
+		logger.Error("Could not read vendedor attribute", err)
+		return err
+	}
+	var vendedor = string(vendedorBytes)
+
+	subPedidos := []SubPedido{}
+	for _, sub := range p.SubPedidos {
+		if sub.Vendedor == vendedor {
+			subPedidos = append(subPedidos, sub)
+		}
+	}
+	if len(subPedidos) == 0 {
+		logger.Error("Vendedor " + vendedor + " has no sub-order in pedido " + p.ID)
+		return erroForaDoVendedor
+	}
+	itens := []ItemPedido{}
+	for _, item := range p.Itens {
+		if item.Vendedor == vendedor {
+			itens = append(itens, item)
+		}
+	}
+	p.SubPedidos = subPedidos
+	p.Itens = itens
+	return nil
+}
+
+//vendedor do certificado da loja que chama; vazio para os outros papeis e para a loja sem o
+//atributo "vendedor", que opera o pedido inteiro
+func vendedorDoChamador(stub shim.ChaincodeStubInterface) (string, error) {
+	role, err := lerAtributo(stub, "role")
+	if err != nil {
+		logger.Error("Could not read role attribute", err)
+		return "", err
+	}
+	if string(role) != RoleLoja {
+		return "", nil
+	}
+	vendedor, err := lerAtributo(stub, "vendedor")
+	if err != nil {
+		logger.Error("Could not read vendedor attribute", err)
+		return "", err
+	}
+	return string(vendedor), nil
+}
+
+func subPedidoDoVendedor(p *Pedido, vendedor string) (*SubPedido, error) {
+	for i := range p.SubPedidos {
+		if p.SubPedidos[i].Vendedor == vendedor {
+			return &p.SubPedidos[i], nil
+		}
+	}
+	return nil, erroCodigo(CodigoArgumentoInvalido, "No sub-order for vendedor " + vendedor + " in pedido " + p.ID)
+}
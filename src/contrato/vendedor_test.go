@@ -0,0 +1,194 @@
+package contrato
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var pedidoMarketplaceJson = `{"cpf": "09596397729", "dataVenda": 1503849607000, "dataPrazoEntrega": 1504454407000, "chaveNFe": "35170801234567000199550010000012341000123451",
+	"itens": [{"id": "234", "descricao": "Maquina Lavar Brastemp", "vendedor": "lojaA"}, {"id": "445", "descricao": "Panela Tramontina", "vendedor": "lojaB"}, {"id": "446", "descricao": "Tampa Tramontina", "vendedor": "lojaB"}] }`
+
+func TestRegistrarPedidoMarketplace(t *testing.T) {
+	fmt.Println("Entering TestRegistrarPedidoMarketplace")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoMarketplaceJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido function to be invoked: %s", err)
+	}
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if len(pe.SubPedidos) != 2 || pe.SubPedidos[0].Vendedor != "lojaA" || len(pe.SubPedidos[1].ItensId) != 2 {
+		t.Fatalf("Sub-orders not grouped by vendedor")
+	}
+}
+
+func TestRegistrarEntregaPorVendedor(t *testing.T) {
+	fmt.Println("Entering TestRegistrarEntregaPorVendedor")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoMarketplaceJson)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504000000000", "lojaA")
+
+	var pe Pedido
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.DataEntrega != 0 {
+		t.Fatalf("Pedido should not be delivered while lojaB has not delivered")
+	}
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	_, err := stub.MockInvoke("t123", "RegistrarArrependimento", []string{pedidoID, "1504000001000", chaveNFeDevolucao, "lojaA"})
+	if err != nil {
+		t.Fatalf("Expected arrependimento of lojaA sub-order: %s", err)
+	}
+
+	attributes["role"] = []byte(RoleLoja)
+	deveInvocar(t, stub, "RegistrarEntrega", pedidoID, "1504454417000", "lojaB")
+	ObterPedidoForTest(t, stub, pedidoID, &pe)
+	if pe.DataEntrega != 1504454417000 || pe.AtrasoEntrega != 10000 {
+		t.Fatalf("Pedido should be delivered with the last sub-order delivery")
+	}
+	if pe.SubPedidos[0].Devolucao.MotivoDevolucao != 1 || pe.Devolucao.MotivoDevolucao != 0 {
+		t.Fatalf("Arrependimento should only apply to lojaA sub-order")
+	}
+
+	_, err = stub.MockInvoke("t123", "RegistrarEntrega", []string{pedidoID, "1504454417000", "lojaC"})
+	if err == nil {
+		t.Fatalf("Expected error for unknown vendedor")
+	}
+}
+
+func TestListarSubPedidosVendedor(t *testing.T) {
+	fmt.Println("Entering TestListarSubPedidosVendedor")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+
+	deveInvocar(t, stub, "RegistrarPedido", pedidoID, pedidoMarketplaceJson)
+
+	_, err := stub.MockQuery("ListarSubPedidosVendedor", []string{})
+	if err == nil {
+		t.Fatalf("Expected error for caller without vendedor attribute")
+	}
+
+	attributes["vendedor"] = []byte("lojaB")
+	bytes, err := stub.MockQuery("ListarSubPedidosVendedor", []string{})
+	if err != nil {
+		t.Fatalf("Expected ListarSubPedidosVendedor to be invoked correctly")
+	}
+	var subPedidos []SubPedidoVendedor
+	json.Unmarshal(bytes, &subPedidos)
+	if len(subPedidos) != 1 || len(subPedidos[0].Itens) != 2 || subPedidos[0].SubPedido.Vendedor != "lojaB" {
+		t.Fatalf("Expected only lojaB sub-order and items")
+	}
+}
+
+func TestObterPedidoMarketplacePorVendedor(t *testing.T) {
+	fmt.Println("Entering TestObterPedidoMarketplacePorVendedor")
+	attributes := novosAtributos()
+	stub := shim.NewCustomMockStub("mockStub", new(SaleContractChainCode), attributes)
+	_, err := stub.MockInvoke("t123", "RegistrarPedido", []string{pedidoID, pedidoMarketplaceJson})
+	if err != nil {
+		t.Fatalf("Expected RegistrarPedido function to be invoked: %s", err)
+	}
+
+	attributes["vendedor"] = []byte("lojaB")
+	bytes, err := stub.MockQuery("ObterPedido", []string{pedidoID})
+	if err != nil {
+		t.Fatalf("Expected ObterPedido to be invoked correctly: %s", err)
+	}
+	var pe Pedido
+	json.Unmarshal(bytes, &pe)
+	if len(pe.SubPedidos) != 1 || pe.SubPedidos[0].Vendedor != "lojaB" || len(pe.Itens) != 2 || pe.Itens[0].ID != "445" {
+		t.Fatalf("Expected lojaB to see only its sub-order and items, got %+v", pe)
+	}
+
+	attributes["vendedor"] = []byte("lojaC")
+	_, err = stub.MockQuery("ObterPedido", []string{pedidoID})
+	if err == nil || err.Error() != erroCodigo(CodigoPapelNaoPermitido, "Pedido has no sub-order of the caller vendedor").Error() {
+		t.Fatalf("Expected lojaC not to see the pedido, got %v", err)
+	}
+	bytes, err = stub.MockQuery("ListarPedidosCPF", []string{"09596397729"})
+	if err != nil {
+		t.Fatalf("Expected ListarPedidosCPF to be invoked correctly: %s", err)
+	}
+	var pedidos []Pedido
+	json.Unmarshal(bytes, &pedidos)
+	if len(pedidos) != 0 {
+		t.Fatalf("Expected lojaC to find no pedido by CPF")
+	}
+
+	attributes["role"] = []byte(RoleCliente)
+	attributes["cpfHash"] = []byte(cpfHashForTest())
+	bytes, _ = stub.MockQuery("ObterPedido", []string{pedidoID})
+	json.Unmarshal(bytes, &pe)
+	if len(pe.SubPedidos) != 2 || len(pe.Itens) != 3 {
+		t.Fatalf("Expected cliente to see the whole pedido")
+	}
+}
+
+func TestConsultasMarketplacePorVendedor(t *testing.T) {
+	fmt.Println("Entering TestConsultasMarketplacePorVendedor")
+	sim := novoSimulador()
+	sim.PedidoRegistrado(t, pedidoID, pedidoMarketplaceJson)
+
+	var atrasados []Pedido
+	sim.ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaC").DeveConsultar(t, &atrasados, "ListarPedidosAtrasados", "1504454408000")
+	if len(atrasados) != 0 {
+		t.Fatalf("Expected lojaC to find no late pedido, got %+v", atrasados)
+	}
+	r := sim.Consultar("ObterRecibo", pedidoID)
+	if r.Err == nil || r.Err.Error() != erroForaDoVendedor.Error() {
+		t.Fatalf("Expected lojaC not to get the receipt, got %v", r.Err)
+	}
+	var pagina PaginaPedidos
+	sim.DeveConsultar(t, &pagina, "ConsultarPedidos", `{}`)
+	if len(pagina.Pedidos) != 0 {
+		t.Fatalf("Expected lojaC to find no pedido, got %+v", pagina.Pedidos)
+	}
+
+	sim.ComAtributo("vendedor", "lojaA").DeveConsultar(t, &atrasados, "ListarPedidosAtrasados", "1504454408000")
+	if len(atrasados) != 1 || len(atrasados[0].SubPedidos) != 1 || atrasados[0].SubPedidos[0].Vendedor != "lojaA" {
+		t.Fatalf("Expected lojaA to see only its late sub-order, got %+v", atrasados)
+	}
+	sim.DeveConsultar(t, &pagina, "ConsultarPedidos", `{}`)
+	if len(pagina.Pedidos) != 1 || len(pagina.Pedidos[0].Itens) != 1 {
+		t.Fatalf("Expected lojaA to see only its items, got %+v", pagina.Pedidos)
+	}
+	r = sim.Consultar("ObterRecibo", pedidoID)
+	if r.Err != nil {
+		t.Fatalf("Expected lojaA to get the receipt: %s", r.Err)
+	}
+}
+
+func TestEntregaPeloVendedorDoCertificado(t *testing.T) {
+	fmt.Println("Entering TestEntregaPeloVendedorDoCertificado")
+	sim := novoSimulador()
+	sim.PedidoRegistrado(t, pedidoID, pedidoMarketplaceJson)
+
+	//sem o vendedor nos argumentos a loja entrega o proprio subpedido
+	sim.ComoPapel(RoleLoja).ComAtributo("vendedor", "lojaA").DeveInvocar(t, "RegistrarEntrega", pedidoID, "1504000000000")
+	sim.AssertCampo(t, pedidoID, "subPedidos.0.dataEntrega", "1504000000000")
+	sim.AssertCampo(t, pedidoID, "subPedidos.1.dataEntrega", "0")
+	sim.AssertCampo(t, pedidoID, "dataEntrega", "0")
+
+	err := sim.DeveFalhar(t, "RegistrarEntrega", pedidoID, "1504000000000", "lojaB")
+	if err.Error() != erroCodigo(CodigoPapelNaoPermitido, "Caller vendedor can not deliver the sub-order of another vendedor").Error() {
+		t.Fatalf("Expected lojaA not to deliver the sub-order of lojaB, got %s", err)
+	}
+	lote := `[{"pedidoId": "` + pedidoID + `", "data": 1504000000000, "vendedor": "lojaB"}]`
+	r := sim.Invocar("RegistrarEntregasEmLote", lote, ModoLoteParcial)
+	if r.Err != nil {
+		t.Fatalf("Expected a partial batch to report the refused entrega: %s", r.Err)
+	}
+	sim.AssertCampo(t, pedidoID, "subPedidos.1.dataEntrega", "0")
+
+	sim.ComoPapel(RoleAdmin).DeveInvocar(t, "RegistrarEntrega", pedidoID, "1504000001000", "lojaB")
+	sim.AssertCampo(t, pedidoID, "dataEntrega", "1504000001000")
+}
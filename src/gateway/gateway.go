@@ -0,0 +1,279 @@
+//Package gateway expoe as operacoes do pedido como rotas REST/JSON para os front-ends, que nao
+//precisam conhecer o JSON-RPC do endpoint /chaincode do peer. As chamadas passam pelo sdk, entao
+//o mesmo gateway roda contra um peer ou contra o chaincode em memoria (sdk.Local).
+//
+//No peer todas as requisicoes usam o mesmo enrollID e os mesmos atributos. O arrependimento exige
+//o papel cliente e o cpfHash do dono do pedido no certificado, entao so passa com o enrollID do
+//proprio cliente; com o sdk.Local o papel e o cpfHash vem dos cabecalhos X-Papel e X-CPFHash.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/sdk"
+)
+
+//cabecalho com o papel do chamador, usado so com PapelPorCabecalho
+const CabecalhoPapel = "X-Papel"
+
+//cabecalho com o cpfHash do cliente que chama, usado so com PapelPorCabecalho
+const CabecalhoCPFHash = "X-CPFHash"
+
+type Gateway struct {
+	Cliente                *sdk.Cliente
+	// aplica os cabecalhos X-Papel e X-CPFHash na chamada; so tem efeito com o sdk.Local, no
+	// peer o papel e o cpfHash vem do certificado do usuario
+	PapelPorCabecalho      bool
+	// data usada quando o corpo nao informa uma; trocado nos testes
+	Agora                  func() time.Time
+}
+
+func Novo(cliente *sdk.Cliente) *Gateway {
+	return &Gateway{Cliente: cliente, Agora: time.Now}
+}
+
+//corpo do POST /pedidos/{id}/entrega
+type CorpoEntrega struct {
+	// timestamp em milissegundos; 0 usa a hora do gateway
+	Data                   int64         `json:"data"`
+	Vendedor               string        `json:"vendedor,omitempty"`
+	Comprovante            string        `json:"comprovante,omitempty"`
+	// versao esperada do pedido; 0 nao verifica
+	Versao                 int64         `json:"versao,omitempty"`
+}
+
+//corpo do POST /pedidos/{id}/arrependimento
+type CorpoArrependimento struct {
+	Data                   int64         `json:"data"`
+	ChaveNFe               string        `json:"chaveNFe"`
+	Vendedor               string        `json:"vendedor,omitempty"`
+	Complemento            string        `json:"complemento,omitempty"`
+	Versao                 int64         `json:"versao,omitempty"`
+}
+
+//resposta dos POST: o peer aceita a transacao antes de executa-la
+type Transacao struct {
+	TxID                   string        `json:"txId"`
+	ID                     string        `json:"id"`
+}
+
+//resposta de erro de todas as rotas
+type Erro struct {
+	Codigo                 string        `json:"codigo"`
+	Mensagem               string        `json:"mensagem"`
+}
+
+type rota struct {
+	metodo                 string
+	// segmentos entre chaves sao parametros, por exemplo /pedidos/{id}
+	caminho                string
+	// funcao do chaincode chamada, usada como operationId
+	funcao                 string
+	resumo                 string
+	// tipos do corpo e da resposta para o OpenAPI; corpo nil para rotas sem corpo
+	corpo                  interface{}
+	resposta               interface{}
+	status                 int
+	erros                  []int
+	tratar                 func(g *Gateway, r *http.Request, id string) (interface{}, error)
+}
+
+var rotas = []rota{
+	{"POST", "/pedidos", "RegistrarPedido", "Registers a pedido; the CPF is encrypted by the chaincode",
+		contrato.Pedido{}, Transacao{}, http.StatusAccepted,
+		[]int{400, 403, 409, 502}, registrarPedido},
+	{"POST", "/pedidos/{id}/entrega", "RegistrarEntrega", "Registers the delivery of the pedido or of a seller sub-order",
+		CorpoEntrega{}, Transacao{}, http.StatusAccepted,
+		[]int{400, 403, 404, 409, 422, 502}, registrarEntrega},
+	{"POST", "/pedidos/{id}/arrependimento", "RegistrarArrependimento", "Registers the customer's regret within the regret window",
+		CorpoArrependimento{}, Transacao{}, http.StatusAccepted,
+		[]int{400, 403, 404, 409, 422, 502}, registrarArrependimento},
+	{"GET", "/pedidos/{id}", "ObterPedido", "Returns the stored pedido",
+		nil, contrato.Pedido{}, http.StatusOK,
+		[]int{404, 502}, obterPedido},
+}
+
+//status HTTP e codigo de cada categoria de erro do sdk
+var errosHTTP = []struct {
+	tipo                   error
+	status                 int
+	codigo                 string
+}{
+	{sdk.ErrPedidoNaoEncontrado, http.StatusNotFound, "PEDIDO_NAO_ENCONTRADO"},
+	{sdk.ErrConflitoVersao, http.StatusConflict, "CONFLITO_VERSAO"},
+	{sdk.ErrNFeJaRegistrada, http.StatusConflict, "NFE_JA_REGISTRADA"},
+	{sdk.ErrPedidoExistente, http.StatusConflict, "PEDIDO_EXISTENTE"},
+	{sdk.ErrPapelNaoPermitido, http.StatusForbidden, "PAPEL_NAO_PERMITIDO"},
+	{sdk.ErrPrazoExcedido, http.StatusUnprocessableEntity, "PRAZO_EXCEDIDO"},
+	{sdk.ErrOperacaoNaoPermitida, http.StatusUnprocessableEntity, "OPERACAO_NAO_PERMITIDA"},
+	{sdk.ErrArgumentoInvalido, http.StatusBadRequest, "ARGUMENTO_INVALIDO"},
+}
+
+//corpo invalido, antes de chamar o chaincode
+var errCorpoInvalido = errors.New("Invalid JSON body")
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && r.URL.Path == "/openapi.json" {
+		escreverJSON(w, http.StatusOK, Documento())
+		return
+	}
+	metodoPermitido := true
+	for _, rt := range rotas {
+		id, ok := casar(rt.caminho, r.URL.EscapedPath())
+		if !ok {
+			continue
+		}
+		if rt.metodo != r.Method {
+			metodoPermitido = false
+			continue
+		}
+		resposta, err := rt.tratar(g, r, id)
+		if err != nil {
+			escreverErro(w, err)
+			return
+		}
+		if transacao, ok := resposta.(Transacao); ok {
+			w.Header().Set("Location", "/pedidos/"+url.PathEscape(transacao.ID))
+		}
+		escreverJSON(w, rt.status, resposta)
+		return
+	}
+	if !metodoPermitido {
+		escreverJSON(w, http.StatusMethodNotAllowed, Erro{"METODO_NAO_PERMITIDO", "Method " + r.Method + " not allowed"})
+		return
+	}
+	escreverJSON(w, http.StatusNotFound, Erro{"ROTA_NAO_ENCONTRADA", "No route for " + r.URL.Path})
+}
+
+//compara o caminho da rota com o da requisicao e devolve o parametro {id}
+func casar(padrao string, caminho string) (string, bool) {
+	partesPadrao := strings.Split(padrao, "/")
+	partes := strings.Split(caminho, "/")
+	if len(partes) != len(partesPadrao) {
+		return "", false
+	}
+	id := ""
+	for i, parte := range partesPadrao {
+		if parte == "{id}" {
+			valor, err := url.PathUnescape(partes[i])
+			if err != nil || valor == "" {
+				return "", false
+			}
+			id = valor
+		} else if parte != partes[i] {
+			return "", false
+		}
+	}
+	return id, true
+}
+
+func (g *Gateway) contexto(r *http.Request) context.Context {
+	ctx := r.Context()
+	if !g.PapelPorCabecalho {
+		return ctx
+	}
+	if papel := r.Header.Get(CabecalhoPapel); papel != "" {
+		ctx = sdk.ComPapel(ctx, papel)
+	}
+	if cpfHash := r.Header.Get(CabecalhoCPFHash); cpfHash != "" {
+		ctx = sdk.ComAtributo(ctx, "cpfHash", cpfHash)
+	}
+	return ctx
+}
+
+func (g *Gateway) data(ms int64) time.Time {
+	if ms == 0 {
+		return g.Agora()
+	}
+	return sdk.Data(ms)
+}
+
+func lerCorpo(r *http.Request, destino interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if decoder.Decode(destino) != nil {
+		return errCorpoInvalido
+	}
+	return nil
+}
+
+func registrarPedido(g *Gateway, r *http.Request, _ string) (interface{}, error) {
+	var p contrato.Pedido
+	err := lerCorpo(r, &p)
+	if err != nil {
+		return nil, err
+	}
+	if p.ID == "" {
+		return nil, &sdk.ErroContrato{Funcao: "RegistrarPedido", Mensagem: "Missing pedido ID", Codigo: contrato.CodigoArgumentoInvalido, Tipo: sdk.ErrArgumentoInvalido}
+	}
+	txID, err := g.Cliente.RegistrarPedido(g.contexto(r), p)
+	return Transacao{txID, p.ID}, err
+}
+
+func registrarEntrega(g *Gateway, r *http.Request, id string) (interface{}, error) {
+	var corpo CorpoEntrega
+	err := lerCorpo(r, &corpo)
+	if err != nil {
+		return nil, err
+	}
+	txID, err := g.Cliente.RegistrarEntrega(g.contexto(r), id, sdk.Entrega{
+		Data:           g.data(corpo.Data),
+		Vendedor:       corpo.Vendedor,
+		Comprovante:    corpo.Comprovante,
+		VersaoEsperada: corpo.Versao,
+	})
+	return Transacao{txID, id}, err
+}
+
+func registrarArrependimento(g *Gateway, r *http.Request, id string) (interface{}, error) {
+	var corpo CorpoArrependimento
+	err := lerCorpo(r, &corpo)
+	if err != nil {
+		return nil, err
+	}
+	txID, err := g.Cliente.RegistrarArrependimento(g.contexto(r), id, sdk.Arrependimento{
+		Data:           g.data(corpo.Data),
+		ChaveNFe:       corpo.ChaveNFe,
+		Vendedor:       corpo.Vendedor,
+		Complemento:    corpo.Complemento,
+		VersaoEsperada: corpo.Versao,
+	})
+	return Transacao{txID, id}, err
+}
+
+func obterPedido(g *Gateway, r *http.Request, id string) (interface{}, error) {
+	return g.Cliente.ObterPedido(g.contexto(r), id)
+}
+
+func escreverErro(w http.ResponseWriter, err error) {
+	if err == errCorpoInvalido {
+		escreverJSON(w, http.StatusBadRequest, Erro{"ARGUMENTO_INVALIDO", err.Error()})
+		return
+	}
+	erroContrato, ok := err.(*sdk.ErroContrato)
+	if !ok {
+		//rede, contexto ou resposta invalida do peer
+		escreverJSON(w, http.StatusBadGateway, Erro{"PEER_INDISPONIVEL", err.Error()})
+		return
+	}
+	for _, e := range errosHTTP {
+		if erroContrato.Tipo == e.tipo {
+			escreverJSON(w, e.status, Erro{e.codigo, erroContrato.Mensagem})
+			return
+		}
+	}
+	escreverJSON(w, http.StatusUnprocessableEntity, Erro{"ERRO_CONTRATO", erroContrato.Mensagem})
+}
+
+func escreverJSON(w http.ResponseWriter, status int, valor interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(valor)
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/sdk"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+//entrega em 29/08/2017, dois dias depois da venda do pedidoTeste
+var dataEntrega int64 = 1504022407000
+
+func pedidoTeste(id string, nota int) string {
+	return `{"id":"` + id + `","cpf":"09596397729","descricaoItens":"Geladeira","itensId":"234",` +
+		`"dataVenda":1503849607000,"dataPrazoEntrega":1504454407000,"chaveNFe":"` + simulador.ChaveNFe(nota) + `"}`
+}
+
+func novoGatewayForTest() *Gateway {
+	atributos := map[string][]byte{
+		"role":           []byte(contrato.RoleLoja),
+		"chaveCPF":       []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"),
+		"chaveIndiceCPF": []byte("1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"),
+	}
+	g := Novo(sdk.Novo(sdk.NovoLocal(atributos)))
+	g.PapelPorCabecalho = true
+	g.Agora = func() time.Time { return sdk.Data(dataEntrega) }
+	return g
+}
+
+func requisitar(g *Gateway, metodo string, caminho string, papel string, corpo string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	r := httptest.NewRequest(metodo, caminho, strings.NewReader(corpo))
+	if papel != "" {
+		r.Header.Set(CabecalhoPapel, papel)
+	}
+	return responder(g, r)
+}
+
+//POST do cliente com o cpfHash do certificado dele
+func requisitarCliente(g *Gateway, caminho string, cpfHash string, corpo string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	r := httptest.NewRequest("POST", caminho, strings.NewReader(corpo))
+	r.Header.Set(CabecalhoPapel, contrato.RoleCliente)
+	r.Header.Set(CabecalhoCPFHash, cpfHash)
+	return responder(g, r)
+}
+
+func responder(g *Gateway, r *http.Request) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	var resposta map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resposta)
+	return w, resposta
+}
+
+func TestRotasDoPedido(t *testing.T) {
+	fmt.Println("Entering TestRotasDoPedido")
+	g := novoGatewayForTest()
+
+	w, resposta := requisitar(g, "POST", "/pedidos", "", pedidoTeste("la1", 1))
+	if w.Code != http.StatusAccepted || resposta["txId"] == "" || w.Header().Get("Location") != "/pedidos/la1" {
+		t.Fatalf("Expected pedido to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+	w, _ = requisitar(g, "POST", "/pedidos/la1/entrega", "", `{"comprovante":"9f86d0","versao":1}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected delivery to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+	_, resposta = requisitar(g, "GET", "/pedidos/la1", "", "")
+	corpo := fmt.Sprintf(`{"data":%d,"chaveNFe":"%s","complemento":"Nao serviu"}`, dataEntrega+86400000, simulador.ChaveNFe(2))
+	w, _ = requisitarCliente(g, "/pedidos/la1/arrependimento", resposta["cpfHash"].(string), corpo)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected regret to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+
+	w, resposta = requisitar(g, "GET", "/pedidos/la1", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected pedido, got %d %s", w.Code, w.Body.String())
+	}
+	devolucao := resposta["devolucao"].(map[string]interface{})
+	if resposta["cpf"] != "09596397729" || resposta["dataEntrega"] != float64(dataEntrega) ||
+		resposta["comprovanteEntrega"] != "9f86d0" || devolucao["status"] != contrato.StatusDevolucaoSolicitada {
+		t.Fatalf("Unexpected pedido %s", w.Body.String())
+	}
+}
+
+func TestErrosDasRotas(t *testing.T) {
+	fmt.Println("Entering TestErrosDasRotas")
+	g := novoGatewayForTest()
+	w, _ := requisitar(g, "POST", "/pedidos", "", pedidoTeste("la1", 1))
+	if w.Code != 202 {
+		t.Fatalf("Expected la1 to be registered, got %d %s", w.Code, w.Body.String())
+	}
+
+	casos := []struct {
+		metodo                 string
+		caminho                string
+		papel                  string
+		corpo                  string
+		status                 int
+		codigo                 string
+	}{
+		{"GET", "/pedidos/nao-existe", "", "", 404, "PEDIDO_NAO_ENCONTRADO"},
+		{"POST", "/pedidos", "", pedidoTeste("la2", 1), 409, "NFE_JA_REGISTRADA"},
+		{"POST", "/pedidos", "", pedidoTeste("la1", 2), 409, "PEDIDO_EXISTENTE"},
+		{"POST", "/pedidos", "", `{"cpf":"09596397729"}`, 400, "ARGUMENTO_INVALIDO"},
+		{"POST", "/pedidos", "", `{"id":`, 400, "ARGUMENTO_INVALIDO"},
+		{"POST", "/pedidos/la1/entrega", "", `{"desconhecido":1}`, 400, "ARGUMENTO_INVALIDO"},
+		{"POST", "/pedidos/la1/entrega", "", `{"versao":7}`, 409, "CONFLITO_VERSAO"},
+		{"POST", "/pedidos/la1/arrependimento", contrato.RoleLoja, `{"chaveNFe":"` + simulador.ChaveNFe(2) + `"}`, 403, "PAPEL_NAO_PERMITIDO"},
+		{"DELETE", "/pedidos/la1", "", "", 405, "METODO_NAO_PERMITIDO"},
+		{"GET", "/clientes", "", "", 404, "ROTA_NAO_ENCONTRADA"},
+	}
+	for _, c := range casos {
+		w, resposta := requisitar(g, c.metodo, c.caminho, c.papel, c.corpo)
+		if w.Code != c.status || resposta["codigo"] != c.codigo {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", c.metodo, c.caminho, c.status, c.codigo, w.Code, w.Body.String())
+		}
+	}
+
+	_, pedido := requisitar(g, "GET", "/pedidos/la1", "", "")
+	cpfHash := pedido["cpfHash"].(string)
+	corpo := `{"chaveNFe":"` + simulador.ChaveNFe(2) + `"}`
+	w, resposta := requisitarCliente(g, "/pedidos/la1/arrependimento", cpfHash, corpo)
+	if w.Code != 422 || resposta["codigo"] != "OPERACAO_NAO_PERMITIDA" {
+		t.Fatalf("Expected OPERACAO_NAO_PERMITIDA before delivery, got %d %s", w.Code, w.Body.String())
+	}
+
+	w, _ = requisitar(g, "POST", "/pedidos/la1/entrega", "", `{}`)
+	if w.Code != 202 {
+		t.Fatalf("Expected the entrega of la1 to be registered, got %d %s", w.Code, w.Body.String())
+	}
+	//o cpfHash de outro cliente nao passa, mesmo com o papel cliente
+	w, resposta = requisitarCliente(g, "/pedidos/la1/arrependimento", "outro-cliente", corpo)
+	if w.Code != 403 || resposta["codigo"] != "PAPEL_NAO_PERMITIDO" {
+		t.Fatalf("Expected PAPEL_NAO_PERMITIDO for another customer, got %d %s", w.Code, w.Body.String())
+	}
+	corpo = fmt.Sprintf(`{"data":%d,"chaveNFe":"%s"}`, dataEntrega+8*86400000, simulador.ChaveNFe(2))
+	w, resposta = requisitarCliente(g, "/pedidos/la1/arrependimento", cpfHash, corpo)
+	if w.Code != 422 || resposta["codigo"] != "PRAZO_EXCEDIDO" || resposta["mensagem"] != "Time of regret exceeded" {
+		t.Fatalf("Expected PRAZO_EXCEDIDO, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIDEscapadoNoCaminho(t *testing.T) {
+	fmt.Println("Entering TestIDEscapadoNoCaminho")
+	g := novoGatewayForTest()
+	w, _ := requisitar(g, "POST", "/pedidos", "", pedidoTeste("loja/1 a", 1))
+	if w.Code != http.StatusAccepted || w.Header().Get("Location") != "/pedidos/loja%2F1%20a" {
+		t.Fatalf("Expected escaped Location, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	w, resposta := requisitar(g, "GET", "/pedidos/loja%2F1%20a", "", "")
+	if w.Code != http.StatusOK || resposta["id"] != "loja/1 a" {
+		t.Fatalf("Expected pedido by escaped ID, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//documento OpenAPI 3 gerado da tabela de rotas e dos tipos Go dos corpos e respostas, servido em
+///openapi.json e gravado em docs/openapi.json
+func Documento() map[string]interface{} {
+	esquemas := map[string]interface{}{}
+	caminhos := map[string]interface{}{}
+	for _, rt := range rotas {
+		operacao := map[string]interface{}{
+			"operationId": rt.funcao,
+			"summary":     rt.resumo,
+			"responses":   respostas(rt, esquemas),
+		}
+		if strings.Contains(rt.caminho, "{id}") {
+			operacao["parameters"] = []interface{}{map[string]interface{}{
+				"name":     "id",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			}}
+		}
+		if rt.corpo != nil {
+			operacao["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  conteudoJSON(esquema(reflect.TypeOf(rt.corpo), esquemas)),
+			}
+		}
+		caminho, ok := caminhos[rt.caminho].(map[string]interface{})
+		if !ok {
+			caminho = map[string]interface{}{}
+			caminhos[rt.caminho] = caminho
+		}
+		caminho[strings.ToLower(rt.metodo)] = operacao
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "SaleContractChainCode gateway",
+			"version":     "1.0.0",
+			"description": "REST routes over the chaincode functions. Dates are timestamps in milliseconds.",
+		},
+		"paths":      caminhos,
+		"components": map[string]interface{}{"schemas": esquemas},
+	}
+}
+
+func respostas(rt rota, esquemas map[string]interface{}) map[string]interface{} {
+	resultado := map[string]interface{}{
+		strconv.Itoa(rt.status): map[string]interface{}{
+			"description": http.StatusText(rt.status),
+			"content":     conteudoJSON(esquema(reflect.TypeOf(rt.resposta), esquemas)),
+		},
+	}
+	erro := esquema(reflect.TypeOf(Erro{}), esquemas)
+	for _, status := range rt.erros {
+		resultado[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content":     conteudoJSON(erro),
+		}
+	}
+	return resultado
+}
+
+func conteudoJSON(esquema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": esquema}}
+}
+
+//esquema JSON do tipo; structs nomeadas vao para components.schemas e sao referenciadas
+func esquema(t reflect.Type, esquemas map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return esquema(t.Elem(), esquemas)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": esquema(t.Elem(), esquemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": esquema(t.Elem(), esquemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return objeto(t, esquemas)
+		}
+		referencia := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := esquemas[t.Name()]; !ok {
+			//reserva o nome antes, para tipos que se referenciam
+			esquemas[t.Name()] = nil
+			esquemas[t.Name()] = objeto(t, esquemas)
+		}
+		return referencia
+	}
+	return map[string]interface{}{}
+}
+
+//propriedades pelas tags json dos campos exportados
+func objeto(t reflect.Type, esquemas map[string]interface{}) map[string]interface{} {
+	propriedades := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		campo := t.Field(i)
+		if campo.PkgPath != "" {
+			continue
+		}
+		nome := strings.Split(campo.Tag.Get("json"), ",")[0]
+		if nome == "-" {
+			continue
+		}
+		if nome == "" {
+			nome = campo.Name
+		}
+		propriedades[nome] = esquema(campo.Type, esquemas)
+	}
+	return map[string]interface{}{"type": "object", "properties": propriedades}
+}
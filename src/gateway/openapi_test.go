@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+//go test -run TestDocumentoOpenAPI -atualizar regrava o docs/openapi.json
+var atualizar = flag.Bool("atualizar", false, "rewrite docs/openapi.json")
+
+const arquivoOpenAPI = "../../docs/openapi.json"
+
+func TestDocumentoOpenAPI(t *testing.T) {
+	fmt.Println("Entering TestDocumentoOpenAPI")
+	gerado, err := json.MarshalIndent(Documento(), "", "  ")
+	if err != nil {
+		t.Fatalf("Could not marshal the OpenAPI document: %s", err)
+	}
+	gerado = append(gerado, '\n')
+	if *atualizar {
+		ioutil.WriteFile(arquivoOpenAPI, gerado, 0644)
+	}
+	gravado, err := ioutil.ReadFile(arquivoOpenAPI)
+	if err != nil || string(gravado) != string(gerado) {
+		t.Fatalf("docs/openapi.json is out of date, run go test -run TestDocumentoOpenAPI -atualizar")
+	}
+}
+
+func TestDocumentoCobreAsRotas(t *testing.T) {
+	fmt.Println("Entering TestDocumentoCobreAsRotas")
+	var documento struct {
+		Paths      map[string]map[string]struct {
+			OperationID string                 `json:"operationId"`
+			Responses   map[string]interface{} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	g := novoGatewayForTest()
+	w, _ := requisitar(g, "GET", "/openapi.json", "", "")
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &documento) != nil {
+		t.Fatalf("Expected the OpenAPI document, got %d", w.Code)
+	}
+	for _, rt := range rotas {
+		operacao, ok := documento.Paths[rt.caminho][map[string]string{"GET": "get", "POST": "post"}[rt.metodo]]
+		if !ok || operacao.OperationID != rt.funcao || len(operacao.Responses) != len(rt.erros)+1 {
+			t.Fatalf("Route %s %s missing or incomplete in the document", rt.metodo, rt.caminho)
+		}
+	}
+	pedido := documento.Components.Schemas["Pedido"].Properties
+	if pedido["devolucao"] == nil || pedido["subPedidos"] == nil || documento.Components.Schemas["Devolucao"].Properties["motivoDevolucao"] == nil {
+		t.Fatalf("Expected the Pedido schema generated from the contract types")
+	}
+}
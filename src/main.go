@@ -0,0 +1,16 @@
+//Chaincode de contrato de venda implantado no peer. As regras ficam no pacote contrato,
+//que tambem e importado pelos clientes Go (sdk) para compartilhar os tipos do pedido.
+package main
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/contrato"
+)
+
+func main() {
+	err := shim.Start(new(contrato.SaleContractChainCode))
+	if err != nil {
+		fmt.Printf("Error starting Simple chaincode: %s", err)
+	}
+}
@@ -0,0 +1,43 @@
+package notificacao
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//cabecalhos de cada POST do webhook
+const (
+	CabecalhoAssinatura    = "X-Assinatura"
+	CabecalhoTimestamp     = "X-Assinatura-Timestamp"
+	CabecalhoID            = "X-Notificacao-ID"
+)
+
+//HMAC-SHA256 com o segredo da loja de "timestamp.corpo", no formato "sha256=<hex>". O timestamp
+//em segundos entra na assinatura para a loja recusar notificacoes antigas reenviadas por terceiros
+func Assinar(segredo string, timestamp int64, corpo []byte) string {
+	mac := hmac.New(sha256.New, []byte(segredo))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(corpo)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//para o lado da loja: confere a assinatura e se o timestamp esta dentro da tolerancia
+func VerificarAssinatura(segredo string, timestamp string, corpo []byte, assinatura string, agora time.Time, tolerancia time.Duration) bool {
+	segundos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	diferenca := agora.Sub(time.Unix(segundos, 0))
+	if diferenca > tolerancia || diferenca < -tolerancia {
+		return false
+	}
+	if !strings.HasPrefix(assinatura, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Assinar(segredo, segundos, corpo)), []byte(assinatura))
+}
@@ -0,0 +1,108 @@
+package notificacao
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//linha do arquivo de falhas
+type Falha struct {
+	Notificacao            Notificacao   `json:"notificacao"`
+	Erro                   string        `json:"erro"`
+	Tentativas             int           `json:"tentativas"`
+	// quando a ultima tentativa falhou, em milissegundos
+	Data                   int64         `json:"data"`
+}
+
+func (n *Notificador) registrarFalha(notificacao Notificacao, tentativas int, erro error) error {
+	linha, err := json.Marshal(&Falha{notificacao, erro.Error(), tentativas, n.agora().UnixNano() / 1e6})
+	if err != nil {
+		return err
+	}
+	arquivo, err := os.OpenFile(n.ArquivoFalhas, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = arquivo.Write(append(linha, '\n'))
+	if err == nil {
+		err = arquivo.Sync()
+	}
+	arquivo.Close()
+	return err
+}
+
+func (n *Notificador) Falhas() ([]Falha, error) {
+	conteudo, err := ioutil.ReadFile(n.ArquivoFalhas)
+	if os.IsNotExist(err) {
+		return []Falha{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	falhas := []Falha{}
+	linhas := bufio.NewScanner(bytes.NewReader(conteudo))
+	linhas.Buffer(nil, len(conteudo)+1)
+	for linhas.Scan() {
+		if len(bytes.TrimSpace(linhas.Bytes())) == 0 {
+			continue
+		}
+		var f Falha
+		err = json.Unmarshal(linhas.Bytes(), &f)
+		if err != nil {
+			return nil, err
+		}
+		falhas = append(falhas, f)
+	}
+	return falhas, nil
+}
+
+//reenvia as notificacoes do arquivo de falhas com o destino atual da loja; as que falham de novo
+//continuam no arquivo. Devolve quantas foram entregues e quantas continuam pendentes
+func (n *Notificador) Reenviar(ctx context.Context) (int, int, error) {
+	falhas, err := n.Falhas()
+	if err != nil {
+		return 0, 0, err
+	}
+	pendentes := []Falha{}
+	for _, f := range falhas {
+		if ctx.Err() != nil {
+			pendentes = append(pendentes, f)
+			continue
+		}
+		tentativas, err := n.Enviar(ctx, f.Notificacao)
+		if err != nil {
+			pendentes = append(pendentes, Falha{f.Notificacao, err.Error(), f.Tentativas + tentativas, n.agora().UnixNano() / 1e6})
+		}
+	}
+	var conteudo bytes.Buffer
+	for _, f := range pendentes {
+		linha, _ := json.Marshal(&f)
+		conteudo.Write(linha)
+		conteudo.WriteByte('\n')
+	}
+	err = gravarArquivo(n.ArquivoFalhas, conteudo.Bytes())
+	return len(falhas) - len(pendentes), len(pendentes), err
+}
+
+//grava num arquivo temporario e renomeia, para nao deixar o arquivo pela metade
+func gravarArquivo(arquivo string, conteudo []byte) error {
+	temporario, err := ioutil.TempFile(filepath.Dir(arquivo), filepath.Base(arquivo)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temporario.Write(conteudo)
+	if err == nil {
+		err = temporario.Sync()
+	}
+	temporario.Close()
+	if err != nil {
+		os.Remove(temporario.Name())
+		return err
+	}
+	return os.Rename(temporario.Name(), arquivo)
+}
@@ -0,0 +1,248 @@
+package notificacao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/projecao"
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+var agoraTeste = time.Date(2017, 9, 1, 12, 0, 0, 0, time.UTC)
+
+//loja falsa: confere a assinatura e responde os status da fila, depois 200
+type lojaFalsa struct {
+	segredo                string
+	status                 []int
+	mutex                  sync.Mutex
+	recebidas              []Notificacao
+	tentativas             int
+	assinaturaInvalida     bool
+}
+
+func (l *lojaFalsa) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	corpo, _ := ioutil.ReadAll(r.Body)
+	l.tentativas++
+	if !VerificarAssinatura(l.segredo, r.Header.Get(CabecalhoTimestamp), corpo, r.Header.Get(CabecalhoAssinatura), agoraTeste, 5*time.Minute) {
+		l.assinaturaInvalida = true
+	}
+	if len(l.status) > 0 {
+		status := l.status[0]
+		l.status = l.status[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	var n Notificacao
+	json.Unmarshal(corpo, &n)
+	if r.Header.Get(CabecalhoID) != n.ID {
+		l.assinaturaInvalida = true
+	}
+	l.recebidas = append(l.recebidas, n)
+}
+
+func novoNotificadorForTest(t *testing.T, lojas map[string]Destino) (*Notificador, *[]time.Duration) {
+	n := Novo(Config{lojas}, filepath.Join(t.TempDir(), "falhas.jsonl"))
+	n.agora = func() time.Time { return agoraTeste }
+	esperas := []time.Duration{}
+	n.dormir = func(ctx context.Context, d time.Duration) error {
+		esperas = append(esperas, d)
+		return nil
+	}
+	return n, &esperas
+}
+
+func novoSimuladorForTest() *simuladortest.Simulador {
+	attributes := make(map[string][]byte)
+	attributes["chaveCPF"] = []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	attributes["chaveIndiceCPF"] = []byte("1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100")
+	return simuladortest.Novo(new(contrato.SaleContractChainCode), attributes)
+}
+
+func pedidoTeste(id string, nota int, itens string) string {
+	return `{"id":"` + id + `","cpf":"09596397729","itensId":"234","dataVenda":1503849607000,` +
+		`"dataPrazoEntrega":1504454407000,"chaveNFe":"` + simulador.ChaveNFe(nota) + `"` + itens + `}`
+}
+
+//um bloco por evento do simulador
+func aplicarEventos(t *testing.T, n *Notificador, sim *simuladortest.Simulador) {
+	for i, e := range sim.Eventos {
+		err := n.AplicarBloco(uint64(i), []projecao.Evento{{Bloco: uint64(i), TxID: e.TxID, Nome: e.Nome, Payload: e.Payload}})
+		if err != nil {
+			t.Fatalf("Could not apply block %d: %s", i, err)
+		}
+	}
+}
+
+//pedido la1 registrado, entregue e com arrependimento
+func arrependimentoForTest(t *testing.T) *simuladortest.Simulador {
+	sim := novoSimuladorForTest()
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la1", pedidoTeste("la1", 1, ""))
+	sim.DeveInvocar(t, "RegistrarEntrega", "la1", "1504022407000")
+	sim.ComoClienteDe(t, "la1").DeveInvocar(t, "RegistrarArrependimento", "la1", "1504108807000", simulador.ChaveNFe(2))
+	return sim
+}
+
+func TestNotificaArrependimentoAssinado(t *testing.T) {
+	fmt.Println("Entering TestNotificaArrependimentoAssinado")
+	loja := &lojaFalsa{segredo: "s3gredo"}
+	servidor := httptest.NewServer(loja)
+	defer servidor.Close()
+	n, _ := novoNotificadorForTest(t, map[string]Destino{"": {URL: servidor.URL, Segredo: "s3gredo"}})
+
+	sim := arrependimentoForTest(t)
+	aplicarEventos(t, n, sim)
+
+	if len(loja.recebidas) != 1 || loja.assinaturaInvalida {
+		t.Fatalf("Expected one signed notification, got %d (invalid signature: %v)", len(loja.recebidas), loja.assinaturaInvalida)
+	}
+	recebida := loja.recebidas[0]
+	var p contrato.Pedido
+	json.Unmarshal(recebida.Pedido, &p)
+	if recebida.Evento != "RegistrarArrependimento" || recebida.ID != sim.Historico[2].TxID+":la1:" || recebida.Bloco != 2 ||
+		p.Devolucao.Status != contrato.StatusDevolucaoSolicitada {
+		t.Fatalf("Unexpected notification %+v", recebida)
+	}
+	if n.ProximoBloco() != 3 {
+		t.Fatalf("Expected next block 3, got %d", n.ProximoBloco())
+	}
+}
+
+func TestNotificaVendedorDoMarketplace(t *testing.T) {
+	fmt.Println("Entering TestNotificaVendedorDoMarketplace")
+	lojaA := &lojaFalsa{segredo: "a"}
+	lojaB := &lojaFalsa{segredo: "b"}
+	servidorA := httptest.NewServer(lojaA)
+	servidorB := httptest.NewServer(lojaB)
+	defer servidorA.Close()
+	defer servidorB.Close()
+	n, _ := novoNotificadorForTest(t, map[string]Destino{
+		"lojaA": {URL: servidorA.URL, Segredo: "a"},
+		"lojaB": {URL: servidorB.URL, Segredo: "b", Eventos: []string{"RegistrarPedido"}},
+	})
+
+	itens := `,"itens":[{"id":"234","vendedor":"lojaA"},{"id":"445","vendedor":"lojaB"}]`
+	sim := novoSimuladorForTest()
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la1", pedidoTeste("la1", 1, itens))
+	sim.DeveInvocar(t, "RegistrarEntrega", "la1", "1504022407000", "lojaA")
+	sim.ComoClienteDe(t, "la1").DeveInvocar(t, "RegistrarArrependimento", "la1", "1504108807000", simulador.ChaveNFe(2), "lojaA")
+	aplicarEventos(t, n, sim)
+
+	if len(lojaA.recebidas) != 1 || lojaA.recebidas[0].Evento != "RegistrarArrependimento" || lojaA.recebidas[0].Loja != "lojaA" {
+		t.Fatalf("Expected lojaA notified of the regret, got %+v", lojaA.recebidas)
+	}
+	if len(lojaB.recebidas) != 1 || lojaB.recebidas[0].Evento != "RegistrarPedido" || lojaB.assinaturaInvalida || lojaA.assinaturaInvalida {
+		t.Fatalf("Expected lojaB notified only of the new pedido, got %+v", lojaB.recebidas)
+	}
+}
+
+func TestRepeteComEsperaCrescente(t *testing.T) {
+	fmt.Println("Entering TestRepeteComEsperaCrescente")
+	loja := &lojaFalsa{segredo: "s", status: []int{503, 429, 500}}
+	servidor := httptest.NewServer(loja)
+	defer servidor.Close()
+	n, esperas := novoNotificadorForTest(t, map[string]Destino{"": {URL: servidor.URL, Segredo: "s"}})
+	n.EsperaMaxima = 3 * time.Second
+
+	aplicarEventos(t, n, arrependimentoForTest(t))
+	if len(loja.recebidas) != 1 || loja.tentativas != 4 {
+		t.Fatalf("Expected delivery on the 4th attempt, got %d attempts", loja.tentativas)
+	}
+	if len(*esperas) != 3 || (*esperas)[0] != time.Second || (*esperas)[1] != 2*time.Second || (*esperas)[2] != 3*time.Second {
+		t.Fatalf("Expected waits of 1s, 2s and 3s, got %v", *esperas)
+	}
+	falhas, _ := n.Falhas()
+	if len(falhas) != 0 {
+		t.Fatalf("Expected no dead letters, got %+v", falhas)
+	}
+}
+
+func TestArquivoDeFalhasEReenvio(t *testing.T) {
+	fmt.Println("Entering TestArquivoDeFalhasEReenvio")
+	loja := &lojaFalsa{segredo: "s", status: []int{500, 500, 500, 400}}
+	servidor := httptest.NewServer(loja)
+	defer servidor.Close()
+	n, _ := novoNotificadorForTest(t, map[string]Destino{"": {URL: servidor.URL, Segredo: "s"}})
+	n.Tentativas = 3
+
+	sim := arrependimentoForTest(t)
+	//mais um pedido com arrependimento, recusado com 400: sem novas tentativas
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la2", pedidoTeste("la2", 3, ""))
+	sim.DeveInvocar(t, "RegistrarEntrega", "la2", "1504022407000")
+	sim.ComoClienteDe(t, "la2").DeveInvocar(t, "RegistrarArrependimento", "la2", "1504108807000", simulador.ChaveNFe(4))
+	aplicarEventos(t, n, sim)
+
+	falhas, err := n.Falhas()
+	if err != nil || len(falhas) != 2 || loja.tentativas != 4 {
+		t.Fatalf("Expected both notifications in the dead-letter file after 4 attempts, got %+v %v (%d attempts)", falhas, err, loja.tentativas)
+	}
+	if falhas[0].Tentativas != 3 || falhas[1].Tentativas != 1 || !strings.Contains(falhas[1].Erro, "HTTP 400") {
+		t.Fatalf("Unexpected dead letters %+v", falhas)
+	}
+	//a loja nao segura o processamento dos blocos
+	if n.ProximoBloco() != uint64(len(sim.Eventos)) {
+		t.Fatalf("Expected all blocks processed, next block %d", n.ProximoBloco())
+	}
+
+	loja.status = []int{500, 500, 500}
+	entregues, pendentes, err := n.Reenviar(context.Background())
+	if err != nil || entregues != 1 || pendentes != 1 {
+		t.Fatalf("Expected one delivered and one still failing, got %d %d %v", entregues, pendentes, err)
+	}
+	falhas, _ = n.Falhas()
+	if len(falhas) != 1 || falhas[0].Notificacao.ID != sim.Historico[2].TxID+":la1:" || falhas[0].Tentativas != 6 {
+		t.Fatalf("Expected la1 still in the file with 6 attempts, got %+v", falhas)
+	}
+	entregues, pendentes, _ = n.Reenviar(context.Background())
+	falhas, _ = n.Falhas()
+	if entregues != 1 || pendentes != 0 || len(falhas) != 0 || len(loja.recebidas) != 2 {
+		t.Fatalf("Expected the dead-letter file emptied, got %d %d %+v", entregues, pendentes, falhas)
+	}
+}
+
+func TestRetomaPeloArquivoDeEstado(t *testing.T) {
+	fmt.Println("Entering TestRetomaPeloArquivoDeEstado")
+	n, _ := novoNotificadorForTest(t, map[string]Destino{})
+	n.ArquivoEstado = filepath.Join(t.TempDir(), "notificador.json")
+	existe, err := n.CarregarEstado()
+	if existe || err != nil {
+		t.Fatalf("Expected no state on the first run, got %v %v", existe, err)
+	}
+	aplicarEventos(t, n, arrependimentoForTest(t))
+
+	outro, _ := novoNotificadorForTest(t, map[string]Destino{})
+	outro.ArquivoEstado = n.ArquivoEstado
+	existe, err = outro.CarregarEstado()
+	if !existe || err != nil || outro.ProximoBloco() != 3 {
+		t.Fatalf("Expected to resume from block 3, got %d %v", outro.ProximoBloco(), err)
+	}
+}
+
+func TestVerificarAssinatura(t *testing.T) {
+	fmt.Println("Entering TestVerificarAssinatura")
+	corpo := []byte(`{"id":"tx1:la1:"}`)
+	assinatura := Assinar("s", agoraTeste.Unix(), corpo)
+	timestamp := fmt.Sprint(agoraTeste.Unix())
+	if !VerificarAssinatura("s", timestamp, corpo, assinatura, agoraTeste.Add(time.Minute), 5*time.Minute) {
+		t.Fatalf("Expected valid signature")
+	}
+	if VerificarAssinatura("outro", timestamp, corpo, assinatura, agoraTeste, 5*time.Minute) ||
+		VerificarAssinatura("s", timestamp, []byte(`{"id":"tx2:la1:"}`), assinatura, agoraTeste, 5*time.Minute) ||
+		VerificarAssinatura("s", timestamp, corpo, assinatura, agoraTeste.Add(time.Hour), 5*time.Minute) {
+		t.Fatalf("Expected wrong secret, changed body and old timestamp to be rejected")
+	}
+}
@@ -0,0 +1,254 @@
+//Package notificacao avisa as lojas por webhook dos eventos de pedido do SaleContractChainCode,
+//por exemplo quando o cliente registra um arrependimento. Cada POST e assinado com HMAC, as
+//falhas temporarias sao repetidas com espera crescente e as que esgotam as tentativas vao para
+//um arquivo de falhas, de onde podem ser reenviadas.
+package notificacao
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/projecao"
+)
+
+//eventos notificados quando a loja nao escolhe outros
+var eventosPadrao = []string{"RegistrarArrependimento"}
+
+//webhook de uma loja
+type Destino struct {
+	URL                    string        `json:"url"`
+	Segredo                string        `json:"segredo"`
+	// funcoes do contrato que geram notificacao; vazio usa RegistrarArrependimento
+	Eventos                []string      `json:"eventos"`
+}
+
+//lojas pelo vendedor do subpedido; a chave "" e a loja dos pedidos sem marketplace
+type Config struct {
+	Lojas                  map[string]Destino `json:"lojas"`
+}
+
+//corpo do POST
+type Notificacao struct {
+	// txID:pedidoID:loja, igual nos reenvios, para a loja descartar repetidas
+	ID                     string        `json:"id"`
+	// funcao do contrato que gravou o pedido
+	Evento                 string        `json:"evento"`
+	TxID                   string        `json:"txId"`
+	Bloco                  uint64        `json:"bloco"`
+	Loja                   string        `json:"loja"`
+	// pedido como ficou gravado, com o CPF cifrado
+	Pedido                 json.RawMessage `json:"pedido"`
+}
+
+type Notificador struct {
+	Config                 Config
+	HTTP                   *http.Client
+	// tentativas por notificacao antes de ir para o arquivo de falhas
+	Tentativas             int
+	// espera antes da segunda tentativa, dobrada a cada nova tentativa ate EsperaMaxima
+	Espera                 time.Duration
+	EsperaMaxima           time.Duration
+	// arquivo JSON Lines com as notificacoes que esgotaram as tentativas
+	ArquivoFalhas          string
+	// arquivo com o proximo bloco a processar; vazio mantem so em memoria
+	ArquivoEstado          string
+	proximoBloco           uint64
+	// trocados nos testes
+	agora                  func() time.Time
+	dormir                 func(ctx context.Context, d time.Duration) error
+}
+
+func Novo(config Config, arquivoFalhas string) *Notificador {
+	return &Notificador{
+		Config:        config,
+		HTTP:          &http.Client{Timeout: 10 * time.Second},
+		Tentativas:    5,
+		Espera:        time.Second,
+		EsperaMaxima:  time.Minute,
+		ArquivoFalhas: arquivoFalhas,
+		agora:         time.Now,
+		dormir:        dormir,
+	}
+}
+
+func dormir(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+//notificacoes das lojas que assinam a funcao do evento
+func (n *Notificador) Notificacoes(e projecao.Evento) ([]Notificacao, error) {
+	var evento contrato.EventoPedidos
+	err := json.Unmarshal(e.Payload, &evento)
+	if err != nil {
+		return nil, err
+	}
+	notificacoes := []Notificacao{}
+	for _, bytes := range evento.Pedidos {
+		var p contrato.Pedido
+		err = json.Unmarshal(bytes, &p)
+		if err != nil {
+			return nil, err
+		}
+		for _, loja := range lojasDoPedido(&p) {
+			destino, ok := n.Config.Lojas[loja]
+			if !ok || !assina(destino, evento.Funcao) {
+				continue
+			}
+			notificacoes = append(notificacoes, Notificacao{
+				ID:     e.TxID + ":" + p.ID + ":" + loja,
+				Evento: evento.Funcao,
+				TxID:   e.TxID,
+				Bloco:  e.Bloco,
+				Loja:   loja,
+				Pedido: bytes,
+			})
+		}
+	}
+	return notificacoes, nil
+}
+
+//vendedores dos subpedidos, ou a loja padrao "" quando o pedido nao e de marketplace
+func lojasDoPedido(p *contrato.Pedido) []string {
+	if len(p.SubPedidos) == 0 {
+		return []string{""}
+	}
+	lojas := []string{}
+	for _, sub := range p.SubPedidos {
+		lojas = append(lojas, sub.Vendedor)
+	}
+	return lojas
+}
+
+func assina(d Destino, funcao string) bool {
+	eventos := d.Eventos
+	if len(eventos) == 0 {
+		eventos = eventosPadrao
+	}
+	for _, e := range eventos {
+		if e == funcao {
+			return true
+		}
+	}
+	return false
+}
+
+//envia com as tentativas configuradas; devolve o erro da ultima e quantas foram feitas
+func (n *Notificador) Enviar(ctx context.Context, notificacao Notificacao) (int, error) {
+	destino, ok := n.Config.Lojas[notificacao.Loja]
+	if !ok {
+		return 0, fmt.Errorf("No webhook configured for loja %q", notificacao.Loja)
+	}
+	corpo, err := json.Marshal(&notificacao)
+	if err != nil {
+		return 0, err
+	}
+	espera := n.Espera
+	for tentativa := 1; ; tentativa++ {
+		temporario, err := n.postar(ctx, destino, notificacao.ID, corpo)
+		if err == nil || !temporario || tentativa >= n.Tentativas {
+			return tentativa, err
+		}
+		if n.dormir(ctx, espera) != nil {
+			return tentativa, err
+		}
+		espera *= 2
+		if espera > n.EsperaMaxima {
+			espera = n.EsperaMaxima
+		}
+	}
+}
+
+//um POST; temporario indica se vale tentar de novo (rede, 429 e 5xx)
+func (n *Notificador) postar(ctx context.Context, destino Destino, id string, corpo []byte) (bool, error) {
+	requisicao, err := http.NewRequest("POST", destino.URL, bytes.NewReader(corpo))
+	if err != nil {
+		return false, err
+	}
+	timestamp := n.agora().Unix()
+	requisicao.Header.Set("Content-Type", "application/json")
+	requisicao.Header.Set(CabecalhoID, id)
+	requisicao.Header.Set(CabecalhoTimestamp, fmt.Sprint(timestamp))
+	requisicao.Header.Set(CabecalhoAssinatura, Assinar(destino.Segredo, timestamp, corpo))
+	resposta, err := n.HTTP.Do(requisicao.WithContext(ctx))
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	ioutil.ReadAll(resposta.Body)
+	resposta.Body.Close()
+	if resposta.StatusCode >= 200 && resposta.StatusCode < 300 {
+		return false, nil
+	}
+	temporario := resposta.StatusCode == http.StatusTooManyRequests || resposta.StatusCode >= 500
+	return temporario, fmt.Errorf("Webhook %s answered HTTP %d", destino.URL, resposta.StatusCode)
+}
+
+func (n *Notificador) ProximoBloco() uint64 {
+	return n.proximoBloco
+}
+
+//notifica os eventos do bloco. Uma loja fora do ar nao segura as demais: o que esgota as
+//tentativas vai para o arquivo de falhas e o bloco e dado como processado
+func (n *Notificador) AplicarBloco(numero uint64, eventos []projecao.Evento) error {
+	ctx := context.Background()
+	for _, e := range eventos {
+		notificacoes, err := n.Notificacoes(e)
+		if err != nil {
+			return err
+		}
+		for _, notificacao := range notificacoes {
+			tentativas, err := n.Enviar(ctx, notificacao)
+			if err == nil {
+				continue
+			}
+			log.Printf("webhook %s failed after %d attempts: %s", notificacao.ID, tentativas, err)
+			err = n.registrarFalha(notificacao, tentativas, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return n.DefinirProximoBloco(numero + 1)
+}
+
+//define o ponto de retomada e grava no ArquivoEstado
+func (n *Notificador) DefinirProximoBloco(bloco uint64) error {
+	n.proximoBloco = bloco
+	if n.ArquivoEstado == "" {
+		return nil
+	}
+	conteudo, _ := json.Marshal(map[string]uint64{"proximoBloco": bloco})
+	return gravarArquivo(n.ArquivoEstado, conteudo)
+}
+
+//le o ponto de retomada do ArquivoEstado; false quando ainda nao existe
+func (n *Notificador) CarregarEstado() (bool, error) {
+	conteudo, err := ioutil.ReadFile(n.ArquivoEstado)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var estado struct {
+		ProximoBloco           uint64        `json:"proximoBloco"`
+	}
+	err = json.Unmarshal(conteudo, &estado)
+	if err != nil {
+		return false, err
+	}
+	n.proximoBloco = estado.ProximoBloco
+	return true, nil
+}
@@ -0,0 +1,171 @@
+//Package peer chama o chaincode pelo endpoint REST /chaincode (JSON-RPC 2.0) de um peer
+//do fabric v0.6, o mesmo usado na colecao do Postman do repositorio.
+package peer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//tipo de chaincode GOLANG no JSON-RPC do peer
+const tipoGolang = 1
+
+//codigos de Erro quando a funcao do chaincode falha
+const (
+	CodigoErroInvoke = -32002
+	CodigoErroQuery  = -32003
+)
+
+type Cliente struct {
+	// por exemplo http://localhost:7050
+	URL                    string
+	// nome (hash) devolvido no deploy do chaincode
+	ChaincodeID            string
+	// enrollID ja logado no peer pelo /registrar
+	Usuario                string
+	// atributos do certificado enviados ao chaincode, por exemplo role e chaveCPF
+	Atributos              []string
+	// metadados enviados em cada chamada, por exemplo a chaveCampos do contrato
+	Metadados              []byte
+	HTTP                   *http.Client
+	proximoID              int
+}
+
+//erro devolvido pelo peer ou pelo chaincode
+type Erro struct {
+	Codigo                 int           `json:"code"`
+	Mensagem               string        `json:"message"`
+	// para erros do chaincode, a mensagem de erro devolvida pela funcao
+	Dados                  string        `json:"data"`
+}
+
+func (e *Erro) Error() string {
+	if e.Dados != "" {
+		return e.Mensagem + ": " + e.Dados
+	}
+	return e.Mensagem
+}
+
+type requisicao struct {
+	JSONRPC                string        `json:"jsonrpc"`
+	Metodo                 string        `json:"method"`
+	Parametros             parametros    `json:"params"`
+	ID                     int           `json:"id"`
+}
+
+type parametros struct {
+	Tipo                   int           `json:"type"`
+	ChaincodeID            chaincodeID   `json:"chaincodeID"`
+	CtorMsg                CtorMsg       `json:"ctorMsg"`
+	SecureContext          string        `json:"secureContext,omitempty"`
+	Atributos              []string      `json:"attributes,omitempty"`
+	// base64 no JSON, como o campo bytes do ChaincodeSpec
+	Metadados              []byte        `json:"metadata,omitempty"`
+}
+
+type chaincodeID struct {
+	Nome                   string        `json:"name"`
+}
+
+//funcao e argumentos passados ao chaincode
+type CtorMsg struct {
+	Funcao                 string        `json:"function"`
+	Args                   []string      `json:"args"`
+}
+
+type resposta struct {
+	Resultado              *struct {
+		Status                 string        `json:"status"`
+		Mensagem               string        `json:"message"`
+	}                                    `json:"result"`
+	Erro                   *Erro         `json:"error"`
+}
+
+func Novo(url string, chaincodeID string, usuario string) *Cliente {
+	return &Cliente{
+		URL:         strings.TrimSuffix(url, "/"),
+		ChaincodeID: chaincodeID,
+		Usuario:     usuario,
+		HTTP:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+//submete a transacao e devolve o ID dela. O peer responde antes do commit, entao o
+//resultado da funcao so pode ser lido depois, por uma query
+func (c *Cliente) Invoke(ctx context.Context, funcao string, args ...string) (string, error) {
+	return c.chamar(ctx, "invoke", funcao, args)
+}
+
+//devolve o payload da funcao de query
+func (c *Cliente) Query(ctx context.Context, funcao string, args ...string) ([]byte, error) {
+	mensagem, err := c.chamar(ctx, "query", funcao, args)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(mensagem), nil
+}
+
+//corpo JSON-RPC da chamada, o mesmo que se montava a mao no Postman
+func (c *Cliente) Requisicao(metodo string, funcao string, args []string) ([]byte, error) {
+	if args == nil {
+		args = []string{}
+	}
+	c.proximoID++
+	return json.Marshal(requisicao{
+		JSONRPC: "2.0",
+		Metodo:  metodo,
+		Parametros: parametros{
+			Tipo:          tipoGolang,
+			ChaincodeID:   chaincodeID{c.ChaincodeID},
+			CtorMsg:       CtorMsg{funcao, args},
+			SecureContext: c.Usuario,
+			Atributos:     c.Atributos,
+			Metadados:     c.Metadados,
+		},
+		ID: c.proximoID,
+	})
+}
+
+func (c *Cliente) chamar(ctx context.Context, metodo string, funcao string, args []string) (string, error) {
+	if c.ChaincodeID == "" {
+		return "", errors.New("Missing chaincode ID")
+	}
+	corpo, err := c.Requisicao(metodo, funcao, args)
+	if err != nil {
+		return "", err
+	}
+	httpRequisicao, err := http.NewRequest("POST", c.URL+"/chaincode", bytes.NewReader(corpo))
+	if err != nil {
+		return "", err
+	}
+	httpRequisicao.Header.Set("Content-Type", "application/json")
+	httpResposta, err := c.HTTP.Do(httpRequisicao.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer httpResposta.Body.Close()
+	conteudo, err := ioutil.ReadAll(httpResposta.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var r resposta
+	err = json.Unmarshal(conteudo, &r)
+	if err != nil {
+		return "", fmt.Errorf("Invalid response from peer (HTTP %d): %s", httpResposta.StatusCode, string(conteudo))
+	}
+	if r.Erro != nil {
+		return "", r.Erro
+	}
+	if r.Resultado == nil || r.Resultado.Status != "OK" {
+		return "", fmt.Errorf("Unexpected response from peer: %s", string(conteudo))
+	}
+	return r.Resultado.Mensagem, nil
+}
@@ -0,0 +1,97 @@
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//peer falso: devolve "tx-<funcao>" nos invokes, o primeiro arg nas queries e erro para "Falhar"
+func servidorFalso(t *testing.T, recebidas *[]requisicao) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chaincode" {
+			t.Fatalf("Unexpected path %s", r.URL.Path)
+		}
+		corpo, _ := ioutil.ReadAll(r.Body)
+		var req requisicao
+		json.Unmarshal(corpo, &req)
+		*recebidas = append(*recebidas, req)
+		if req.Parametros.CtorMsg.Funcao == "Falhar" {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","error":{"code":-32003,"message":"Query failure","data":"Error when querying chaincode: Pedido x not found"},"id":%d}`, req.ID)
+			return
+		}
+		mensagem := "tx-" + req.Parametros.CtorMsg.Funcao
+		if req.Metodo == "query" {
+			mensagem = req.Parametros.CtorMsg.Args[0]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"result":  map[string]string{"status": "OK", "message": mensagem},
+			"id":      req.ID,
+		})
+	}))
+}
+
+func TestInvokeEQuery(t *testing.T) {
+	fmt.Println("Entering TestInvokeEQuery")
+	recebidas := []requisicao{}
+	servidor := servidorFalso(t, &recebidas)
+	defer servidor.Close()
+
+	cliente := Novo(servidor.URL+"/", "abc123", "loja01")
+	cliente.Atributos = []string{"role"}
+	cliente.Metadados = []byte(`{"chaveCampos":"00"}`)
+	txID, err := cliente.Invoke(context.Background(), "RegistrarEntrega", "la1", "1504000000000")
+	if err != nil || txID != "tx-RegistrarEntrega" {
+		t.Fatalf("Expected transaction ID from invoke, got %q %v", txID, err)
+	}
+	payload, err := cliente.Query(context.Background(), "ObterPedido", `{"id":"la1"}`)
+	if err != nil || string(payload) != `{"id":"la1"}` {
+		t.Fatalf("Expected query payload, got %q %v", payload, err)
+	}
+
+	req := recebidas[0]
+	if req.Metodo != "invoke" || req.Parametros.Tipo != 1 || req.Parametros.ChaincodeID.Nome != "abc123" ||
+		req.Parametros.SecureContext != "loja01" || req.Parametros.Atributos[0] != "role" ||
+		string(req.Parametros.Metadados) != `{"chaveCampos":"00"}` {
+		t.Fatalf("Unexpected JSON-RPC request %+v", req)
+	}
+	if len(req.Parametros.CtorMsg.Args) != 2 || recebidas[1].ID == req.ID {
+		t.Fatalf("Expected args and a new id per request")
+	}
+}
+
+func TestErroDoChaincode(t *testing.T) {
+	fmt.Println("Entering TestErroDoChaincode")
+	recebidas := []requisicao{}
+	servidor := servidorFalso(t, &recebidas)
+	defer servidor.Close()
+
+	_, err := Novo(servidor.URL, "abc123", "").Query(context.Background(), "Falhar")
+	erro, ok := err.(*Erro)
+	if !ok || erro.Codigo != -32003 || erro.Dados != "Error when querying chaincode: Pedido x not found" {
+		t.Fatalf("Expected the peer error, got %v", err)
+	}
+	_, err = Novo(servidor.URL, "", "").Query(context.Background(), "ObterPedido", "la1")
+	if err == nil {
+		t.Fatalf("Expected missing chaincode ID to be rejected")
+	}
+}
+
+func TestContextoCancelado(t *testing.T) {
+	fmt.Println("Entering TestContextoCancelado")
+	recebidas := []requisicao{}
+	servidor := servidorFalso(t, &recebidas)
+	defer servidor.Close()
+
+	ctx, cancelar := context.WithCancel(context.Background())
+	cancelar()
+	_, err := Novo(servidor.URL, "abc123", "").Invoke(ctx, "RegistrarEntrega", "la1", "1504000000000")
+	if err == nil || len(recebidas) != 0 {
+		t.Fatalf("Expected canceled context to stop the request, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+//Package projecao mantem um modelo de leitura local dos pedidos a partir dos eventos do
+//SaleContractChainCode, para dashboards e relatorios pesados nao consultarem os peers.
+package projecao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+)
+
+//evento de chaincode de uma transacao de um bloco
+type Evento struct {
+	Bloco                  uint64
+	TxID                   string
+	Nome                   string
+	Payload                []byte
+}
+
+//de onde vem os eventos, bloco a bloco
+type Fonte interface {
+	// quantidade de blocos da cadeia; o ultimo e Altura-1
+	Altura(ctx context.Context) (uint64, error)
+	// eventos do chaincode no bloco, na ordem das transacoes
+	Eventos(ctx context.Context, bloco uint64) ([]Evento, error)
+}
+
+//le os blocos pelo REST do peer v0.6 (GET /chain e /chain/blocks/N). Os eventos de chaincode
+//ficam no nonHashData de cada bloco
+type FonteREST struct {
+	URL                    string
+	// nome (hash) devolvido no deploy; eventos de outros chaincodes sao ignorados
+	ChaincodeID            string
+	HTTP                   *http.Client
+}
+
+func NovaFonteREST(url string, chaincodeID string) *FonteREST {
+	return &FonteREST{
+		URL:         strings.TrimSuffix(url, "/"),
+		ChaincodeID: chaincodeID,
+		HTTP:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type cadeia struct {
+	Altura                 uint64        `json:"height"`
+}
+
+type bloco struct {
+	NonHashData            struct {
+		ChaincodeEvents        []struct {
+			ChaincodeID            string        `json:"chaincodeID"`
+			TxID                   string        `json:"txID"`
+			EventName              string        `json:"eventName"`
+			Payload                []byte        `json:"payload"`
+		}                                    `json:"chaincodeEvents"`
+	}                                    `json:"nonHashData"`
+}
+
+func (f *FonteREST) Altura(ctx context.Context) (uint64, error) {
+	var c cadeia
+	err := f.obter(ctx, "/chain", &c)
+	return c.Altura, err
+}
+
+func (f *FonteREST) Eventos(ctx context.Context, numero uint64) ([]Evento, error) {
+	var b bloco
+	err := f.obter(ctx, "/chain/blocks/"+strconv.FormatUint(numero, 10), &b)
+	if err != nil {
+		return nil, err
+	}
+	eventos := []Evento{}
+	for _, e := range b.NonHashData.ChaincodeEvents {
+		//transacoes sem evento aparecem com o evento vazio
+		if e.ChaincodeID != f.ChaincodeID || e.EventName != contrato.NomeEventoPedidos {
+			continue
+		}
+		eventos = append(eventos, Evento{numero, e.TxID, e.EventName, e.Payload})
+	}
+	return eventos, nil
+}
+
+func (f *FonteREST) obter(ctx context.Context, caminho string, destino interface{}) error {
+	requisicao, err := http.NewRequest("GET", f.URL+caminho, nil)
+	if err != nil {
+		return err
+	}
+	resposta, err := f.HTTP.Do(requisicao.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resposta.Body.Close()
+	conteudo, err := ioutil.ReadAll(resposta.Body)
+	if err != nil {
+		return err
+	}
+	if resposta.StatusCode != http.StatusOK {
+		return fmt.Errorf("Peer answered HTTP %d for %s: %s", resposta.StatusCode, caminho, string(conteudo))
+	}
+	return json.Unmarshal(conteudo, destino)
+}
@@ -0,0 +1,64 @@
+package projecao
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//consultas do modelo de leitura:
+//
+//	GET /pedidos?status=S&cpfHash=H&vendedor=V&de=MS&ate=MS
+//	GET /pedidos/{id}
+//	GET /atrasados?referencia=MS
+//	GET /contagem
+//	GET /sincronizacao
+func NovoHandler(m *Modelo) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pedidos", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		de, err1 := inteiro(q.Get("de"))
+		ate, err2 := inteiro(q.Get("ate"))
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Invalid timestamp value", http.StatusBadRequest)
+			return
+		}
+		escreverJSON(w, m.Listar(Filtro{q.Get("status"), q.Get("cpfHash"), q.Get("vendedor"), de, ate}))
+	})
+	mux.HandleFunc("/pedidos/", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := m.Pedido(strings.TrimPrefix(r.URL.Path, "/pedidos/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		escreverJSON(w, p)
+	})
+	mux.HandleFunc("/atrasados", func(w http.ResponseWriter, r *http.Request) {
+		referencia, err := inteiro(r.URL.Query().Get("referencia"))
+		if err != nil || referencia == 0 {
+			http.Error(w, "Expected reference timestamp", http.StatusBadRequest)
+			return
+		}
+		escreverJSON(w, m.Atrasados(referencia))
+	})
+	mux.HandleFunc("/contagem", func(w http.ResponseWriter, r *http.Request) {
+		escreverJSON(w, m.ContagemPorStatus())
+	})
+	mux.HandleFunc("/sincronizacao", func(w http.ResponseWriter, r *http.Request) {
+		escreverJSON(w, map[string]uint64{"proximoBloco": m.ProximoBloco()})
+	})
+	return mux
+}
+
+func inteiro(valor string) (int64, error) {
+	if valor == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(valor, 10, 64)
+}
+
+func escreverJSON(w http.ResponseWriter, valor interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(valor)
+}
@@ -0,0 +1,213 @@
+package projecao
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+)
+
+//pedido como ficou depois do ultimo evento, com a origem da informacao
+type PedidoProjetado struct {
+	Pedido                 contrato.Pedido `json:"pedido"`
+	// REGISTRADO, ENTREGUE, EM_DEVOLUCAO, DEVOLVIDO ou TROCADO
+	Status                 string        `json:"status"`
+	// funcao do invoke que gravou o pedido por ultimo
+	UltimaFuncao           string        `json:"ultimaFuncao"`
+	TxID                   string        `json:"txId"`
+	Bloco                  uint64        `json:"bloco"`
+}
+
+//modelo de leitura gravado num arquivo JSON. O arquivo e regravado inteiro a cada bloco com pedidos,
+//junto com o proximo bloco a processar, entao o ponto de retomada nunca fica a frente dos pedidos
+type Modelo struct {
+	arquivo                string
+	mutex                  sync.RWMutex
+	estado                 estado
+}
+
+type estado struct {
+	ProximoBloco           uint64        `json:"proximoBloco"`
+	Pedidos                map[string]*PedidoProjetado `json:"pedidos"`
+}
+
+//filtro do Listar; campos vazios nao filtram
+type Filtro struct {
+	Status                 string
+	CPFHash                string
+	Vendedor               string
+	// intervalo da data da venda, em milissegundos
+	De                     int64
+	Ate                    int64
+}
+
+//abre o modelo gravado ou comeca um vazio; arquivo vazio mantem o modelo so em memoria
+func Abrir(arquivo string) (*Modelo, error) {
+	m := &Modelo{arquivo: arquivo, estado: estado{Pedidos: make(map[string]*PedidoProjetado)}}
+	if arquivo == "" {
+		return m, nil
+	}
+	conteudo, err := ioutil.ReadFile(arquivo)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(conteudo, &m.estado)
+	if err != nil {
+		return nil, err
+	}
+	if m.estado.Pedidos == nil {
+		m.estado.Pedidos = make(map[string]*PedidoProjetado)
+	}
+	return m, nil
+}
+
+func (m *Modelo) ProximoBloco() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.estado.ProximoBloco
+}
+
+//aplica os eventos do bloco e grava o modelo com o bloco seguinte como ponto de retomada. Bloco sem
+//pedidos so avanca o ponto de retomada em memoria: no reinicio ele e lido de novo e nao muda nada
+func (m *Modelo) AplicarBloco(numero uint64, eventos []Evento) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	alterado := false
+	for _, e := range eventos {
+		var evento contrato.EventoPedidos
+		err := json.Unmarshal(e.Payload, &evento)
+		if err != nil {
+			return err
+		}
+		for _, bytes := range evento.Pedidos {
+			var p contrato.Pedido
+			err = json.Unmarshal(bytes, &p)
+			if err != nil {
+				return err
+			}
+			//os eventos chegam na ordem do ledger: o ultimo e o estado atual
+			m.estado.Pedidos[p.ID] = &PedidoProjetado{p, contrato.StatusPedido(&p), evento.Funcao, e.TxID, numero}
+			alterado = true
+		}
+	}
+	m.estado.ProximoBloco = numero + 1
+	if !alterado {
+		return nil
+	}
+	return m.gravar()
+}
+
+//grava num arquivo temporario e renomeia, para nao deixar o modelo pela metade
+func (m *Modelo) gravar() error {
+	if m.arquivo == "" {
+		return nil
+	}
+	conteudo, err := json.Marshal(&m.estado)
+	if err != nil {
+		return err
+	}
+	temporario, err := ioutil.TempFile(filepath.Dir(m.arquivo), filepath.Base(m.arquivo)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temporario.Write(conteudo)
+	if err == nil {
+		err = temporario.Sync()
+	}
+	temporario.Close()
+	if err != nil {
+		os.Remove(temporario.Name())
+		return err
+	}
+	return os.Rename(temporario.Name(), m.arquivo)
+}
+
+func (m *Modelo) Pedido(id string) (PedidoProjetado, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	p, ok := m.estado.Pedidos[id]
+	if !ok {
+		return PedidoProjetado{}, false
+	}
+	return *p, true
+}
+
+//pedidos do filtro, pela data da venda e pelo ID
+func (m *Modelo) Listar(f Filtro) []PedidoProjetado {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	resultado := []PedidoProjetado{}
+	for _, p := range m.estado.Pedidos {
+		if f.aceita(p) {
+			resultado = append(resultado, *p)
+		}
+	}
+	ordenar(resultado)
+	return resultado
+}
+
+func (f Filtro) aceita(p *PedidoProjetado) bool {
+	if f.Status != "" && p.Status != f.Status {
+		return false
+	}
+	if f.CPFHash != "" && p.Pedido.CPFHash != f.CPFHash {
+		return false
+	}
+	if f.De != 0 && p.Pedido.DataVenda < f.De {
+		return false
+	}
+	if f.Ate != 0 && p.Pedido.DataVenda > f.Ate {
+		return false
+	}
+	if f.Vendedor != "" {
+		for _, sub := range p.Pedido.SubPedidos {
+			if sub.Vendedor == f.Vendedor {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+//quantidade de pedidos em cada status
+func (m *Modelo) ContagemPorStatus() map[string]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	contagem := make(map[string]int)
+	for _, p := range m.estado.Pedidos {
+		contagem[p.Status]++
+	}
+	return contagem
+}
+
+//pedidos nao entregues com o prazo de entrega vencido na data de referencia
+func (m *Modelo) Atrasados(referencia int64) []PedidoProjetado {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	resultado := []PedidoProjetado{}
+	for _, p := range m.estado.Pedidos {
+		if p.Pedido.DataEntrega == 0 && p.Pedido.DataPrazoEntrega != 0 && p.Pedido.DataPrazoEntrega < referencia {
+			resultado = append(resultado, *p)
+		}
+	}
+	ordenar(resultado)
+	return resultado
+}
+
+//pela data da venda e, no mesmo instante, pelo ID
+func ordenar(pedidos []PedidoProjetado) {
+	sort.Slice(pedidos, func(i, j int) bool {
+		if pedidos[i].Pedido.DataVenda != pedidos[j].Pedido.DataVenda {
+			return pedidos[i].Pedido.DataVenda < pedidos[j].Pedido.DataVenda
+		}
+		return pedidos[i].Pedido.ID < pedidos[j].Pedido.ID
+	})
+}
@@ -0,0 +1,65 @@
+package projecao
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+//quem recebe os blocos do Ouvinte: o Modelo ou, por exemplo, o notificador de webhooks
+type Consumidor interface {
+	// ponto de retomada: o primeiro bloco ainda nao aplicado
+	ProximoBloco() uint64
+	AplicarBloco(numero uint64, eventos []Evento) error
+}
+
+//le os blocos novos da fonte e entrega ao consumidor
+type Ouvinte struct {
+	Fonte                  Fonte
+	Consumidor             Consumidor
+	// espera entre as consultas da altura da cadeia
+	Intervalo              time.Duration
+}
+
+func NovoOuvinte(fonte Fonte, consumidor Consumidor) *Ouvinte {
+	return &Ouvinte{Fonte: fonte, Consumidor: consumidor, Intervalo: 5 * time.Second}
+}
+
+//entrega os blocos do ponto de retomada ate o ultimo da cadeia e devolve quantos foram aplicados
+func (o *Ouvinte) Sincronizar(ctx context.Context) (int, error) {
+	altura, err := o.Fonte.Altura(ctx)
+	if err != nil {
+		return 0, err
+	}
+	aplicados := 0
+	for bloco := o.Consumidor.ProximoBloco(); bloco < altura; bloco++ {
+		eventos, err := o.Fonte.Eventos(ctx, bloco)
+		if err != nil {
+			return aplicados, err
+		}
+		err = o.Consumidor.AplicarBloco(bloco, eventos)
+		if err != nil {
+			return aplicados, err
+		}
+		aplicados++
+	}
+	return aplicados, nil
+}
+
+//sincroniza ate o contexto ser cancelado; erros sao registrados e a proxima rodada tenta de novo
+//a partir do ultimo bloco aplicado
+func (o *Ouvinte) Executar(ctx context.Context) error {
+	for {
+		aplicados, err := o.Sincronizar(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("sync stopped at block %d: %s", o.Consumidor.ProximoBloco(), err)
+		} else if aplicados > 0 {
+			log.Printf("applied %d blocks, next block %d", aplicados, o.Consumidor.ProximoBloco())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.Intervalo):
+		}
+	}
+}
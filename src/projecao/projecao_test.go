@@ -0,0 +1,220 @@
+package projecao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+const chaincodeTeste = "abc123"
+
+type eventoBloco struct {
+	ChaincodeID            string        `json:"chaincodeID"`
+	TxID                   string        `json:"txID"`
+	EventName              string        `json:"eventName"`
+	Payload                []byte        `json:"payload"`
+}
+
+//peer falso com um bloco por transacao do simulador; falharNoBloco responde 500 uma vez
+type peerFalso struct {
+	blocos                 [][]eventoBloco
+	falharNoBloco          int
+}
+
+func (p *peerFalso) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/chain" {
+		json.NewEncoder(w).Encode(map[string]int{"height": len(p.blocos)})
+		return
+	}
+	numero, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/chain/blocks/"))
+	if numero == p.falharNoBloco {
+		p.falharNoBloco = -1
+		http.Error(w, "ledger unavailable", http.StatusInternalServerError)
+		return
+	}
+	var bloco struct {
+		NonHashData struct {
+			ChaincodeEvents []eventoBloco `json:"chaincodeEvents"`
+		} `json:"nonHashData"`
+	}
+	bloco.NonHashData.ChaincodeEvents = p.blocos[numero]
+	json.NewEncoder(w).Encode(&bloco)
+}
+
+//copia para blocos novos os eventos que o simulador emitiu desde a ultima chamada
+func (p *peerFalso) minerar(sim *simuladortest.Simulador, vistos *int) {
+	for _, e := range sim.Eventos[*vistos:] {
+		p.blocos = append(p.blocos, []eventoBloco{
+			//transacao sem evento e evento de outro chaincode no mesmo bloco
+			{},
+			{"outro", "txo", contrato.NomeEventoPedidos, []byte("nao e JSON")},
+			{chaincodeTeste, e.TxID, e.Nome, e.Payload},
+		})
+	}
+	*vistos = len(sim.Eventos)
+}
+
+func novoSimuladorForTest() *simuladortest.Simulador {
+	attributes := make(map[string][]byte)
+	attributes["chaveCPF"] = []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	attributes["chaveIndiceCPF"] = []byte("1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100")
+	sim := simuladortest.Novo(new(contrato.SaleContractChainCode), attributes)
+	sim.Init()
+	return sim
+}
+
+func pedidoTeste(id string, nota int) string {
+	return `{"id":"` + id + `","cpf":"09596397729","itensId":"234","dataVenda":1503849607000,` +
+		`"dataPrazoEntrega":1504454407000,"chaveNFe":"` + simulador.ChaveNFe(nota) + `"}`
+}
+
+func TestSincronizarERetomar(t *testing.T) {
+	fmt.Println("Entering TestSincronizarERetomar")
+	sim := novoSimuladorForTest()
+	peer := &peerFalso{blocos: [][]eventoBloco{{}}, falharNoBloco: -1}
+	servidor := httptest.NewServer(peer)
+	defer servidor.Close()
+	vistos := 0
+
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la1", pedidoTeste("la1", 1))
+	sim.DeveInvocar(t, "RegistrarPedido", "la2", pedidoTeste("la2", 2))
+	sim.DeveInvocar(t, "RegistrarEntrega", "la1", "1504022407000")
+	peer.minerar(sim, &vistos)
+
+	arquivo := filepath.Join(t.TempDir(), "projecao.json")
+	modelo, _ := Abrir(arquivo)
+	ouvinte := NovoOuvinte(NovaFonteREST(servidor.URL, chaincodeTeste), modelo)
+	aplicados, err := ouvinte.Sincronizar(context.Background())
+	if err != nil || aplicados != 4 || modelo.ProximoBloco() != 4 {
+		t.Fatalf("Expected genesis and 3 blocks applied, got %d %v", aplicados, err)
+	}
+	la1, ok := modelo.Pedido("la1")
+	if !ok || la1.Status != contrato.StatusPedidoEntregue || la1.UltimaFuncao != "RegistrarEntrega" || la1.Bloco != 3 || la1.Pedido.Versao != 2 {
+		t.Fatalf("Unexpected projected pedido %+v", la1)
+	}
+
+	//reinicio: o modelo e lido do arquivo e so os blocos novos sao processados
+	sim.ComoClienteDe(t, "la1").DeveInvocar(t, "RegistrarArrependimento", "la1", "1504108807000", simulador.ChaveNFe(3))
+	peer.minerar(sim, &vistos)
+	modelo, err = Abrir(arquivo)
+	if err != nil || modelo.ProximoBloco() != 4 {
+		t.Fatalf("Expected to resume from block 4, got %d %v", modelo.ProximoBloco(), err)
+	}
+	ouvinte = NovoOuvinte(NovaFonteREST(servidor.URL, chaincodeTeste), modelo)
+	aplicados, err = ouvinte.Sincronizar(context.Background())
+	if err != nil || aplicados != 1 {
+		t.Fatalf("Expected only the new block applied, got %d %v", aplicados, err)
+	}
+	la1, _ = modelo.Pedido("la1")
+	contagem := modelo.ContagemPorStatus()
+	if la1.Status != contrato.StatusPedidoEmDevolucao || contagem[contrato.StatusPedidoEmDevolucao] != 1 || contagem[contrato.StatusPedidoRegistrado] != 1 {
+		t.Fatalf("Unexpected model after resume: %+v %v", la1, contagem)
+	}
+}
+
+func TestBlocoSemPedidosNaoGrava(t *testing.T) {
+	fmt.Println("Entering TestBlocoSemPedidosNaoGrava")
+	sim := novoSimuladorForTest()
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la1", pedidoTeste("la1", 1))
+	arquivo := filepath.Join(t.TempDir(), "projecao.json")
+	modelo, _ := Abrir(arquivo)
+
+	err := modelo.AplicarBloco(0, nil)
+	_, erroArquivo := os.Stat(arquivo)
+	if err != nil || !os.IsNotExist(erroArquivo) || modelo.ProximoBloco() != 1 {
+		t.Fatalf("Expected an empty block to advance only in memory, got %v %v", err, erroArquivo)
+	}
+	e := sim.Eventos[0]
+	err = modelo.AplicarBloco(1, []Evento{{1, e.TxID, e.Nome, e.Payload}})
+	if err != nil {
+		t.Fatalf("Expected block with pedidos to be applied: %s", err)
+	}
+	err = modelo.AplicarBloco(2, nil)
+	if err != nil {
+		t.Fatalf("Expected empty block to be applied: %s", err)
+	}
+
+	modelo, err = Abrir(arquivo)
+	if err != nil || modelo.ProximoBloco() != 2 {
+		t.Fatalf("Expected the file to keep block 2 as the resume point, got %d %v", modelo.ProximoBloco(), err)
+	}
+	if _, ok := modelo.Pedido("la1"); !ok {
+		t.Fatalf("Expected la1 in the saved model")
+	}
+}
+
+func TestFalhaRetomaDoMesmoBloco(t *testing.T) {
+	fmt.Println("Entering TestFalhaRetomaDoMesmoBloco")
+	sim := novoSimuladorForTest()
+	peer := &peerFalso{falharNoBloco: 1}
+	servidor := httptest.NewServer(peer)
+	defer servidor.Close()
+	vistos := 0
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la1", pedidoTeste("la1", 1))
+	sim.DeveInvocar(t, "RegistrarEntrega", "la1", "1504022407000")
+	peer.minerar(sim, &vistos)
+
+	modelo, _ := Abrir("")
+	ouvinte := NovoOuvinte(NovaFonteREST(servidor.URL, chaincodeTeste), modelo)
+	aplicados, err := ouvinte.Sincronizar(context.Background())
+	if err == nil || aplicados != 1 || modelo.ProximoBloco() != 1 {
+		t.Fatalf("Expected to stop before the failed block, got %d %v", aplicados, err)
+	}
+	_, err = ouvinte.Sincronizar(context.Background())
+	la1, _ := modelo.Pedido("la1")
+	if err != nil || modelo.ProximoBloco() != 2 || la1.Status != contrato.StatusPedidoEntregue {
+		t.Fatalf("Expected the failed block to be applied on the next sync, got %+v %v", la1, err)
+	}
+}
+
+func TestConsultasHTTP(t *testing.T) {
+	fmt.Println("Entering TestConsultasHTTP")
+	sim := novoSimuladorForTest()
+	sim.ComoPapel(contrato.RoleLoja).DeveInvocar(t, "RegistrarPedido", "la1", pedidoTeste("la1", 1))
+	sim.DeveInvocar(t, "RegistrarPedido", "la2", pedidoTeste("la2", 2))
+	sim.DeveInvocar(t, "RegistrarEntrega", "la2", "1504022407000")
+	modelo, _ := Abrir("")
+	for i, e := range sim.Eventos {
+		modelo.AplicarBloco(uint64(i), []Evento{{uint64(i), e.TxID, e.Nome, e.Payload}})
+	}
+	handler := NovoHandler(modelo)
+
+	consultar := func(caminho string, destino interface{}) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", caminho, nil))
+		json.Unmarshal(w.Body.Bytes(), destino)
+		return w.Code
+	}
+	var lista []PedidoProjetado
+	if consultar("/pedidos?status=ENTREGUE", &lista) != 200 || len(lista) != 1 || lista[0].Pedido.ID != "la2" {
+		t.Fatalf("Expected la2 as ENTREGUE, got %+v", lista)
+	}
+	if consultar("/pedidos?de=1503849607000&ate=1503849607000", &lista) != 200 || len(lista) != 2 || lista[0].Pedido.ID != "la1" {
+		t.Fatalf("Expected both pedidos ordered by ID, got %+v", lista)
+	}
+	if consultar("/atrasados?referencia=1504540807000", &lista) != 200 || len(lista) != 1 || lista[0].Pedido.ID != "la1" {
+		t.Fatalf("Expected la1 late, got %+v", lista)
+	}
+	var p PedidoProjetado
+	if consultar("/pedidos/la1", &p) != 200 || p.Pedido.CPFHash == "" || p.Pedido.CPFCliente == "09596397729" {
+		t.Fatalf("Expected la1 with the CPF as stored in the ledger, got %+v", p)
+	}
+	if consultar("/pedidos/nao-existe", &p) != 404 || consultar("/atrasados", &lista) != 400 {
+		t.Fatalf("Expected 404 for unknown pedido and 400 without reference")
+	}
+	var sincronizacao map[string]uint64
+	if consultar("/sincronizacao", &sincronizacao) != 200 || sincronizacao["proximoBloco"] != 3 {
+		t.Fatalf("Expected next block 3, got %v", sincronizacao)
+	}
+}
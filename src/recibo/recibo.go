@@ -0,0 +1,80 @@
+//Package recibo define o recibo do pedido devolvido pela query ObterRecibo e a verificacao dele
+//fora da rede: o JSON do pedido como esta no ledger, o hash da forma canonica e a transacao que
+//gravou o pedido por ultimo. Nao depende do shim, para o verificador rodar em qualquer maquina.
+package recibo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rodneicouto/chaincode/src/canonico"
+)
+
+//versao do formato do recibo
+const Formato = "pedido-recibo/1"
+
+//SHA-256 da serializacao canonica do pedido (chaves ordenadas, sem espacos)
+const Algoritmo = "sha256-json-canonico"
+
+type Recibo struct {
+	Formato                string        `json:"formato"`
+	PedidoID               string        `json:"pedidoId"`
+	// pedido exatamente como esta no ledger, com o CPF e os campos cifrados
+	Pedido                 json.RawMessage `json:"pedido"`
+	Algoritmo              string        `json:"algoritmo"`
+	Hash                   string        `json:"hash"`
+	// transacao que gravou o pedido por ultimo; vazio nos pedidos gravados antes do recibo existir
+	TxID                   string        `json:"txId,omitempty"`
+	// timestamp dessa transacao, em milissegundos
+	Timestamp              int64         `json:"timestamp,omitempty"`
+}
+
+//monta o recibo calculando o hash do pedido
+func Novo(pedidoID string, pedido []byte, txID string, timestamp int64) (*Recibo, error) {
+	hash, err := canonico.Hash(pedido)
+	if err != nil {
+		return nil, err
+	}
+	return &Recibo{
+		Formato:   Formato,
+		PedidoID:  pedidoID,
+		Pedido:    json.RawMessage(pedido),
+		Algoritmo: Algoritmo,
+		Hash:      hash,
+		TxID:      txID,
+		Timestamp: timestamp,
+	}, nil
+}
+
+//confere a integridade do recibo: formato conhecido, hash igual ao do pedido e pedido com o ID
+//do recibo. Nao prova que a transacao existe; para isso compare TxID e Timestamp com o ledger
+func Verificar(r *Recibo) error {
+	if r.Formato != Formato {
+		return fmt.Errorf("Unknown receipt format %q", r.Formato)
+	}
+	if r.Algoritmo != Algoritmo {
+		return fmt.Errorf("Unknown receipt hash algorithm %q", r.Algoritmo)
+	}
+	if len(r.Pedido) == 0 {
+		return errors.New("Receipt has no pedido")
+	}
+	hash, err := canonico.Hash(r.Pedido)
+	if err != nil {
+		return fmt.Errorf("Invalid pedido JSON in receipt: %s", err)
+	}
+	if hash != r.Hash {
+		return fmt.Errorf("Receipt hash %s does not match pedido hash %s", r.Hash, hash)
+	}
+	var pedido struct {
+		ID                     string        `json:"id"`
+	}
+	err = json.Unmarshal(r.Pedido, &pedido)
+	if err != nil {
+		return fmt.Errorf("Invalid pedido JSON in receipt: %s", err)
+	}
+	if pedido.ID != r.PedidoID {
+		return fmt.Errorf("Receipt is for pedido %q but holds pedido %q", r.PedidoID, pedido.ID)
+	}
+	return nil
+}
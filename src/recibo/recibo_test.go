@@ -0,0 +1,52 @@
+package recibo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var pedidoTeste = `{"id":"la1","cpf":"c1f3","cpfHash":"9a0b","dataVenda":1503849607000,"versao":2}`
+
+func TestVerificar(t *testing.T) {
+	fmt.Println("Entering TestVerificar")
+	r, err := Novo("la1", []byte(pedidoTeste), "tx2", 1504310400000)
+	if err != nil {
+		t.Fatalf("Could not create receipt: %s", err)
+	}
+	if err = Verificar(r); err != nil {
+		t.Fatalf("Expected a valid receipt: %s", err)
+	}
+
+	//outra formatacao do mesmo pedido continua valida
+	r.Pedido = []byte("{\n  \"versao\": 2,\n  \"dataVenda\": 1503849607000,\n  \"cpfHash\": \"9a0b\",\n  \"cpf\": \"c1f3\",\n  \"id\": \"la1\"\n}")
+	if err = Verificar(r); err != nil {
+		t.Fatalf("Expected the hash to ignore formatting: %s", err)
+	}
+
+	r.Pedido = []byte(strings.Replace(pedidoTeste, "1503849607000", "1503849607001", 1))
+	if err = Verificar(r); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("Expected a changed pedido to be rejected, got %v", err)
+	}
+}
+
+func TestVerificarCampos(t *testing.T) {
+	fmt.Println("Entering TestVerificarCampos")
+	r, _ := Novo("la2", []byte(pedidoTeste), "", 0)
+	if err := Verificar(r); err == nil {
+		t.Fatalf("Expected a receipt holding another pedido to be rejected")
+	}
+	r, _ = Novo("la1", []byte(pedidoTeste), "", 0)
+	r.Formato = "pedido-recibo/9"
+	if err := Verificar(r); err == nil {
+		t.Fatalf("Expected an unknown format to be rejected")
+	}
+	r, _ = Novo("la1", []byte(pedidoTeste), "", 0)
+	r.Pedido = nil
+	if err := Verificar(r); err == nil {
+		t.Fatalf("Expected a receipt without pedido to be rejected")
+	}
+	if _, err := Novo("la1", []byte(`{"id":`), "", 0); err == nil {
+		t.Fatalf("Expected invalid pedido JSON to be rejected")
+	}
+}
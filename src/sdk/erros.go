@@ -0,0 +1,82 @@
+package sdk
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/peer"
+)
+
+//categorias dos erros devolvidos pelo contrato, para usar com errors.Is
+var (
+	ErrPedidoNaoEncontrado    = errors.New("pedido not found")
+	ErrConflitoVersao         = errors.New("version conflict")
+	ErrPapelNaoPermitido      = errors.New("caller role not allowed")
+	ErrPrazoExcedido          = errors.New("time of regret exceeded")
+	ErrNFeJaRegistrada        = errors.New("NF-e key already registered")
+	ErrPedidoExistente        = errors.New("pedido already exists")
+	ErrDisputaNaoEncontrada   = errors.New("disputa not found")
+	// a regra do contrato nao permite a operacao no estado atual do pedido ou da disputa
+	ErrOperacaoNaoPermitida   = errors.New("operation not allowed for the pedido")
+	ErrArgumentoInvalido      = errors.New("invalid argument")
+)
+
+//erro de uma funcao do chaincode, com a mensagem original e a categoria reconhecida
+type ErroContrato struct {
+	Funcao                 string
+	// mensagem do contrato, sem o codigo
+	Mensagem               string
+	// codigo devolvido pelo contrato, vazio para erros sem codigo
+	Codigo                 string
+	// um dos Err* deste pacote, ou nil se o codigo nao e conhecido
+	Tipo                   error
+}
+
+func (e *ErroContrato) Error() string {
+	return e.Funcao + ": " + e.Mensagem
+}
+
+func (e *ErroContrato) Unwrap() error {
+	return e.Tipo
+}
+
+//categoria de cada codigo de erro do contrato
+var categoriasErro = map[string]error{
+	contrato.CodigoPedidoNaoEncontrado:  ErrPedidoNaoEncontrado,
+	contrato.CodigoConflitoVersao:       ErrConflitoVersao,
+	contrato.CodigoPapelNaoPermitido:    ErrPapelNaoPermitido,
+	contrato.CodigoPrazoExcedido:        ErrPrazoExcedido,
+	contrato.CodigoNFeJaRegistrada:      ErrNFeJaRegistrada,
+	contrato.CodigoPedidoExistente:      ErrPedidoExistente,
+	contrato.CodigoDisputaNaoEncontrada: ErrDisputaNaoEncontrada,
+	contrato.CodigoOperacaoNaoPermitida: ErrOperacaoNaoPermitida,
+	contrato.CodigoArgumentoInvalido:    ErrArgumentoInvalido,
+}
+
+//erros do chaincode viram ErroContrato; erros de rede e de contexto passam como vieram
+func traduzirErro(funcao string, err error) error {
+	erroPeer, ok := err.(*peer.Erro)
+	if !ok {
+		return err
+	}
+	mensagem := erroPeer.Dados
+	if mensagem == "" {
+		mensagem = erroPeer.Mensagem
+	}
+	erro := &ErroContrato{Funcao: funcao, Mensagem: mensagem}
+	//o peer embrulha a mensagem do contrato no proprio texto, entao o codigo pode vir no meio
+	inicio := strings.Index(mensagem, contrato.PrefixoCodigo)
+	if inicio < 0 {
+		return erro
+	}
+	resto := mensagem[inicio+len(contrato.PrefixoCodigo):]
+	fim := strings.Index(resto, " ")
+	if fim < 0 {
+		fim = len(resto)
+	}
+	erro.Codigo = resto[:fim]
+	erro.Mensagem = mensagem[:inicio] + strings.TrimPrefix(resto[fim:], " ")
+	erro.Tipo = categoriasErro[erro.Codigo]
+	return erro
+}
@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/peer"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+//transporte que executa o chaincode em memoria, no simulador, para testes e desenvolvimento
+//local. Os erros do chaincode voltam como os do peer, entao o Cliente os traduz igual
+type Local struct {
+	Simulador              *simulador.Simulador
+	mutex                  sync.Mutex
+}
+
+//simulador novo com o SaleContractChainCode e os atributos do chamador
+func NovoLocal(atributos map[string][]byte) *Local {
+	sim := simulador.Novo(new(contrato.SaleContractChainCode), atributos)
+	sim.Init()
+	return &Local{Simulador: sim}
+}
+
+type chaveAtributos struct{}
+
+//contexto em que o Local executa a chamada com o papel informado. O peer ignora o valor: la o
+//papel vem do certificado do usuario
+func ComPapel(ctx context.Context, papel string) context.Context {
+	return ComAtributo(ctx, "role", papel)
+}
+
+//contexto em que o Local executa a chamada com o atributo do certificado informado, como o
+//cpfHash do cliente. O peer tambem ignora o valor
+func ComAtributo(ctx context.Context, nome string, valor string) context.Context {
+	atributos := map[string]string{nome: valor}
+	if anteriores, ok := ctx.Value(chaveAtributos{}).(map[string]string); ok {
+		for n, v := range anteriores {
+			if n != nome {
+				atributos[n] = v
+			}
+		}
+	}
+	return context.WithValue(ctx, chaveAtributos{}, atributos)
+}
+
+//aplica os atributos do contexto ate o fim da chamada; precisa do mutex
+func (l *Local) atributosDoContexto(ctx context.Context) func() {
+	atributos, ok := ctx.Value(chaveAtributos{}).(map[string]string)
+	if !ok {
+		return func() {}
+	}
+	anteriores := map[string]string{}
+	for nome, valor := range atributos {
+		anteriores[nome] = string(l.Simulador.Atributos[nome])
+		l.Simulador.ComAtributo(nome, valor)
+	}
+	return func() {
+		for nome, valor := range anteriores {
+			l.Simulador.ComAtributo(nome, valor)
+		}
+	}
+}
+
+func (l *Local) Invoke(ctx context.Context, funcao string, args ...string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	defer l.atributosDoContexto(ctx)()
+	r := l.Simulador.Invocar(funcao, args...)
+	if r.Err != nil {
+		return "", &peer.Erro{Codigo: peer.CodigoErroInvoke, Mensagem: "Invocation failure", Dados: r.Err.Error()}
+	}
+	return r.TxID, nil
+}
+
+func (l *Local) Query(ctx context.Context, funcao string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	defer l.atributosDoContexto(ctx)()
+	r := l.Simulador.Consultar(funcao, args...)
+	if r.Err != nil {
+		return nil, &peer.Erro{Codigo: peer.CodigoErroQuery, Mensagem: "Query failure", Dados: r.Err.Error()}
+	}
+	return r.Payload, nil
+}
+
+//troca o papel do chamador nas proximas chamadas
+func (l *Local) ComoPapel(papel string) *Local {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.Simulador.ComoPapel(papel)
+	return l
+}
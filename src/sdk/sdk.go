@@ -0,0 +1,195 @@
+//Package sdk chama o SaleContractChainCode com metodos tipados, usando os tipos do pacote
+//contrato, em vez de montar a mao os args posicionais do ctorMsg.
+//
+//	cliente := sdk.Novo(peer.Novo("http://localhost:7050", chaincodeID, "loja01"))
+//	txID, err := cliente.RegistrarEntrega(ctx, "la1", sdk.Entrega{Data: time.Now()})
+//	pedido, err := cliente.ObterPedido(ctx, "la1")
+//	if errors.Is(err, sdk.ErrPedidoNaoEncontrado) { ... }
+//
+//No fabric v0.6 o peer responde ao invoke antes de executar a transacao: o erro de uma regra
+//do contrato so volta no invoke quando o transporte executa o chaincode na hora, como o Local.
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/recibo"
+)
+
+//como as chamadas chegam ao chaincode; implementado por peer.Cliente e por Local
+type Transporte interface {
+	Invoke(ctx context.Context, funcao string, args ...string) (string, error)
+	Query(ctx context.Context, funcao string, args ...string) ([]byte, error)
+}
+
+type Cliente struct {
+	Transporte             Transporte
+}
+
+func Novo(transporte Transporte) *Cliente {
+	return &Cliente{Transporte: transporte}
+}
+
+//opcoes do RegistrarEntrega
+type Entrega struct {
+	Data                   time.Time
+	// vazio registra a entrega do pedido inteiro
+	Vendedor               string
+	// hash do comprovante de entrega da transportadora
+	Comprovante            string
+	// 0 desliga a verificacao de conflito de versao
+	VersaoEsperada         int64
+}
+
+//opcoes do RegistrarArrependimento
+type Arrependimento struct {
+	Data                   time.Time
+	// chave de acesso da NF-e de devolucao
+	ChaveNFe               string
+	// vazio devolve o pedido inteiro
+	Vendedor               string
+	Complemento            string
+	VersaoEsperada         int64
+}
+
+//opcoes do RegistrarTroca
+type Troca struct {
+	Data                   time.Time
+	// 1 arrependimento, 2 defeituoso
+	Motivo                 int
+	// 1 devolucao do pagamento, 2 abatimento, 3 outro produto
+	Opcao                  int
+	ChaveNFe               string
+	VersaoEsperada         int64
+}
+
+//opcoes das etapas do fluxo de devolucao (aprovar, rejeitar, receber e reembolsar)
+type Etapa struct {
+	Data                   time.Time
+	// obrigatoria para rejeitar
+	Justificativa          string
+	// vazio atua na devolucao do pedido inteiro
+	Vendedor               string
+	VersaoEsperada         int64
+}
+
+//timestamp em milissegundos usado nos args e nos campos de data do Pedido
+func Milissegundos(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+//converte um campo de data do Pedido
+func Data(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+func timestamp(t time.Time) string {
+	return strconv.FormatInt(Milissegundos(t), 10)
+}
+
+//args opcionais posicionais: os vazios no fim sao removidos e a versao esperada vai por ultimo
+func posicionais(args []string, versao int64) []string {
+	for len(args) > 0 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+	if versao > 0 {
+		args = append(args, "versao="+strconv.FormatInt(versao, 10))
+	}
+	return args
+}
+
+func (c *Cliente) invocar(ctx context.Context, funcao string, args ...string) (string, error) {
+	txID, err := c.Transporte.Invoke(ctx, funcao, args...)
+	if err != nil {
+		return "", traduzirErro(funcao, err)
+	}
+	return txID, nil
+}
+
+//decodifica o payload da query em destino; payload vazio e pedido nao encontrado
+func (c *Cliente) consultar(ctx context.Context, destino interface{}, funcao string, args ...string) error {
+	payload, err := c.Transporte.Query(ctx, funcao, args...)
+	if err != nil {
+		return traduzirErro(funcao, err)
+	}
+	if len(payload) == 0 {
+		return &ErroContrato{funcao, "Pedido " + args[0] + " not found", contrato.CodigoPedidoNaoEncontrado, ErrPedidoNaoEncontrado}
+	}
+	return json.Unmarshal(payload, destino)
+}
+
+//registra o pedido com o ID dele; o CPF em claro e cifrado pelo chaincode
+func (c *Cliente) RegistrarPedido(ctx context.Context, p contrato.Pedido) (string, error) {
+	pedidoJSON, err := json.Marshal(&p)
+	if err != nil {
+		return "", err
+	}
+	return c.invocar(ctx, "RegistrarPedido", p.ID, string(pedidoJSON))
+}
+
+func (c *Cliente) RegistrarEntrega(ctx context.Context, id string, e Entrega) (string, error) {
+	args := []string{id, timestamp(e.Data), e.Vendedor, e.Comprovante}
+	return c.invocar(ctx, "RegistrarEntrega", posicionais(args, e.VersaoEsperada)...)
+}
+
+func (c *Cliente) RegistrarArrependimento(ctx context.Context, id string, a Arrependimento) (string, error) {
+	args := []string{id, timestamp(a.Data), a.ChaveNFe, a.Vendedor, a.Complemento}
+	return c.invocar(ctx, "RegistrarArrependimento", posicionais(args, a.VersaoEsperada)...)
+}
+
+func (c *Cliente) RegistrarTroca(ctx context.Context, id string, t Troca) (string, error) {
+	args := []string{id, timestamp(t.Data), strconv.Itoa(t.Motivo), strconv.Itoa(t.Opcao), t.ChaveNFe}
+	return c.invocar(ctx, "RegistrarTroca", posicionais(args, t.VersaoEsperada)...)
+}
+
+func (c *Cliente) AprovarDevolucao(ctx context.Context, id string, e Etapa) (string, error) {
+	return c.etapaDevolucao(ctx, "AprovarDevolucao", id, e)
+}
+
+func (c *Cliente) RejeitarDevolucao(ctx context.Context, id string, e Etapa) (string, error) {
+	return c.etapaDevolucao(ctx, "RejeitarDevolucao", id, e)
+}
+
+func (c *Cliente) RegistrarRecebimentoDevolucao(ctx context.Context, id string, e Etapa) (string, error) {
+	return c.etapaDevolucao(ctx, "RegistrarRecebimentoDevolucao", id, e)
+}
+
+func (c *Cliente) RegistrarReembolso(ctx context.Context, id string, e Etapa) (string, error) {
+	return c.etapaDevolucao(ctx, "RegistrarReembolso", id, e)
+}
+
+func (c *Cliente) etapaDevolucao(ctx context.Context, funcao string, id string, e Etapa) (string, error) {
+	args := []string{id, timestamp(e.Data), e.Justificativa, e.Vendedor}
+	return c.invocar(ctx, funcao, posicionais(args, e.VersaoEsperada)...)
+}
+
+//pedido com o CPF decifrado quando o chamador tem a chave; ErrPedidoNaoEncontrado se nao existe
+func (c *Cliente) ObterPedido(ctx context.Context, id string) (contrato.Pedido, error) {
+	var p contrato.Pedido
+	err := c.consultar(ctx, &p, "ObterPedido", id)
+	return p, err
+}
+
+func (c *Cliente) ObterPedidoPorNFe(ctx context.Context, chaveNFe string) (contrato.Pedido, error) {
+	var p contrato.Pedido
+	err := c.consultar(ctx, &p, "ObterPedidoPorNFe", chaveNFe)
+	return p, err
+}
+
+//recibo do pedido, para guardar e conferir depois com recibo.Verificar
+func (c *Cliente) ObterRecibo(ctx context.Context, id string) (recibo.Recibo, error) {
+	var r recibo.Recibo
+	err := c.consultar(ctx, &r, "ObterRecibo", id)
+	return r, err
+}
+
+//status, prazos e acoes permitidas ao papel do chamador na data de referencia
+func (c *Cliente) ResumoPedido(ctx context.Context, id string, referencia time.Time) (contrato.ResumoDoPedido, error) {
+	var r contrato.ResumoDoPedido
+	err := c.consultar(ctx, &r, "ResumoPedido", id, timestamp(referencia))
+	return r, err
+}
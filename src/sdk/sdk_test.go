@@ -0,0 +1,239 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rodneicouto/chaincode/src/contrato"
+	"github.com/rodneicouto/chaincode/src/peer"
+	"github.com/rodneicouto/chaincode/src/recibo"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+var venda = time.Date(2017, 8, 27, 13, 0, 0, 0, time.UTC)
+
+func novosAtributos() map[string][]byte {
+	attributes := make(map[string][]byte)
+	attributes["chaveCPF"] = []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	attributes["chaveIndiceCPF"] = []byte("1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100")
+	return attributes
+}
+
+func novoPedido(id string, nota int) contrato.Pedido {
+	return contrato.Pedido{
+		ID:               id,
+		CPFCliente:       "09596397729",
+		DescricaoItens:   "Maquina Lavar Brastemp",
+		ItensId:          "234",
+		ChaveNFe:         simulador.ChaveNFe(nota),
+		DataVenda:        Milissegundos(venda),
+		DataPrazoEntrega: Milissegundos(venda.Add(7 * simulador.Dia)),
+	}
+}
+
+func TestRegistrarEObterPedido(t *testing.T) {
+	fmt.Println("Entering TestRegistrarEObterPedido")
+	ctx := context.Background()
+	local := NovoLocal(novosAtributos())
+	cliente := Novo(local.ComoPapel(contrato.RoleLoja))
+
+	txID, err := cliente.RegistrarPedido(ctx, novoPedido("la1", 1))
+	if err != nil || txID == "" {
+		t.Fatalf("Expected pedido to be registered, got %q %v", txID, err)
+	}
+	entrega := venda.Add(2 * simulador.Dia)
+	_, err = cliente.RegistrarEntrega(ctx, "la1", Entrega{Data: entrega, Comprovante: "abc", VersaoEsperada: 1})
+	if err != nil {
+		t.Fatalf("Expected delivery to be registered: %s", err)
+	}
+
+	p, err := cliente.ObterPedido(ctx, "la1")
+	if err != nil {
+		t.Fatalf("Expected pedido, got %s", err)
+	}
+	if p.CPFCliente != "09596397729" || p.Versao != 2 || !Data(p.DataEntrega).Equal(entrega) || p.ComprovanteEntrega != "abc" {
+		t.Fatalf("Unexpected pedido %+v", p)
+	}
+	porNFe, err := cliente.ObterPedidoPorNFe(ctx, p.ChaveNFe)
+	if err != nil || porNFe.ID != "la1" {
+		t.Fatalf("Expected pedido by NF-e key, got %+v %v", porNFe, err)
+	}
+	r, err := cliente.ObterRecibo(ctx, "la1")
+	if err != nil || r.TxID == "" || recibo.Verificar(&r) != nil {
+		t.Fatalf("Expected a valid receipt, got %+v %v", r, err)
+	}
+}
+
+func TestArrependimentoETrocaTipados(t *testing.T) {
+	fmt.Println("Entering TestArrependimentoETrocaTipados")
+	ctx := context.Background()
+	local := NovoLocal(novosAtributos())
+	cliente := Novo(local.ComoPapel(contrato.RoleLoja))
+	cliente.RegistrarPedido(ctx, novoPedido("la1", 1))
+	cliente.RegistrarPedido(ctx, novoPedido("la2", 2))
+	entrega := venda.Add(2 * simulador.Dia)
+	cliente.RegistrarEntrega(ctx, "la1", Entrega{Data: entrega})
+	cliente.RegistrarEntrega(ctx, "la2", Entrega{Data: entrega})
+
+	local.ComoPapel(contrato.RoleCliente)
+	//o mesmo CPF nos dois pedidos, entao o mesmo cpfHash no certificado do cliente
+	cpfHash, _ := local.Simulador.ValorCampo("la1", "cpfHash")
+	local.Simulador.ComAtributo("cpfHash", cpfHash.(string))
+	_, err := cliente.RegistrarArrependimento(ctx, "la1", Arrependimento{Data: entrega.Add(simulador.Dia), ChaveNFe: simulador.ChaveNFe(3), Complemento: "Nao serviu"})
+	if err != nil {
+		t.Fatalf("Expected regret to be registered: %s", err)
+	}
+	_, err = cliente.RegistrarTroca(ctx, "la2", Troca{Data: entrega.Add(simulador.Dia), Motivo: 2, Opcao: 3, ChaveNFe: simulador.ChaveNFe(4)})
+	if err != nil {
+		t.Fatalf("Expected exchange to be registered: %s", err)
+	}
+
+	local.ComoPapel(contrato.RoleLoja)
+	_, err = cliente.AprovarDevolucao(ctx, "la1", Etapa{Data: entrega.Add(2 * simulador.Dia)})
+	if err != nil {
+		t.Fatalf("Expected return to be approved: %s", err)
+	}
+	p, _ := cliente.ObterPedido(ctx, "la1")
+	if p.Devolucao.Status != contrato.StatusDevolucaoAprovada || p.Devolucao.ComplementoMotivoDevolucao != "Nao serviu" {
+		t.Fatalf("Unexpected devolucao %+v", p.Devolucao)
+	}
+	p, _ = cliente.ObterPedido(ctx, "la2")
+	if p.Troca.MotivoTroca != 2 || p.Troca.OpcaoTroca != 3 {
+		t.Fatalf("Unexpected troca %+v", p.Troca)
+	}
+	resumo, err := cliente.ResumoPedido(ctx, "la1", entrega.Add(3*simulador.Dia))
+	if err != nil || resumo.Status != "EM_DEVOLUCAO" {
+		t.Fatalf("Expected resumo EM_DEVOLUCAO, got %+v %v", resumo, err)
+	}
+}
+
+//as mensagens reais do contrato precisam cair na categoria certa
+func TestErrosDoContrato(t *testing.T) {
+	fmt.Println("Entering TestErrosDoContrato")
+	ctx := context.Background()
+	local := NovoLocal(novosAtributos())
+	cliente := Novo(local.ComoPapel(contrato.RoleLoja))
+	cliente.RegistrarPedido(ctx, novoPedido("la1", 1))
+	entrega := venda.Add(2 * simulador.Dia)
+
+	_, err := cliente.ObterPedido(ctx, "nao-existe")
+	if !errors.Is(err, ErrPedidoNaoEncontrado) {
+		t.Fatalf("Expected ErrPedidoNaoEncontrado, got %v", err)
+	}
+	_, err = cliente.ObterPedidoPorNFe(ctx, simulador.ChaveNFe(9))
+	if !errors.Is(err, ErrPedidoNaoEncontrado) {
+		t.Fatalf("Expected ErrPedidoNaoEncontrado by NF-e, got %v", err)
+	}
+	_, err = cliente.RegistrarPedido(ctx, novoPedido("la2", 1))
+	if !errors.Is(err, ErrNFeJaRegistrada) {
+		t.Fatalf("Expected ErrNFeJaRegistrada, got %v", err)
+	}
+	_, err = cliente.RegistrarPedido(ctx, novoPedido("la1", 2))
+	if !errors.Is(err, ErrPedidoExistente) {
+		t.Fatalf("Expected ErrPedidoExistente, got %v", err)
+	}
+	_, err = cliente.RegistrarEntrega(ctx, "la1", Entrega{Data: entrega, VersaoEsperada: 5})
+	if !errors.Is(err, ErrConflitoVersao) {
+		t.Fatalf("Expected ErrConflitoVersao, got %v", err)
+	}
+	_, err = cliente.RegistrarArrependimento(ctx, "la1", Arrependimento{Data: entrega, ChaveNFe: simulador.ChaveNFe(2)})
+	if !errors.Is(err, ErrPapelNaoPermitido) {
+		t.Fatalf("Expected ErrPapelNaoPermitido, got %v", err)
+	}
+	local.ComoPapel(contrato.RoleCliente)
+	cpfHash, _ := local.Simulador.ValorCampo("la1", "cpfHash")
+	local.Simulador.ComAtributo("cpfHash", cpfHash.(string))
+	_, err = cliente.RegistrarArrependimento(ctx, "la1", Arrependimento{Data: entrega, ChaveNFe: simulador.ChaveNFe(2)})
+	if !errors.Is(err, ErrOperacaoNaoPermitida) {
+		t.Fatalf("Expected ErrOperacaoNaoPermitida before delivery, got %v", err)
+	}
+	local.ComoPapel(contrato.RoleLoja)
+	cliente.RegistrarEntrega(ctx, "la1", Entrega{Data: entrega})
+	local.ComoPapel(contrato.RoleCliente)
+	_, err = cliente.RegistrarArrependimento(ctx, "la1", Arrependimento{Data: entrega.Add(8 * simulador.Dia), ChaveNFe: simulador.ChaveNFe(2)})
+	if !errors.Is(err, ErrPrazoExcedido) {
+		t.Fatalf("Expected ErrPrazoExcedido, got %v", err)
+	}
+	_, err = cliente.RegistrarTroca(ctx, "la1", Troca{Data: entrega, Motivo: 7, Opcao: 1, ChaveNFe: simulador.ChaveNFe(2)})
+	if !errors.Is(err, ErrArgumentoInvalido) {
+		t.Fatalf("Expected ErrArgumentoInvalido, got %v", err)
+	}
+
+	erro, ok := err.(*ErroContrato)
+	if !ok || erro.Funcao != "RegistrarTroca" || erro.Mensagem != "Invalid motivo troca, expected 1 or 2" {
+		t.Fatalf("Expected the contract message in ErroContrato, got %#v", err)
+	}
+}
+
+func TestErrosDoPeerETransporte(t *testing.T) {
+	fmt.Println("Entering TestErrosDoPeerETransporte")
+	err := traduzirErro("ObterPedido", &peer.Erro{Codigo: peer.CodigoErroQuery, Mensagem: "Query failure", Dados: "Error when querying chaincode: Error:Failed to execute transaction or query(codigo:PEDIDO_NAO_ENCONTRADO Pedido x not found)"})
+	if !errors.Is(err, ErrPedidoNaoEncontrado) {
+		t.Fatalf("Expected code wrapped by the peer to be recognized, got %v", err)
+	}
+	erro := err.(*ErroContrato)
+	if erro.Codigo != contrato.CodigoPedidoNaoEncontrado || erro.Mensagem != "Error when querying chaincode: Error:Failed to execute transaction or query(Pedido x not found)" {
+		t.Fatalf("Expected the code removed from the message, got %#v", erro)
+	}
+	//sem codigo o texto nao e interpretado
+	err = traduzirErro("ObterPedido", &peer.Erro{Mensagem: "Query failure", Dados: "Pedido x not found"})
+	if erro, ok := err.(*ErroContrato); !ok || erro.Tipo != nil || erro.Codigo != "" {
+		t.Fatalf("Expected a message without code to have no category, got %#v", err)
+	}
+	err = traduzirErro("AbrirDisputa", &peer.Erro{Mensagem: "Query failure", Dados: "Disputa d1 not found"})
+	if erro, ok := err.(*ErroContrato); !ok || erro.Tipo != nil {
+		t.Fatalf("Expected disputa error without category, got %#v", err)
+	}
+
+	ctx, cancelar := context.WithCancel(context.Background())
+	cancelar()
+	_, err = Novo(NovoLocal(novosAtributos())).ObterPedido(ctx, "la1")
+	if err != context.Canceled {
+		t.Fatalf("Expected context error unchanged, got %v", err)
+	}
+}
+
+func TestArgsPosicionais(t *testing.T) {
+	fmt.Println("Entering TestArgsPosicionais")
+	args := posicionais([]string{"la1", "1", "", "hash"}, 0)
+	if len(args) != 4 || args[2] != "" {
+		t.Fatalf("Expected empty middle argument to be kept, got %q", args)
+	}
+	args = posicionais([]string{"la1", "1", "", ""}, 3)
+	if len(args) != 3 || args[2] != "versao=3" {
+		t.Fatalf("Expected trailing empties removed and version appended, got %q", args)
+	}
+}
+
+func TestPapelPorChamada(t *testing.T) {
+	fmt.Println("Entering TestPapelPorChamada")
+	local := NovoLocal(novosAtributos())
+	cliente := Novo(local.ComoPapel(contrato.RoleCliente))
+	_, err := cliente.RegistrarPedido(ComPapel(context.Background(), contrato.RoleLoja), novoPedido("la1", 1))
+	if err != nil {
+		t.Fatalf("Expected role from the context to be used: %s", err)
+	}
+	if string(local.Simulador.Atributos["role"]) != contrato.RoleCliente {
+		t.Fatalf("Expected previous role restored, got %q", local.Simulador.Atributos["role"])
+	}
+
+	//o papel e o cpfHash do contexto valem juntos, e o cpfHash errado barra o arrependimento
+	cpfHash, _ := local.Simulador.ValorCampo("la1", "cpfHash")
+	arrependimento := Arrependimento{Data: venda, ChaveNFe: simulador.ChaveNFe(2)}
+	outro := ComAtributo(ComPapel(context.Background(), contrato.RoleCliente), "cpfHash", "outro-cliente")
+	_, err = cliente.RegistrarArrependimento(outro, "la1", arrependimento)
+	if !errors.Is(err, ErrPapelNaoPermitido) {
+		t.Fatalf("Expected ErrPapelNaoPermitido for another customer, got %v", err)
+	}
+	dono := ComAtributo(ComPapel(context.Background(), contrato.RoleCliente), "cpfHash", cpfHash.(string))
+	_, err = cliente.RegistrarArrependimento(dono, "la1", arrependimento)
+	if !errors.Is(err, ErrOperacaoNaoPermitida) {
+		t.Fatalf("Expected ErrOperacaoNaoPermitida before delivery, got %v", err)
+	}
+	if _, ok := local.Simulador.Atributos["cpfHash"]; ok {
+		t.Fatalf("Expected cpfHash of the context removed after the call")
+	}
+}
@@ -0,0 +1,26 @@
+package simulador
+
+import (
+	"fmt"
+)
+
+//chave de acesso de NF-e valida (digito verificador modulo 11) com o numero da nota informado,
+//para os testes nao repetirem chaves ja usadas por outro pedido
+func ChaveNFe(numero int) string {
+	//SP, 09/2017, CNPJ ficticio, modelo 55, serie 1, emissao normal
+	base := fmt.Sprintf("3517090123456700019955001%09d1%08d", numero%1000000000, numero%100000000)
+	soma := 0
+	peso := 2
+	for i := len(base) - 1; i >= 0; i-- {
+		soma += int(base[i]-'0') * peso
+		peso++
+		if peso > 9 {
+			peso = 2
+		}
+	}
+	dv := 11 - soma%11
+	if dv >= 10 {
+		dv = 0
+	}
+	return base + fmt.Sprint(dv)
+}
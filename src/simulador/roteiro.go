@@ -0,0 +1,355 @@
+package simulador
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//Roteiros sao cenarios de aceitacao escritos pela area de negocio em um formato parecido
+//com o Gherkin, em portugues, e executados contra o SaleContractChainCode pelo simulador.
+//A linguagem esta descrita em docs/cenarios.md
+
+//arquivo de cenarios
+type Roteiro struct {
+	Arquivo                string
+	Funcionalidade         string
+	Cenarios               []Cenario
+}
+
+type Cenario struct {
+	Nome                   string
+	Linha                  int
+	Passos                 []Passo
+}
+
+type Passo struct {
+	// Dado, Quando ou Entao; E e Mas assumem a palavra do passo anterior
+	Palavra                string
+	Texto                  string
+	Linha                  int
+}
+
+//dados que os roteiros nao informam
+type ConfigRoteiro struct {
+	// pedido base; dataVenda, dataPrazoEntrega e chaveNFe sao trocadas a cada registro
+	PedidoJSON             string
+}
+
+const (
+	PalavraDado   = "Dado"
+	PalavraQuando = "Quando"
+	PalavraEntao  = "Entao"
+)
+
+//horario de Brasilia, sem horario de verao, para as datas dos cenarios
+var fusoRoteiro = time.FixedZone("BRT", -3*60*60)
+
+var palavrasPasso = map[string]string{
+	"dado":    PalavraDado,
+	"dada":    PalavraDado,
+	"dados":   PalavraDado,
+	"dadas":   PalavraDado,
+	"quando":  PalavraQuando,
+	"entao":   PalavraEntao,
+	"e":       "",
+	"mas":     "",
+}
+
+var textoEntreAspas = regexp.MustCompile(`"[^"]*"`)
+
+//le um arquivo de cenarios; linhas vazias e comentarios com # sao ignorados
+func LerRoteiro(arquivo string, r io.Reader) (*Roteiro, error) {
+	roteiro := Roteiro{Arquivo: arquivo}
+	scanner := bufio.NewScanner(r)
+	var linha = 0
+	var palavraAnterior = ""
+	for scanner.Scan() {
+		linha++
+		texto := strings.TrimSpace(scanner.Text())
+		if texto == "" || strings.HasPrefix(texto, "#") {
+			continue
+		}
+		inicio, resto := separarPrimeiraPalavra(texto)
+		chave := strings.TrimSuffix(semAcentos(strings.ToLower(inicio)), ":")
+
+		if chave == "funcionalidade" {
+			roteiro.Funcionalidade = resto
+			continue
+		}
+		if chave == "cenario" || chave == "exemplo" {
+			roteiro.Cenarios = append(roteiro.Cenarios, Cenario{Nome: resto, Linha: linha})
+			palavraAnterior = ""
+			continue
+		}
+		palavra, ok := palavrasPasso[chave]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown keyword %q", arquivo, linha, inicio)
+		}
+		if len(roteiro.Cenarios) == 0 {
+			return nil, fmt.Errorf("%s:%d: step outside of a Cenario", arquivo, linha)
+		}
+		if palavra == "" {
+			if palavraAnterior == "" {
+				return nil, fmt.Errorf("%s:%d: %q must follow Dado, Quando or Entao", arquivo, linha, inicio)
+			}
+			palavra = palavraAnterior
+		}
+		palavraAnterior = palavra
+		cenario := &roteiro.Cenarios[len(roteiro.Cenarios)-1]
+		cenario.Passos = append(cenario.Passos, Passo{palavra, resto, linha})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &roteiro, nil
+}
+
+func separarPrimeiraPalavra(texto string) (string, string) {
+	partes := strings.SplitN(texto, " ", 2)
+	if len(partes) == 1 {
+		return partes[0], ""
+	}
+	return partes[0], strings.TrimSpace(partes[1])
+}
+
+var acentos = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e",
+	"í", "i",
+	"ó", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ü", "u",
+	"ç", "c",
+)
+
+func semAcentos(texto string) string {
+	return acentos.Replace(texto)
+}
+
+//estado de um cenario em execucao
+type execucao struct {
+	sim                    *Simulador
+	config                 ConfigRoteiro
+	pedido                 string
+	ultimo                 *Resultado
+	// numero da ultima NF-e gerada no cenario, de venda ou de devolucao
+	notas                  int
+}
+
+//um passo reconhecido: o padrao vale para o texto sem acentos, em minusculas e com
+//cada texto entre aspas trocado por ""; os textos originais chegam em textos
+type definicaoPasso struct {
+	padrao                 *regexp.Regexp
+	// verificacoes sempre falham o cenario, mesmo depois de um Quando
+	verificacao            bool
+	executar               func(e *execucao, grupos []string, textos []string) error
+}
+
+const padraoData = `(\d{2}/\d{2}/\d{4}(?: \d{2}:\d{2})?)`
+
+func passo(padrao string, executar func(e *execucao, grupos []string, textos []string) error) definicaoPasso {
+	return definicaoPasso{regexp.MustCompile("^" + strings.Replace(padrao, "DATA", padraoData, -1) + "$"), false, executar}
+}
+
+func verificacao(padrao string, executar func(e *execucao, grupos []string, textos []string) error) definicaoPasso {
+	d := passo(padrao, executar)
+	d.verificacao = true
+	return d
+}
+
+var definicoesPasso = []definicaoPasso{
+	passo(`um pedido( "")? registrado em DATA`, func(e *execucao, g []string, textos []string) error {
+		return e.registrar(textos, g[2])
+	}),
+	passo(`um pedido( "")? entregue em DATA`, func(e *execucao, g []string, textos []string) error {
+		err := e.registrar(textos, g[2])
+		if err != nil {
+			return err
+		}
+		return e.invocar("loja", "RegistrarEntrega", g[2])
+	}),
+	passo(`o pedido (?:e )?entregue em DATA`, func(e *execucao, g []string, textos []string) error {
+		return e.invocar("loja", "RegistrarEntrega", g[1])
+	}),
+	passo(`o cliente se arrepende em DATA( com o comentario "")?`, func(e *execucao, g []string, textos []string) error {
+		var comentario = ""
+		if len(textos) > 0 {
+			comentario = textos[0]
+		}
+		return e.invocar("cliente", "RegistrarArrependimento", g[1], e.chaveNFe(), "", comentario)
+	}),
+	passo(`o cliente pede troca por (arrependimento|defeito) em DATA`, func(e *execucao, g []string, textos []string) error {
+		var motivo = "1"
+		if g[1] == "defeito" {
+			motivo = "2"
+		}
+		//troca por outro produto
+		return e.invocar("cliente", "RegistrarTroca", g[2], motivo, "3", e.chaveNFe())
+	}),
+	passo(`a loja aprova a devolucao em DATA`, func(e *execucao, g []string, textos []string) error {
+		return e.invocar("loja", "AprovarDevolucao", g[1])
+	}),
+	passo(`a loja rejeita a devolucao em DATA com a justificativa ""`, func(e *execucao, g []string, textos []string) error {
+		return e.invocar("loja", "RejeitarDevolucao", g[1], textos[0])
+	}),
+	passo(`a loja recebe o produto devolvido em DATA`, func(e *execucao, g []string, textos []string) error {
+		return e.invocar("loja", "RegistrarRecebimentoDevolucao", g[1])
+	}),
+	passo(`o financeiro reembolsa o cliente em DATA`, func(e *execucao, g []string, textos []string) error {
+		return e.invocar("financeiro", "RegistrarReembolso", g[1])
+	}),
+	verificacao(`a operacao e aceita`, func(e *execucao, g []string, textos []string) error {
+		if e.ultimo == nil {
+			return errors.New("no operation was executed")
+		}
+		if e.ultimo.Err != nil {
+			return fmt.Errorf("expected %s to be accepted, got %q", e.ultimo.Funcao, e.ultimo.Err)
+		}
+		return nil
+	}),
+	verificacao(`a operacao e recusada( com a mensagem "")?`, func(e *execucao, g []string, textos []string) error {
+		if e.ultimo == nil {
+			return errors.New("no operation was executed")
+		}
+		if e.ultimo.Err == nil {
+			return fmt.Errorf("expected %s to be refused", e.ultimo.Funcao)
+		}
+		if len(textos) > 0 && !strings.Contains(e.ultimo.Err.Error(), textos[0]) {
+			return fmt.Errorf("expected %s to be refused with %q, got %q", e.ultimo.Funcao, textos[0], e.ultimo.Err)
+		}
+		return nil
+	}),
+	verificacao(`a devolucao fica ""`, func(e *execucao, g []string, textos []string) error {
+		return e.conferirCampo("devolucao.status", textos[0])
+	}),
+	verificacao(`o pedido fica ""`, func(e *execucao, g []string, textos []string) error {
+		r := e.sim.Consultar("ResumoPedido", e.pedido, e.sim.Relogio.Texto())
+		if r.Err != nil {
+			return r.Err
+		}
+		var resumo struct {
+			Status string `json:"status"`
+		}
+		json.Unmarshal(r.Payload, &resumo)
+		if resumo.Status != textos[0] {
+			return fmt.Errorf("expected pedido %s to be %s, got %s", e.pedido, textos[0], resumo.Status)
+		}
+		return nil
+	}),
+	verificacao(`o campo "" do pedido vale ""`, func(e *execucao, g []string, textos []string) error {
+		return e.conferirCampo(textos[0], textos[1])
+	}),
+}
+
+func (e *execucao) registrar(textos []string, data string) error {
+	if len(textos) > 0 {
+		e.pedido = textos[0]
+	}
+	ms, err := converterData(data)
+	if err != nil {
+		return err
+	}
+	var pedido map[string]interface{}
+	err = json.Unmarshal([]byte(e.config.PedidoJSON), &pedido)
+	if err != nil {
+		return fmt.Errorf("invalid PedidoJSON: %s", err)
+	}
+	pedido["dataVenda"] = ms
+	//prazo de entrega de 10 dias, so para o registro ser valido
+	pedido["dataPrazoEntrega"] = ms + int64(10*Dia/time.Millisecond)
+	pedido["chaveNFe"] = e.chaveNFe()
+	bytes, err := json.Marshal(pedido)
+	if err != nil {
+		return err
+	}
+	e.sim.Relogio.Definir(ms)
+	e.sim.ComoPapel("loja")
+	r := e.sim.Invocar("RegistrarPedido", e.pedido, string(bytes))
+	e.ultimo = &r
+	return r.Err
+}
+
+//invoca a funcao como o papel informado, com os args pedido ID, data e os demais
+func (e *execucao) invocar(papel string, funcao string, data string, args ...string) error {
+	ms, err := converterData(data)
+	if err != nil {
+		return err
+	}
+	e.sim.Relogio.Definir(ms)
+	e.sim.ComoPapel(papel)
+	//o cliente dos roteiros e o dono do pedido: o certificado dele leva o cpfHash gravado no pedido
+	if papel == "cliente" {
+		cpfHash, err := e.sim.ValorCampo(e.pedido, "cpfHash")
+		if err != nil {
+			return err
+		}
+		e.sim.ComAtributo("cpfHash", fmt.Sprint(cpfHash))
+	}
+	r := e.sim.Invocar(funcao, append([]string{e.pedido, e.sim.Relogio.Texto()}, args...)...)
+	e.ultimo = &r
+	return r.Err
+}
+
+func (e *execucao) chaveNFe() string {
+	e.notas++
+	return ChaveNFe(e.notas)
+}
+
+func (e *execucao) conferirCampo(caminho string, esperado string) error {
+	valor, err := e.sim.ValorCampo(e.pedido, caminho)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(valor) != esperado {
+		return fmt.Errorf("expected %s to be %q, got %q", caminho, esperado, fmt.Sprint(valor))
+	}
+	return nil
+}
+
+func converterData(data string) (int64, error) {
+	formato := "02/01/2006"
+	if len(data) > len(formato) {
+		formato += " 15:04"
+	}
+	t, err := time.ParseInLocation(formato, data, fusoRoteiro)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %s", data)
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+//executa os passos em um simulador novo. Falha de uma operacao em Dado interrompe o cenario;
+//em Quando fica registrada para os passos Entao conferirem. Verificacao que falha sempre interrompe
+func ExecutarCenario(sim *Simulador, config ConfigRoteiro, cenario Cenario) error {
+	e := &execucao{sim: sim, config: config, pedido: "p1"}
+	for _, p := range cenario.Passos {
+		textos := []string{}
+		for _, aspas := range textoEntreAspas.FindAllString(p.Texto, -1) {
+			textos = append(textos, strings.Trim(aspas, `"`))
+		}
+		esqueleto := semAcentos(strings.ToLower(textoEntreAspas.ReplaceAllString(p.Texto, `""`)))
+
+		var reconhecido = false
+		for _, d := range definicoesPasso {
+			grupos := d.padrao.FindStringSubmatch(esqueleto)
+			if grupos == nil {
+				continue
+			}
+			reconhecido = true
+			err := d.executar(e, grupos, textos)
+			if err != nil && (d.verificacao || p.Palavra != PalavraQuando) {
+				return fmt.Errorf("line %d: %s %s: %s", p.Linha, p.Palavra, p.Texto, err)
+			}
+			break
+		}
+		if !reconhecido {
+			return fmt.Errorf("line %d: unknown step %q", p.Linha, p.Texto)
+		}
+	}
+	return nil
+}
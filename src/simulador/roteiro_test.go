@@ -0,0 +1,63 @@
+package simulador
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var roteiroTeste = `
+# comentario
+Funcionalidade: Teste
+  Cenário: Primeiro
+    Dado um pedido "x1" registrado em 01/09/2017
+    E o pedido é entregue em 02/09/2017 10:30
+    Quando o cliente se arrepende em 03/09/2017
+    Então a operação é aceita
+    Mas a devolução fica "SOLICITADA"
+
+  Exemplo: Segundo
+    Dado um pedido entregue em 01/09/2017
+`
+
+func TestLerRoteiro(t *testing.T) {
+	fmt.Println("Entering TestLerRoteiro")
+	roteiro, err := LerRoteiro("teste", strings.NewReader(roteiroTeste))
+	if err != nil {
+		t.Fatalf("Expected scenario file to be parsed: %s", err)
+	}
+	if roteiro.Funcionalidade != "Teste" || len(roteiro.Cenarios) != 2 {
+		t.Fatalf("Expected two scenarios, got %+v", roteiro)
+	}
+	passos := roteiro.Cenarios[0].Passos
+	if len(passos) != 5 || passos[1].Palavra != PalavraDado || passos[4].Palavra != PalavraEntao {
+		t.Fatalf("Expected E and Mas to take the previous keyword, got %+v", passos)
+	}
+	if passos[0].Linha != 5 || passos[0].Texto != `um pedido "x1" registrado em 01/09/2017` {
+		t.Fatalf("Expected step text and line to be kept, got %+v", passos[0])
+	}
+}
+
+func TestLerRoteiroInvalido(t *testing.T) {
+	fmt.Println("Entering TestLerRoteiroInvalido")
+	_, err := LerRoteiro("teste", strings.NewReader("Cenario: x\n  E um pedido registrado em 01/09/2017\n"))
+	if err == nil {
+		t.Fatalf("Expected E without a previous step to be rejected")
+	}
+	_, err = LerRoteiro("teste", strings.NewReader("Cenario: x\n  Porem algo\n"))
+	if err == nil || !strings.Contains(err.Error(), "teste:2") {
+		t.Fatalf("Expected unknown keyword to be reported with its line, got %v", err)
+	}
+}
+
+func TestConverterData(t *testing.T) {
+	fmt.Println("Entering TestConverterData")
+	ms, err := converterData("01/09/2017")
+	if err != nil || ms != InicioPadrao+3*60*60*1000 {
+		t.Fatalf("Expected dates in Brasilia time, got %d", ms)
+	}
+	_, err = converterData("2017-09-01")
+	if err == nil {
+		t.Fatalf("Expected invalid date to be rejected")
+	}
+}
@@ -0,0 +1,241 @@
+//Package simulador roda um chaincode sobre o MockStub do shim com relogio controlado,
+//troca de identidade do chamador e captura de eventos. Nao depende do pacote testing, para
+//poder ser usado pelo sdk e pelo gateway; os atalhos para testes ficam no simuladortest.
+package simulador
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//evento emitido pelo chaincode com SetEvent
+type Evento struct {
+	TxID                   string
+	Nome                   string
+	Payload                []byte
+}
+
+//resultado de uma chamada ao chaincode
+type Resultado struct {
+	TxID                   string
+	Funcao                 string
+	Payload                []byte
+	Err                    error
+}
+
+//relogio das transacoes, em milissegundos como os timestamps dos args do contrato
+type Relogio struct {
+	agora                  int64
+}
+
+//01/09/2017 00:00 UTC, para os testes nao dependerem da hora em que rodam
+const InicioPadrao int64 = 1504224000000
+
+const Dia = 24 * time.Hour
+
+func (r *Relogio) Agora() int64 {
+	return r.agora
+}
+
+//timestamp atual no formato dos args das funcoes do contrato
+func (r *Relogio) Texto() string {
+	return strconv.FormatInt(r.agora, 10)
+}
+
+func (r *Relogio) Avancar(d time.Duration) {
+	r.agora += int64(d / time.Millisecond)
+}
+
+func (r *Relogio) Definir(ms int64) {
+	r.agora = ms
+}
+
+type Simulador struct {
+	Stub                   *shim.MockStub
+	Relogio                *Relogio
+	// atributos do certificado do chamador, lidos pelo ReadCertAttribute
+	Atributos              map[string][]byte
+	// metadados da chamada, lidos pelo GetCallerMetadata; nil quando a chamada nao tem metadados
+	Metadados              []byte
+	Eventos                []Evento
+	// todas as chamadas feitas, na ordem
+	Historico              []Resultado
+	cc                     shim.Chaincode
+	proximaTx              int
+}
+
+//stub entregue ao chaincode: o MockStub com o relogio e a captura de eventos do simulador
+type stubSimulado struct {
+	*shim.MockStub
+	sim                    *Simulador
+}
+
+//o MockStub embutido guarda o ID no campo TxID, que o chaincode nao enxerga pela interface
+func (s *stubSimulado) GetTxID() string {
+	return s.TxID
+}
+
+func (s *stubSimulado) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	agora := s.sim.Relogio.Agora()
+	return &timestamp.Timestamp{Seconds: agora / 1000, Nanos: int32(agora%1000) * 1000000}, nil
+}
+
+func (s *stubSimulado) GetCallerMetadata() ([]byte, error) {
+	return s.sim.Metadados, nil
+}
+
+func (s *stubSimulado) SetEvent(name string, payload []byte) error {
+	s.sim.Eventos = append(s.sim.Eventos, Evento{s.MockStub.TxID, name, payload})
+	return nil
+}
+
+//atributos iniciais do chamador, por exemplo as chaves de cifragem do CPF
+func Novo(cc shim.Chaincode, atributos map[string][]byte) *Simulador {
+	copia := make(map[string][]byte)
+	for nome, valor := range atributos {
+		copia[nome] = valor
+	}
+	return &Simulador{
+		Stub:      shim.NewCustomMockStub("simulador", cc, copia),
+		Relogio:   &Relogio{InicioPadrao},
+		Atributos: copia,
+		cc:        cc,
+	}
+}
+
+func (s *Simulador) stub() *stubSimulado {
+	return &stubSimulado{s.Stub, s}
+}
+
+func (s *Simulador) novaTx() string {
+	s.proximaTx++
+	return "tx" + strconv.Itoa(s.proximaTx)
+}
+
+//troca o atributo "role" do chamador; papel vazio remove o atributo
+func (s *Simulador) ComoPapel(papel string) *Simulador {
+	return s.ComAtributo("role", papel)
+}
+
+//define um atributo do certificado do chamador; valor vazio remove o atributo
+func (s *Simulador) ComAtributo(nome string, valor string) *Simulador {
+	if valor == "" {
+		delete(s.Atributos, nome)
+	} else {
+		s.Atributos[nome] = []byte(valor)
+	}
+	return s
+}
+
+//define os metadados das proximas chamadas, como o "metadata" do ChaincodeSpec; vazio remove
+func (s *Simulador) ComMetadados(metadados string) *Simulador {
+	if metadados == "" {
+		s.Metadados = nil
+	} else {
+		s.Metadados = []byte(metadados)
+	}
+	return s
+}
+
+func (s *Simulador) Init(args ...string) Resultado {
+	return s.executar("init", args, func(stub shim.ChaincodeStubInterface) ([]byte, error) {
+		return s.cc.Init(stub, "init", args)
+	})
+}
+
+func (s *Simulador) Invocar(funcao string, args ...string) Resultado {
+	return s.executar(funcao, args, func(stub shim.ChaincodeStubInterface) ([]byte, error) {
+		return s.cc.Invoke(stub, funcao, args)
+	})
+}
+
+func (s *Simulador) Consultar(funcao string, args ...string) Resultado {
+	return s.executar(funcao, args, func(stub shim.ChaincodeStubInterface) ([]byte, error) {
+		return s.cc.Query(stub, funcao, args)
+	})
+}
+
+//a chamada roda como uma transacao: se devolver erro, o estado e os eventos voltam a ser os de
+//antes, como no peer, onde a transacao com erro nao grava nada
+func (s *Simulador) executar(funcao string, args []string, chamada func(stub shim.ChaincodeStubInterface) ([]byte, error)) Resultado {
+	txID := s.novaTx()
+	estado := make(map[string][]byte, len(s.Stub.State))
+	for chave, valor := range s.Stub.State {
+		estado[chave] = valor
+	}
+	chaves := list.New()
+	chaves.PushBackList(s.Stub.Keys)
+	eventos := len(s.Eventos)
+
+	s.Stub.MockTransactionStart(txID)
+	payload, err := chamada(s.stub())
+	s.Stub.MockTransactionEnd(txID)
+	if err != nil {
+		s.Stub.State = estado
+		s.Stub.Keys = chaves
+		s.Eventos = s.Eventos[:eventos]
+	}
+	resultado := Resultado{txID, funcao, payload, err}
+	s.Historico = append(s.Historico, resultado)
+	return resultado
+}
+
+//eventos emitidos com o nome informado, na ordem
+func (s *Simulador) EventosComNome(nome string) []Evento {
+	eventos := []Evento{}
+	for _, e := range s.Eventos {
+		if e.Nome == nome {
+			eventos = append(eventos, e)
+		}
+	}
+	return eventos
+}
+
+//valor de um campo do JSON gravado na chave, pelo caminho separado por pontos
+//(por exemplo "devolucao.status" ou "subPedidos.0.dataEntrega")
+func (s *Simulador) ValorCampo(chave string, caminho string) (interface{}, error) {
+	bytes, err := s.Stub.GetState(chave)
+	if err != nil {
+		return nil, err
+	}
+	if bytes == nil {
+		return nil, fmt.Errorf("key %s not found", chave)
+	}
+	return campoJSON(bytes, caminho)
+}
+
+func campoJSON(bytes []byte, caminho string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	decoder.UseNumber()
+	var valor interface{}
+	err := decoder.Decode(&valor)
+	if err != nil {
+		return nil, err
+	}
+	for _, parte := range strings.Split(caminho, ".") {
+		switch atual := valor.(type) {
+		case map[string]interface{}:
+			proximo, ok := atual[parte]
+			if !ok {
+				return nil, fmt.Errorf("no field %s", parte)
+			}
+			valor = proximo
+		case []interface{}:
+			i, err := strconv.Atoi(parte)
+			if err != nil || i < 0 || i >= len(atual) {
+				return nil, fmt.Errorf("no index %s", parte)
+			}
+			valor = atual[i]
+		default:
+			return nil, fmt.Errorf("can not read %s of a %T", parte, valor)
+		}
+	}
+	return valor, nil
+}
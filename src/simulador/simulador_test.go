@@ -0,0 +1,114 @@
+package simulador_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/simulador"
+	"github.com/rodneicouto/chaincode/src/simulador/simuladortest"
+)
+
+//chaincode minimo: grava o papel do chamador e a hora da transacao e emite um evento
+type chaincodeEco struct {
+}
+
+func (c *chaincodeEco) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *chaincodeEco) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	//grava e emite o evento, mas devolve erro: nada disso pode ficar
+	if function == "GravarEFalhar" && len(args) > 0 {
+		stub.PutState(args[0], []byte(`{}`))
+		stub.SetEvent("gravado", []byte(args[0]))
+		return nil, errors.New("Failed after writing")
+	}
+	if function != "Gravar" || len(args) < 1 {
+		return nil, errors.New("Unknown invoke")
+	}
+	role, _ := stub.ReadCertAttribute("role")
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	valor := fmt.Sprintf(`{"papel":"%s","hora":%d,"itens":[{"id":"a"}]}`, role, ts.Seconds*1000+int64(ts.Nanos/1000000))
+	stub.SetEvent("gravado", []byte(args[0]))
+	return nil, stub.PutState(args[0], []byte(valor))
+}
+
+func (c *chaincodeEco) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	return stub.GetState(args[0])
+}
+
+func TestRelogioEIdentidade(t *testing.T) {
+	fmt.Println("Entering TestRelogioEIdentidade")
+	sim := simuladortest.Novo(new(chaincodeEco), nil)
+	sim.Relogio.Avancar(2*simulador.Dia + 1500*time.Millisecond)
+	sim.ComoPapel("loja").DeveInvocar(t, "Gravar", "k1")
+
+	sim.AssertCampo(t, "k1", "papel", "loja")
+	sim.AssertCampo(t, "k1", "hora", simulador.InicioPadrao+172801500)
+	sim.AssertCampo(t, "k1", "itens.0.id", "a")
+
+	sim.ComoPapel("")
+	sim.DeveInvocar(t, "Gravar", "k2")
+	sim.AssertCampo(t, "k2", "papel", "")
+
+	var valor map[string]interface{}
+	sim.DeveConsultar(t, &valor, "Ler", "k2")
+	if valor["papel"] != "" {
+		t.Fatalf("Expected query to return the stored value")
+	}
+}
+
+func TestEventosEHistorico(t *testing.T) {
+	fmt.Println("Entering TestEventosEHistorico")
+	sim := simuladortest.Novo(new(chaincodeEco), nil)
+	sim.DeveInvocar(t, "Gravar", "k1")
+	sim.DeveFalhar(t, "Apagar", "k1")
+	sim.DeveInvocar(t, "Gravar", "k2")
+
+	eventos := sim.EventosComNome("gravado")
+	if len(eventos) != 2 || string(eventos[1].Payload) != "k2" || eventos[1].TxID != "tx3" {
+		t.Fatalf("Expected one event per successful invoke, got %+v", eventos)
+	}
+	if len(sim.Historico) != 3 || sim.Historico[1].Err == nil {
+		t.Fatalf("Expected every call in the history")
+	}
+}
+
+func TestChaveNFe(t *testing.T) {
+	fmt.Println("Entering TestChaveNFe")
+	//o digito verificador e conferido pelo contrato nos roteiros de aceitacao
+	if simulador.ChaveNFe(1234)[25:34] != "000001234" {
+		t.Fatalf("Expected the invoice number in the key, got %s", simulador.ChaveNFe(1234))
+	}
+	if len(simulador.ChaveNFe(7)) != 44 || simulador.ChaveNFe(7) == simulador.ChaveNFe(8) {
+		t.Fatalf("Expected distinct 44 digit keys")
+	}
+}
+
+func TestInvokeComErroDesfazEscritas(t *testing.T) {
+	fmt.Println("Entering TestInvokeComErroDesfazEscritas")
+	sim := simuladortest.Novo(new(chaincodeEco), nil)
+	sim.DeveInvocar(t, "Gravar", "k1")
+	sim.DeveFalhar(t, "GravarEFalhar", "k1")
+	sim.DeveFalhar(t, "GravarEFalhar", "k2")
+
+	sim.AssertCampo(t, "k1", "itens.0.id", "a")
+	if bytes, _ := sim.Stub.GetState("k2"); bytes != nil {
+		t.Fatalf("Expected the write of the failed invoke to be undone")
+	}
+	iter, _ := sim.Stub.RangeQueryState("", "")
+	var chaves []string
+	for iter.HasNext() {
+		chave, _, _ := iter.Next()
+		chaves = append(chaves, chave)
+	}
+	if len(chaves) != 1 || len(sim.Eventos) != 1 {
+		t.Fatalf("Expected only k1 and its event after the failed invokes, got %v and %d events", chaves, len(sim.Eventos))
+	}
+}
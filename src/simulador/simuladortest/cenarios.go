@@ -0,0 +1,30 @@
+package simuladortest
+
+import (
+	"testing"
+
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+//cenarios prontos do SaleContractChainCode, montados com o relogio do simulador.
+//Cada um parte do anterior: registrado -> entregue -> devolvido
+
+func (s *Simulador) PedidoRegistrado(t testing.TB, id string, pedidoJSON string) {
+	s.DeveInvocar(t, "RegistrarPedido", id, pedidoJSON)
+}
+
+//registra e entrega o pedido na hora atual do relogio
+func (s *Simulador) PedidoEntregue(t testing.TB, id string, pedidoJSON string) {
+	s.PedidoRegistrado(t, id, pedidoJSON)
+	s.DeveInvocar(t, "RegistrarEntrega", id, s.Relogio.Texto())
+}
+
+//entrega o pedido e, um dia depois, o cliente se arrepende; o papel do chamador e restaurado no fim
+func (s *Simulador) PedidoDevolvido(t testing.TB, id string, pedidoJSON string, chaveNFeDevolucao string) {
+	s.PedidoEntregue(t, id, pedidoJSON)
+	s.Relogio.Avancar(simulador.Dia)
+	papel := string(s.Atributos["role"])
+	s.ComoClienteDe(t, id)
+	s.DeveInvocar(t, "RegistrarArrependimento", id, s.Relogio.Texto(), chaveNFeDevolucao)
+	s.ComoPapel(papel)
+}
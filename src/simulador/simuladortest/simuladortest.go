@@ -0,0 +1,142 @@
+//Package simuladortest tem os atalhos de teste do simulador: chamadas que falham o teste,
+//leitura de campos do ledger e cenarios prontos do SaleContractChainCode. Fica separado para o
+//pacote testing nao entrar nos binarios que usam o simulador.
+package simuladortest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/rodneicouto/chaincode/src/simulador"
+)
+
+//simulador com os atalhos de teste; ComoPapel, ComAtributo e ComMetadados devolvem o proprio Simulador para
+//encadear com DeveInvocar
+type Simulador struct {
+	*simulador.Simulador
+}
+
+func Novo(cc shim.Chaincode, atributos map[string][]byte) *Simulador {
+	return &Simulador{simulador.Novo(cc, atributos)}
+}
+
+func (s *Simulador) ComoPapel(papel string) *Simulador {
+	s.Simulador.ComoPapel(papel)
+	return s
+}
+
+func (s *Simulador) ComAtributo(nome string, valor string) *Simulador {
+	s.Simulador.ComAtributo(nome, valor)
+	return s
+}
+
+func (s *Simulador) ComMetadados(metadados string) *Simulador {
+	s.Simulador.ComMetadados(metadados)
+	return s
+}
+
+//assume o papel de cliente com o cpfHash gravado no pedido, como o certificado do dono do pedido
+func (s *Simulador) ComoClienteDe(t testing.TB, id string) *Simulador {
+	cpfHash, err := s.ValorCampo(id, "cpfHash")
+	if err != nil {
+		t.Fatalf("Could not read cpfHash of %s: %s", id, err)
+	}
+	s.ComoPapel("cliente")
+	return s.ComAtributo("cpfHash", fmt.Sprint(cpfHash))
+}
+
+//invoca e falha o teste se a funcao devolver erro
+func (s *Simulador) DeveInvocar(t testing.TB, funcao string, args ...string) []byte {
+	r := s.Invocar(funcao, args...)
+	if r.Err != nil {
+		t.Fatalf("Expected %s%v to succeed: %s", funcao, args, r.Err)
+	}
+	return r.Payload
+}
+
+//invoca e falha o teste se a funcao nao devolver erro; devolve o erro para conferir a mensagem
+func (s *Simulador) DeveFalhar(t testing.TB, funcao string, args ...string) error {
+	r := s.Invocar(funcao, args...)
+	if r.Err == nil {
+		t.Fatalf("Expected %s%v to fail", funcao, args)
+	}
+	return r.Err
+}
+
+//consulta, falha o teste em caso de erro e decodifica o JSON devolvido em destino
+func (s *Simulador) DeveConsultar(t testing.TB, destino interface{}, funcao string, args ...string) {
+	r := s.Consultar(funcao, args...)
+	if r.Err != nil {
+		t.Fatalf("Expected query %s%v to succeed: %s", funcao, args, r.Err)
+	}
+	if destino == nil {
+		return
+	}
+	err := json.Unmarshal(r.Payload, destino)
+	if err != nil {
+		t.Fatalf("Invalid JSON from %s: %s", funcao, err)
+	}
+}
+
+//decodifica o valor gravado na chave; falha se a chave nao existir
+func (s *Simulador) Estado(t testing.TB, chave string, destino interface{}) {
+	bytes, err := s.Stub.GetState(chave)
+	if err != nil || bytes == nil {
+		t.Fatalf("Expected key %s in the ledger", chave)
+	}
+	err = json.Unmarshal(bytes, destino)
+	if err != nil {
+		t.Fatalf("Invalid JSON at key %s: %s", chave, err)
+	}
+}
+
+//valor de um campo do JSON gravado na chave, pelo caminho separado por pontos
+func (s *Simulador) Campo(t testing.TB, chave string, caminho string) interface{} {
+	valor, err := s.ValorCampo(chave, caminho)
+	if err != nil {
+		t.Fatalf("Field %s of %s: %s", caminho, chave, err)
+	}
+	return valor
+}
+
+//compara o campo com o esperado pela representacao em texto, entao 1504224000000 e "1504224000000" sao iguais
+func (s *Simulador) AssertCampo(t testing.TB, chave string, caminho string, esperado interface{}) {
+	valor := s.Campo(t, chave, caminho)
+	if fmt.Sprint(valor) != fmt.Sprint(esperado) {
+		t.Fatalf("Expected %s of %s to be %v, got %v", caminho, chave, esperado, valor)
+	}
+}
+
+//executa todos os cenarios dos arquivos do padrao, cada um em um simulador criado por novo,
+//e reporta o resultado de cada cenario
+func ExecutarRoteiros(t testing.TB, padrao string, novo func() *simulador.Simulador, config simulador.ConfigRoteiro) {
+	arquivos, err := filepath.Glob(padrao)
+	if err != nil || len(arquivos) == 0 {
+		t.Fatalf("No scenario files match %s", padrao)
+	}
+	for _, arquivo := range arquivos {
+		f, err := os.Open(arquivo)
+		if err != nil {
+			t.Fatalf("Could not open %s: %s", arquivo, err)
+		}
+		roteiro, err := simulador.LerRoteiro(arquivo, f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		for _, cenario := range roteiro.Cenarios {
+			err = simulador.ExecutarCenario(novo(), config, cenario)
+			if err != nil {
+				fmt.Println("FALHOU " + arquivo + ":" + strconv.Itoa(cenario.Linha) + " " + cenario.Nome)
+				t.Errorf("%s:%d %s: %s", arquivo, cenario.Linha, cenario.Nome, err)
+			} else {
+				fmt.Println("ok     " + arquivo + ":" + strconv.Itoa(cenario.Linha) + " " + cenario.Nome)
+			}
+		}
+	}
+}